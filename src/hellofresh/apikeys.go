@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"hellofresh/model"
+	"hellofresh/util"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiKeyRequest payload of POST /api-keys
+type apiKeyRequest struct {
+	Name    string     `json:"name"`
+	Scopes  []string   `json:"scopes"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// createdAPIKey response of POST /api-keys, the only one holding the key itself
+type createdAPIKey struct {
+	*model.APIKey
+	Key string `json:"key"`
+}
+
+// apiKeyStore util.APIKeyStore of the API keys in the database
+type apiKeyStore struct {
+	db interface{}
+}
+
+// AuthenticateAPIKey principal of the key, nil for unknown, revoked and expired keys
+func (store *apiKeyStore) AuthenticateAPIKey(plain string) (*util.Principal, error) {
+	key, err := model.GetAPIKeyByHash(store.db, model.HashAPIKey(plain))
+	if _, ok := err.(*model.NotFoundError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !key.Active(time.Now()) {
+		return nil, nil
+	}
+	// the last use is informational, failing to record it does not fail the request
+	if err := key.TouchAPIKey(store.db); err != nil {
+		log.Printf("api key %s: recording last use: %v", key.KeyID(), err)
+	}
+	return key.Principal(), nil
+}
+
+// createAPIKey POST /api-keys
+func (app *App) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request apiKeyRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	key, plain, err := model.NewAPIKey(request.Name, request.Scopes, request.Expires, util.PrincipalFrom(r.Context()).ID)
+	if err == nil {
+		err = key.CreateAPIKey(app.DB)
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.Render(w, r, http.StatusCreated, &createdAPIKey{APIKey: key, Key: plain})
+}
+
+// getAPIKeys GET /api-keys
+func (app *App) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := model.GetAPIKeys(app.DB)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.Render(w, r, http.StatusOK, keys)
+}
+
+// revokeAPIKey DELETE /api-keys/{id}
+func (app *App) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := model.RevokeAPIKey(app.DB, mux.Vars(r)["id"])
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.Render(w, r, http.StatusOK, key)
+}
@@ -1,25 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"hellofresh/config"
 	"hellofresh/dal"
 	"hellofresh/util"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"hellofresh/model"
 
 	"github.com/gorilla/mux"
+	"github.com/graphql-go/graphql"
 )
 
 // App the app container
 type App struct {
-	Router *mux.Router
-	DB     interface{}
-	Config *config.Config
+	Router     *mux.Router
+	DB         interface{}
+	Config     *config.Config
+	Enviroment Enviroment
+	// graphQLSchema schema served on /graphql, built with the routes
+	graphQLSchema graphql.Schema
 }
 
 // Enviroment enviroment
@@ -39,6 +47,7 @@ func (app *App) Initialize(enviroment Enviroment) {
 		util.PanicOnError(err)
 	}
 	app.Config = config
+	app.Enviroment = enviroment
 
 	// open dal
 	if enviroment == Prod {
@@ -51,10 +60,71 @@ func (app *App) Initialize(enviroment Enviroment) {
 		}
 	}
 
+	if err = model.EnsureSchema(app.DB); err != nil {
+		util.PanicOnError(err)
+	}
+
+	// accounts of the database replace the shared credential of the auth config
+	if err = app.ensureAdmin(); err != nil {
+		util.PanicOnError(err)
+	}
+	util.SetUserStore(&userStore{db: app.DB})
+	util.SetAPIKeyStore(&apiKeyStore{db: app.DB})
+	util.SetAuthAuditor(&authAuditor{db: app.DB})
+
+	// client IPs of requests relayed by the reverse proxies are taken from X-Forwarded-For
+	if err = util.SetTrustedProxies(config.TrustedProxies); err != nil {
+		util.PanicOnError(err)
+	}
+	// anonymous raters are told apart by a salted fingerprint
+	if err = config.RatingConfig.Validate(); err != nil {
+		util.PanicOnError(err)
+	}
+	if config.MaxBodySize < 0 {
+		util.PanicOnError(fmt.Errorf("maxBodySize: must not be negative, got %d", config.MaxBodySize))
+	}
+
+	// failed password logins are throttled per username and client IP
+	guard, err := util.NewLoginGuard(config.AuthConfig.Lockout)
+	if err != nil {
+		util.PanicOnError(err)
+	}
+	util.SetLoginGuard(guard)
+
+	// partners sign requests with their own secret instead of holding account credentials
+	verifier, err := util.NewSignatureVerifier(config.AuthConfig.Signing)
+	if err != nil {
+		util.PanicOnError(err)
+	}
+	util.SetSignatureVerifier(verifier)
+
+	// bearer tokens replace basic auth credentials, issued by POST /auth/token with auth type jwt or by the identity provider with oauth2
+	switch config.AuthConfig.Type {
+	case "jwt":
+		signer, err := util.NewTokenSigner(config.AuthConfig.JWT)
+		if err != nil {
+			util.PanicOnError(err)
+		}
+		util.SetTokenSigner(signer)
+		util.SetTokenIntrospector(nil)
+	case "oauth2":
+		introspector, err := util.NewIntrospector(config.AuthConfig.OAuth2)
+		if err != nil {
+			util.PanicOnError(err)
+		}
+		util.SetTokenSigner(nil)
+		util.SetTokenIntrospector(introspector)
+	case "", "basic":
+		util.SetTokenSigner(nil)
+		util.SetTokenIntrospector(nil)
+	default:
+		util.PanicOnError(fmt.Errorf("unsupported auth type %q, use basic, jwt or oauth2", config.AuthConfig.Type))
+	}
+
 	// set up new router
 	app.Router = mux.NewRouter()
 	// init routes
-	app.initializeRoutes()
+	app.InitializeRoutes()
 }
 
 // Run ListenAndServe
@@ -70,51 +140,171 @@ func (app *App) Run(addr string) {
 	log.Fatal(srv.ListenAndServe())
 }
 
-// initializeRoutes init routes
-func (app *App) initializeRoutes() {
+// InitializeRoutes init routes
+func (app *App) InitializeRoutes() {
 	// alive check
 	// GET / | non-protected
-	app.Router.HandleFunc("/", app.aliveCheck).Methods("GET")
+	app.Router.HandleFunc("/", util.Use(app.aliveCheck, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// OpenAPI 3 document generated from these routes, every route needs an entry in routeDocs
+	// GET /openapi.json | non-protected
+	app.Router.HandleFunc("/openapi.json", util.Use(app.getOpenAPI, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// GraphQL queries and mutations, mutations require credentials
+	// POST /graphql | non-protected
+	schema, err := app.newGraphQLSchema()
+	if err != nil {
+		util.PanicOnError(err)
+	}
+	app.graphQLSchema = schema
+	app.Router.HandleFunc("/graphql", util.Use(app.postGraphQL, app.ValidateRequest, util.Recover)).Methods("POST")
+
+	// register account without roles, when enabled by auth.registration
+	// POST /users/register | non-protected
+	app.Router.HandleFunc("/users/register", util.Use(app.registerUser, app.ValidateRequest, util.Recover)).Methods("POST")
+
+	// exchange credentials or a refresh token for access and refresh tokens, when auth.type is jwt
+	// POST /auth/token | non-protected
+	app.Router.HandleFunc("/auth/token", util.Use(app.issueToken, app.ValidateRequest, util.Recover)).Methods("POST")
+
+	// revoke the refresh tokens of the subject of a refresh token, when auth.type is jwt
+	// POST /auth/revoke | non-protected
+	app.Router.HandleFunc("/auth/revoke", util.Use(app.revokeToken, app.ValidateRequest, util.Recover)).Methods("POST")
+
+	// create account with roles
+	// POST /users | auth, admin
+	app.Router.HandleFunc("/users", util.Use(app.createUser, app.ValidateRequest, util.RequirePermission(util.PermissionManageUsers), util.RequireAuth, util.Recover)).Methods("POST")
+
+	// account of the credentials
+	// GET /users/me | auth
+	app.Router.HandleFunc("/users/me", util.Use(app.getCurrentUser, app.ValidateRequest, util.RequireAuth, util.Recover)).Methods("GET")
+
+	// recipes created by user, ordered by id
+	// GET /users/{id}/recipes?offset=0&limit=10 | non-protected
+	app.Router.HandleFunc("/users/{id}/recipes", util.Use(app.getUserRecipes, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// create API key of a service client, the key is only returned by this call
+	// POST /api-keys | auth, admin
+	app.Router.HandleFunc("/api-keys", util.Use(app.createAPIKey, app.ValidateRequest, util.RequirePermission(util.PermissionManageAPIKeys), util.RequireAuth, util.Recover)).Methods("POST")
+
+	// API keys without their secret, revoked and expired ones included
+	// GET /api-keys | auth, admin
+	app.Router.HandleFunc("/api-keys", util.Use(app.getAPIKeys, app.ValidateRequest, util.RequirePermission(util.PermissionManageAPIKeys), util.RequireAuth, util.Recover)).Methods("GET")
+
+	// revoke API key, it is kept for the audit of its last use
+	// DELETE /api-keys/{id} | auth, admin
+	app.Router.HandleFunc("/api-keys/{id}", util.Use(app.revokeAPIKey, app.ValidateRequest, util.RequirePermission(util.PermissionManageAPIKeys), util.RequireAuth, util.Recover)).Methods("DELETE")
+
+	// changes of recipe, oldest first
+	// GET /recipes/{id}/audit?offset=0&limit=10 | auth, admin
+	app.Router.HandleFunc("/recipes/{id}/audit", util.Use(app.getRecipeAudit, app.ValidateRequest, util.RequirePermission(util.PermissionReadAudit), util.RequireAuth, util.Recover)).Methods("GET")
+
+	// changes of every recipe, optionally by user and since a time, oldest first
+	// GET /audit?user=&since=&offset=0&limit=10 | auth, admin
+	app.Router.HandleFunc("/audit", util.Use(app.getAudit, app.ValidateRequest, util.RequirePermission(util.PermissionReadAudit), util.RequireAuth, util.Recover)).Methods("GET")
+
+	// v1, today's shapes
+	app.initializeV1Routes(app.Router.PathPrefix("/v1").Subrouter())
+	// v2, richer recipe representation
+	app.initializeV2Routes(app.Router.PathPrefix("/v2").Subrouter())
+	// unversioned routes are v1, kept for existing clients
+	app.initializeV1Routes(app.Router)
+
+	// links of hypermedia responses are generated from the route names
+	app.nameRoutes()
+}
+
+// initializeV1Routes init v1 routes on router, every response is flagged as deprecated in favor of /v2
+func (app *App) initializeV1Routes(router *mux.Router) {
+	deprecated := util.Deprecated(app.v1Sunset(), "/v2")
 
 	// create recipe
-	// POST /recipes | basic auth
-	app.Router.HandleFunc("/recipes", util.Use(app.createRecipe, util.BasicAuth)).Methods("POST")
+	// POST /v1/recipes | auth, editor, Idempotency-Key
+	router.HandleFunc("/recipes", util.Use(app.createRecipe, app.Idempotent, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, deprecated, util.Recover)).Methods("POST")
+
+	// batch create, update and delete recipes
+	// POST /v1/recipes:batch | auth, editor, Idempotency-Key
+	router.HandleFunc("/recipes:batch", util.Use(app.batchRecipes, app.Idempotent, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, deprecated, util.Recover)).Methods("POST")
+
+	// export recipes as NDJSON, must be registered before /recipes/{id}
+	// GET /v1/recipes/export?ratings=true | auth, viewer
+	router.HandleFunc("/recipes/export", util.Use(app.exportRecipes, app.ValidateRequest, util.RequirePermission(util.PermissionExport), util.RequireAuth, deprecated, util.Recover)).Methods("GET")
+
+	// import recipes from NDJSON
+	// POST /v1/recipes/import | auth, editor
+	router.HandleFunc("/recipes/import", util.Use(app.importRecipes, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, deprecated, util.Recover)).Methods("POST")
+
+	// import schema.org Recipe JSON-LD documents
+	// POST /v1/recipes/import/jsonld | auth, editor
+	router.HandleFunc("/recipes/import/jsonld", util.Use(app.importSchemaRecipes, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, deprecated, util.Recover)).Methods("POST")
 
 	// get single recipe
-	// GET /recipes/{id} | non-protected
-	app.Router.HandleFunc("/recipes/{id}", app.getRecipe).Methods("GET")
+	// GET /v1/recipes/{id} | non-protected
+	router.HandleFunc("/recipes/{id}", util.Use(app.getRecipe, app.ValidateRequest, deprecated, util.Recover)).Methods("GET")
 
 	// get recipe list
-	// GET /recipes/{start:[0-9]+}/{limit:[0-9]+} | non-protected
-	app.Router.HandleFunc("/recipes/{start:[0-9]+}/{limit:[0-9]+}", app.getRecipes).Methods("GET")
+	// GET /v1/recipes/{start:[0-9]+}/{limit:[0-9]+} | non-protected
+	router.HandleFunc("/recipes/{start:[0-9]+}/{limit:[0-9]+}", util.Use(app.getRecipes, app.ValidateRequest, deprecated, util.Recover)).Methods("GET")
 
 	// update recipe
-	// PUT /recipes/{id} | basic auth
-	app.Router.HandleFunc("/recipes/{id}", util.Use(app.updateRecipe, util.BasicAuth)).Methods("PUT")
+	// PUT /v1/recipes/{id} | auth, editor
+	router.HandleFunc("/recipes/{id}", util.Use(app.updateRecipe, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, deprecated, util.Recover)).Methods("PUT")
+
+	// patch recipe
+	// PATCH /v1/recipes/{id} | auth, editor
+	router.HandleFunc("/recipes/{id}", util.Use(app.patchRecipe, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, deprecated, util.Recover)).Methods("PATCH")
 
 	// delete recipe
-	// DELETE /recipes/{id} | basic auth
-	app.Router.HandleFunc("/recipes/{id}", util.Use(app.deleteRecipe, util.BasicAuth)).Methods("DELETE")
+	// DELETE /v1/recipes/{id} | auth, admin
+	router.HandleFunc("/recipes/{id}", util.Use(app.deleteRecipe, app.ValidateRequest, util.RequirePermission(util.PermissionDelete), util.RequireAuth, deprecated, util.Recover)).Methods("DELETE")
 
 	// rate recipe
-	// PUT /recipes/{id}/rate/{rate:[1-5]} | basic auth
-	app.Router.HandleFunc("/recipes/{id}/rate/{rate:[1-5]}", util.Use(app.rateRecipe, util.BasicAuth)).Methods("PUT")
+	// PUT /v1/recipes/{id}/rate/{rate:[1-5]} | auth, rater or anonymous if enabled, Idempotency-Key
+	router.HandleFunc("/recipes/{id}/rate/{rate:[1-5]}", util.Use(app.rateRecipe, app.Idempotent, app.ValidateRequest, app.RequireRater, deprecated, util.Recover)).Methods("PUT")
 
 	// search recipe by name
-	// GET /recipes/search/{name} | non-protected
-	app.Router.HandleFunc("/recipes/search/{search:.+}", app.searchRecipes).Methods("GET")
+	// GET /v1/recipes/search/{name} | non-protected
+	router.HandleFunc("/recipes/search/{search:.+}", util.Use(app.searchRecipes, app.ValidateRequest, deprecated, util.Recover)).Methods("GET")
+}
+
+// v1Sunset date sent in the Sunset header of v1 responses, zero when not configured
+func (app *App) v1Sunset() time.Time {
+	if app.Config == nil || app.Config.VersioningConfig.V1Sunset == "" {
+		return time.Time{}
+	}
+
+	sunset, err := time.Parse(time.RFC3339, app.Config.VersioningConfig.V1Sunset)
+	if err != nil {
+		log.Printf("invalid versioning.v1Sunset %q: %v", app.Config.VersioningConfig.V1Sunset, err)
+		return time.Time{}
+	}
+	return sunset
+}
+
+// defaultMaxBodySize largest JSON request body when maxBodySize is not configured, 1 MiB
+const defaultMaxBodySize = 1024 * 1024
+
+// maxBodySize largest JSON request body buffered to be validated or hashed for Idempotency-Key
+func (app *App) maxBodySize() int64 {
+	if app.Config == nil || app.Config.MaxBodySize <= 0 {
+		return defaultMaxBodySize
+	}
+	return app.Config.MaxBodySize
 }
 
 // main app entry
 func main() {
 	app := &App{}
 	app.Initialize(Prod)
+	if addr := app.Config.GRPCConfig.Addr; addr != "" {
+		go app.RunGRPC(addr)
+	}
 	app.Run(":8080")
 }
 
 // aliveCheck GET /
 func (app *App) aliveCheck(w http.ResponseWriter, r *http.Request) {
-	util.ResponseWithJSON(w, http.StatusOK, "alive")
+	util.Render(w, r, http.StatusOK, "alive")
 }
 
 // getRecipes GET /recipes/{start}/{limit}
@@ -134,28 +324,123 @@ func (app *App) getRecipes(w http.ResponseWriter, r *http.Request) {
 	recipe := &model.Recipe{}
 	recipes, err := recipe.GetRecipes(app.DB, start, limit)
 	if err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
-	util.ResponseWithJSON(w, http.StatusOK, recipes)
+
+	app.responseWithRecipes(w, r, recipes)
 }
 
 // createRecipe POST /recipes
 func (app *App) createRecipe(w http.ResponseWriter, r *http.Request) {
 	var recipe model.Recipe
+	if !app.decodeRecipe(w, r, &recipe) {
+		return
+	}
+
+	recipe.ID = nil
+	authoredBy(r.Context(), &recipe)
+	if err := recipe.CreateRecipe(r.Context(), app.DB); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.RenderVersion(w, r, http.StatusCreated, recipe, recipe.Version)
+}
+
+// batchRequest payload of POST /recipes:batch
+type batchRequest struct {
+	// Atomic all-or-nothing, roll back every operation if one fails
+	Atomic     bool                     `json:"atomic"`
+	Operations []*batchRequestOperation `json:"operations"`
+}
+
+// batchRequestOperation operation of POST /recipes:batch, recipe is decoded and validated separately
+type batchRequestOperation struct {
+	Op      string          `json:"op"`
+	ID      string          `json:"id"`
+	Version int             `json:"version"`
+	Recipe  json.RawMessage `json:"recipe"`
+}
+
+// batchRecipes POST /recipes:batch
+func (app *App) batchRecipes(w http.ResponseWriter, r *http.Request) {
+	var batch batchRequest
 	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&recipe); err != nil {
-		util.ResponseWithError(w, http.StatusBadRequest, "Invalid request payload")
+	if err := decoder.Decode(&batch); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
 		return
 	}
 	defer r.Body.Close()
 
-	if err := recipe.CreateRecipe(app.DB); err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+	if len(batch.Operations) == 0 {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "No batch operations")
+		return
+	}
+
+	if maxSize := app.Config.BatchConfig.MaxSize; maxSize > 0 && len(batch.Operations) > maxSize {
+		util.ResponseWithError(w, r, http.StatusBadRequest, fmt.Sprintf("Batch size exceeds maximum of %d operations", maxSize))
+		return
+	}
+
+	// deletes need the permission of DELETE /recipes/{id}, the rest the one of the route
+	principal := util.PrincipalFrom(r.Context())
+	for _, requested := range batch.Operations {
+		if requested.Op == model.BatchDelete && !principal.Can(util.PermissionDelete) {
+			util.ResponseWithError(w, r, http.StatusForbidden, "Permission "+util.PermissionDelete+" required")
+			return
+		}
+	}
+
+	// the whole batch is rejected before anything is applied if one recipe is invalid
+	operations := make([]*model.BatchOperation, len(batch.Operations))
+	fieldErrors := []*model.FieldError{}
+	for i, requested := range batch.Operations {
+		operations[i] = &model.BatchOperation{Op: requested.Op, ID: requested.ID, Version: requested.Version}
+		if len(requested.Recipe) == 0 {
+			continue
+		}
+
+		prefix := fmt.Sprintf("operations[%d].recipe.", i)
+		operations[i].Recipe = &model.Recipe{}
+		if err := model.DecodeRecipe(requested.Recipe, operations[i].Recipe); err != nil {
+			fieldErrors = append(fieldErrors, prefixFieldErrors(prefix, err)...)
+			continue
+		}
+		fieldErrors = append(fieldErrors, operations[i].Recipe.FieldErrors(prefix)...)
+	}
+
+	if len(fieldErrors) > 0 {
+		util.ResponseWithDomainError(w, r, &model.ValidationError{Message: "Invalid batch", Fields: fieldErrors})
+		return
+	}
+
+	// the whole batch is rejected if it updates a recipe of another user
+	for _, operation := range operations {
+		if operation.Recipe != nil {
+			authoredBy(r.Context(), operation.Recipe)
+		}
+		if operation.Op != model.BatchUpdate {
+			continue
+		}
+		if err := app.checkOwnerOf(r.Context(), model.ID(operation.ID)); err != nil {
+			util.ResponseWithDomainError(w, r, err)
+			return
+		}
+	}
+
+	recipe := &model.Recipe{}
+	results, err := recipe.BatchRecipes(r.Context(), app.DB, operations, batch.Atomic)
+	if err != nil && err != model.ErrBatchAborted {
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
 
-	util.ResponseWithJSON(w, http.StatusCreated, recipe)
+	code := http.StatusOK
+	if err == model.ErrBatchAborted {
+		code = http.StatusUnprocessableEntity
+	}
+	util.Render(w, r, code, map[string]interface{}{"committed": err == nil, "results": results})
 }
 
 // getRecipe GET /recipes/{id}
@@ -164,42 +449,156 @@ func (app *App) getRecipe(w http.ResponseWriter, r *http.Request) {
 	id := (model.ID)(vars["id"])
 	recipe, err := id.GetRecipe(app.DB)
 	if err != nil {
-		util.ResponseWithError(w, http.StatusBadRequest, err.Error())
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
 
-	util.ResponseWithJSON(w, http.StatusOK, recipe)
+	// JSON-LD and HAL are negotiated with the media types of Render, by quality then position in Accept
+	switch util.Preferred(r, "application/ld+json", halMediaType) {
+	case "application/ld+json":
+		app.responseWithSchemaRecipe(w, r, recipe)
+	case halMediaType:
+		app.responseWithHAL(w, r, app.recipeResource(r, recipe), recipe.Version)
+	default:
+		util.RenderVersion(w, r, http.StatusOK, recipe, recipe.Version)
+	}
 }
 
 // updateRecipe PUT /recipes/{id}
 func (app *App) updateRecipe(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	// reject malformed ids and recipes of other users before the payload is validated
+	id := (model.ID)(mux.Vars(r)["id"])
+	if _, err := id.Parse(); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+	if err := app.checkOwnerOf(r.Context(), id); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	recipe := &model.Recipe{}
+	if !app.decodeRecipe(w, r, recipe) {
+		return
+	}
+
+	recipe.ID = string(id)
+	recipe.Version = version
+	app.saveRecipe(w, r, recipe)
+}
+
+// patchRecipe PATCH /recipes/{id}
+func (app *App) patchRecipe(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
-	recipe := &model.Recipe{ID: vars["id"]}
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&recipe); err != nil {
-		util.ResponseWithError(w, http.StatusBadRequest, "Invalid resquest payload")
+	id := (model.ID)(vars["id"])
+	recipe, err := id.GetRecipe(app.DB)
+	if err == nil {
+		err = checkOwner(r.Context(), recipe)
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
 
-	defer r.Body.Close()
-	if err := recipe.UpdateRecipe(app.DB); err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+	// fields missing from payload keep their stored value, the version is never taken from the payload
+	current := recipe.Version
+	if !app.decodeRecipe(w, r, recipe) {
+		return
+	}
+
+	recipe.ID = vars["id"]
+	if version > 0 && version != current {
+		util.ResponseWithDomainError(w, r, model.ErrVersionConflict)
+		return
+	}
+	// patch is applied on the version just read, so a concurrent update is still detected
+	recipe.Version = current
+	app.saveRecipe(w, r, recipe)
+}
+
+// saveRecipe update recipe and write the new representation
+func (app *App) saveRecipe(w http.ResponseWriter, r *http.Request, recipe *model.Recipe) {
+	authoredBy(r.Context(), recipe)
+	if err := recipe.UpdateRecipe(r.Context(), app.DB); err != nil {
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
 
-	util.ResponseWithJSON(w, http.StatusOK, recipe)
+	util.RenderVersion(w, r, http.StatusOK, recipe, recipe.Version)
+}
+
+// authoredBy set the principal of ctx as author of the next write of recipe, payload values are overwritten
+func authoredBy(ctx context.Context, recipe *model.Recipe) {
+	if principal := util.PrincipalFrom(ctx); principal != nil {
+		recipe.AuthoredBy(principal.ID)
+		return
+	}
+	recipe.AuthoredBy("")
+}
+
+// checkOwner ErrNotOwner unless the principal of ctx may change the stored recipe
+// only principals with util.PermissionWriteAny may change recipes created by others
+func checkOwner(ctx context.Context, stored *model.Recipe) error {
+	principal := util.PrincipalFrom(ctx)
+	if principal.Can(util.PermissionWriteAny) || (principal != nil && stored.OwnedBy(principal.ID)) {
+		return nil
+	}
+	return model.ErrNotOwner
+}
+
+// checkOwnerOf checkOwner of the recipe with id, the recipe is only read when the principal is restricted to own recipes
+// the owner of a recipe never changes, so the check holds for the following update
+func (app *App) checkOwnerOf(ctx context.Context, id model.ID) error {
+	if util.PrincipalFrom(ctx).Can(util.PermissionWriteAny) {
+		return nil
+	}
+
+	stored, err := id.GetRecipe(app.DB)
+	if err != nil {
+		return err
+	}
+	return checkOwner(ctx, stored)
+}
+
+// upsertOwner owner an upsert of the principal of ctx is restricted to, empty if it may update every recipe
+// the restriction is applied by the upsert itself, so a recipe of another user created meanwhile is never overwritten
+// principals without id own no recipe and get ErrNotOwner
+func upsertOwner(ctx context.Context) (string, error) {
+	principal := util.PrincipalFrom(ctx)
+	if principal.Can(util.PermissionWriteAny) {
+		return "", nil
+	}
+	if principal == nil || principal.ID == "" {
+		return "", model.ErrNotOwner
+	}
+	return principal.ID, nil
 }
 
 // deleteRecipe DELETE /recipes/{id}
 func (app *App) deleteRecipe(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	id := (model.ID)(vars["id"])
-	if err := id.DeleteRecipe(app.DB); err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+	if err := id.DeleteRecipe(r.Context(), app.DB, version); err != nil {
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
 
-	util.ResponseWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	util.Render(w, r, http.StatusOK, map[string]string{"result": "success"})
 }
 
 // rateRecipe PUT /recipes/{id}/rate
@@ -208,16 +607,16 @@ func (app *App) rateRecipe(w http.ResponseWriter, r *http.Request) {
 	id := (model.ID)(vars["id"])
 	rate, err := strconv.Atoi(vars["rate"])
 	if err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid rate")
 		return
 	}
 
-	if err := id.RateRecipe(app.DB, rate); err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+	if err := id.RateRecipe(r.Context(), app.DB, rate); err != nil {
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
 
-	util.ResponseWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
+	util.Render(w, r, http.StatusOK, map[string]string{"result": "success"})
 }
 
 // searchRecipes GET /recipes/search/{name}
@@ -225,15 +624,103 @@ func (app *App) searchRecipes(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	search := vars["search"]
 	if search == "" {
-		util.ResponseWithError(w, http.StatusInternalServerError, "No search pattern")
+		util.ResponseWithError(w, r, http.StatusBadRequest, "No search pattern")
 		return
 	}
 
 	recipe := &model.Recipe{}
 	recipes, err := recipe.SearchRecipes(app.DB, search)
 	if err != nil {
-		util.ResponseWithError(w, http.StatusInternalServerError, err.Error())
+		util.ResponseWithDomainError(w, r, err)
 		return
 	}
-	util.ResponseWithJSON(w, http.StatusOK, recipes)
+
+	app.responseWithRecipes(w, r, recipes)
+}
+
+// responseWithRecipes write recipe list with a weak ETag of its representation
+func (app *App) responseWithRecipes(w http.ResponseWriter, r *http.Request, recipes []*model.Recipe) {
+	// empty pages are [] rather than null, as documented
+	if recipes == nil {
+		recipes = []*model.Recipe{}
+	}
+	if util.Preferred(r, halMediaType) == halMediaType {
+		app.responseWithHAL(w, r, app.recipeCollection(r, recipes), 0)
+		return
+	}
+
+	util.RenderContent(w, r, http.StatusOK, model.Recipes(recipes))
+}
+
+// expectedVersion version required by If-Match, 0 if the update is unconditional or If-Match is "*"
+// writes the error response and returns false when the precondition can not be evaluated or fails
+func (app *App) expectedVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	versions, present, err := util.IfMatchVersions(r)
+	if err != nil {
+		util.ResponseWithError(w, r, http.StatusPreconditionFailed, err.Error())
+		return 0, false
+	}
+
+	if !present && app.Config.ConcurrencyConfig.RequireIfMatch {
+		util.ResponseWithError(w, r, http.StatusPreconditionRequired, "If-Match header required")
+		return 0, false
+	}
+
+	switch len(versions) {
+	case 0:
+		return 0, true
+	case 1:
+		return versions[0], true
+	}
+
+	// a list matches when the stored version is one of its tags, the write is then conditional on that version
+	id := (model.ID)(mux.Vars(r)["id"])
+	stored, err := id.GetRecipe(app.DB)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return 0, false
+	}
+	for _, version := range versions {
+		if version == stored.Version {
+			return version, true
+		}
+	}
+	util.ResponseWithDomainError(w, r, model.ErrVersionConflict)
+	return 0, false
+}
+
+// decodeRecipe decode and validate request body into recipe
+// writes the error response and returns false when the payload is invalid
+func (app *App) decodeRecipe(w http.ResponseWriter, r *http.Request, recipe *model.Recipe) bool {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err == nil {
+		err = model.DecodeRecipe(body, recipe)
+	}
+	if err == nil {
+		err = recipe.Validate()
+	}
+
+	switch err.(type) {
+	case nil:
+		return true
+	case *model.ValidationError:
+		util.ResponseWithDomainError(w, r, err)
+	default:
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+	}
+	return false
+}
+
+// prefixFieldErrors field errors of a nested payload, non validation errors are reported on the prefix itself
+func prefixFieldErrors(prefix string, err error) []*model.FieldError {
+	validationError, ok := err.(*model.ValidationError)
+	if !ok {
+		return []*model.FieldError{{Field: strings.TrimSuffix(prefix, "."), Code: "invalid_json", Message: err.Error()}}
+	}
+
+	for _, fieldError := range validationError.Fields {
+		fieldError.Field = prefix + fieldError.Field
+	}
+	return validationError.Fields
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"hellofresh/model"
+	"hellofresh/util"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// getRecipeAudit GET /recipes/{id}/audit
+// entries are recorded under the canonical id, so /recipes/007/audit lists those of recipe 7
+func (app *App) getRecipeAudit(w http.ResponseWriter, r *http.Request) {
+	id := (model.ID)(mux.Vars(r)["id"])
+	canonical, err := id.Canonical()
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+	app.responseWithAudit(w, r, &model.AuditFilter{RecipeID: string(canonical)})
+}
+
+// getAudit GET /audit
+func (app *App) getAudit(w http.ResponseWriter, r *http.Request) {
+	filter := &model.AuditFilter{User: r.URL.Query().Get("user"), Action: r.URL.Query().Get("action")}
+	if since := r.URL.Query().Get("since"); since != "" {
+		var err error
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			util.ResponseWithError(w, r, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+	}
+
+	app.responseWithAudit(w, r, filter)
+}
+
+// responseWithAudit write the page of audit entries matching filter
+func (app *App) responseWithAudit(w http.ResponseWriter, r *http.Request, filter *model.AuditFilter) {
+	offset, limit, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := model.GetAuditEntries(app.DB, filter, offset, limit)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.Render(w, r, http.StatusOK, entries)
+}
+
+// authAuditor util.AuthAuditor appending failed authentications to the audit log in the database
+type authAuditor struct {
+	db interface{}
+}
+
+// AuditAuthFailure append failure to the audit log
+func (auditor *authAuditor) AuditAuthFailure(failure *util.AuthFailure) error {
+	return model.AppendAuthFailure(auditor.db, failure)
+}
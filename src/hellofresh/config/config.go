@@ -3,10 +3,26 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
 	"path"
+	"strings"
 )
 
+// placeholders secrets shipped in config.json for local development, never accepted in production
+var placeholders = []string{"hellofresh", "change-me", "secret", "password"}
+
+// IsPlaceholder secret is one of the example values of config.json, such as "change-me" or "change-me-to-..."
+func IsPlaceholder(secret string) bool {
+	secret = strings.ToLower(strings.TrimSpace(secret))
+	for _, placeholder := range placeholders {
+		if secret == placeholder || strings.HasPrefix(secret, placeholder+"-") {
+			return true
+		}
+	}
+	return false
+}
+
 // GetConfig get config defined in config.json
 func GetConfig() (config *Config, err error) {
 	configpath := path.Join(os.Getenv("GOPATH"), "src", "hellofresh", "config.json")
@@ -43,13 +59,156 @@ type DBConfig struct {
 
 // AuthConfig auth config
 type AuthConfig struct {
-	Type     string `json:"type"`
+	Type string `json:"type"`
+	// UserName and Password admin account created on first start, the only account when there is no database
 	UserName string `json:"username"`
 	Password string `json:"password"`
+	// Registration allow anyone to create an account with POST /users/register
+	Registration bool `json:"registration"`
+	// JWT token settings of type "jwt"
+	JWT JWTConfig `json:"jwt"`
+	// OAuth2 token introspection settings of type "oauth2"
+	OAuth2 OAuth2Config `json:"oauth2"`
+	// Lockout brute-force protection of password logins
+	Lockout LockoutConfig `json:"lockout"`
+	// Signing HMAC signed requests of partners, accepted besides the credentials of the auth type
+	Signing SigningConfig `json:"signing"`
+}
+
+// SigningConfig HMAC-SHA256 request signing of partner integrations, disabled without partners
+type SigningConfig struct {
+	// Partners partners allowed to sign requests, each with its own secret
+	Partners []SigningPartner `json:"partners"`
+	// MaxSkew accepted difference between the timestamp of a request and the server clock, default "5m"
+	MaxSkew string `json:"maxSkew"`
+	// MaxBodySize largest body of a signed request in bytes, read before the signature is checked, default 1048576
+	MaxBodySize int64 `json:"maxBodySize"`
+}
+
+// SigningPartner partner signing requests with Secret
+type SigningPartner struct {
+	// ID keyId of the signatures of the partner
+	ID string `json:"id"`
+	// Secret shared HMAC secret, at least 32 bytes
+	Secret string `json:"secret"`
+	// Scopes permissions of the signed requests of the partner
+	Scopes []string `json:"scopes"`
+}
+
+// OAuth2Config RFC 7662 introspection of the opaque access tokens of an identity provider
+type OAuth2Config struct {
+	// IntrospectionURL introspection endpoint of the identity provider
+	IntrospectionURL string `json:"introspectionURL"`
+	// ClientID and ClientSecret credentials of this API at the identity provider
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// Audience aud tokens must be issued for, not checked when empty
+	Audience string `json:"audience"`
+	// CacheTTL how long introspection results are reused, never beyond the expiry of the token, default "1m"
+	CacheTTL string `json:"cacheTTL"`
+	// Timeout of introspection requests, default "5s"
+	Timeout string `json:"timeout"`
+}
+
+// LockoutConfig failed password logins tolerated per username and per client IP, zero values take the defaults
+type LockoutConfig struct {
+	// FreeAttempts failed logins of a username answered without delay, default 3
+	FreeAttempts int `json:"freeAttempts"`
+	// Threshold failed logins locking a username out, default 10
+	Threshold int `json:"threshold"`
+	// IPFreeAttempts failed logins from a client IP answered without delay, higher as clients share IPs, default 10
+	IPFreeAttempts int `json:"ipFreeAttempts"`
+	// IPThreshold failed logins locking a client IP out, default 50
+	IPThreshold int `json:"ipThreshold"`
+	// BaseDelay delay after the first failure beyond the free attempts, doubled by each further failure, default "1s"
+	BaseDelay string `json:"baseDelay"`
+	// MaxDelay longest delay before the threshold is reached, default "1m"
+	MaxDelay string `json:"maxDelay"`
+	// Duration of a lockout, failures are also forgotten after that long without any, default "15m"
+	Duration string `json:"duration"`
+}
+
+// JWTConfig signing and lifetime of the tokens issued by POST /auth/token
+type JWTConfig struct {
+	// Issuer iss claim of issued tokens, tokens of other issuers are rejected
+	Issuer string `json:"issuer"`
+	// SigningKey kid of the key new tokens are signed with
+	SigningKey string `json:"signingKey"`
+	// Keys keys tokens are verified with, retired keys stay listed until their tokens expired
+	Keys []JWTKey `json:"keys"`
+	// AccessTTL lifetime of access tokens, e.g. "15m"
+	AccessTTL string `json:"accessTTL"`
+	// RefreshTTL lifetime of refresh tokens, e.g. "720h"
+	RefreshTTL string `json:"refreshTTL"`
+}
+
+// JWTKey key identified by the kid header of tokens
+type JWTKey struct {
+	ID string `json:"kid"`
+	// Algorithm HS256 or RS256
+	Algorithm string `json:"alg"`
+	// Secret shared secret of HS256, at least 32 bytes
+	Secret string `json:"secret"`
+	// PrivateKeyFile PEM file of the RS256 private key, only needed to sign
+	PrivateKeyFile string `json:"privateKeyFile"`
+	// PublicKeyFile PEM file of the RS256 public key, enough to verify
+	PublicKeyFile string `json:"publicKeyFile"`
+}
+
+// ConcurrencyConfig optimistic concurrency config
+type ConcurrencyConfig struct {
+	// RequireIfMatch reject updates and deletes without If-Match header
+	RequireIfMatch bool `json:"requireIfMatch"`
+}
+
+// BatchConfig batch endpoint config
+type BatchConfig struct {
+	// MaxSize maximum number of operations in a single batch
+	MaxSize int `json:"maxSize"`
+}
+
+// VersioningConfig API versions config
+type VersioningConfig struct {
+	// V1Sunset RFC 3339 date after which /v1 may be removed, sent in the Sunset header
+	V1Sunset string `json:"v1Sunset"`
+}
+
+// GRPCConfig gRPC server config
+type GRPCConfig struct {
+	// Addr address the gRPC server listens on, e.g. ":9090", the server is not started when empty
+	Addr string `json:"addr"`
+}
+
+// RatingConfig ratings config
+type RatingConfig struct {
+	// Anonymous let callers without credentials rate, one rate per recipe and client fingerprint
+	Anonymous bool `json:"anonymous"`
+	// FingerprintSalt secret the IP address and user agent of anonymous raters are hashed with
+	FingerprintSalt string `json:"fingerprintSalt"`
+}
+
+// Validate anonymous ratings need a real salt, with a known one the fingerprints can be reversed by trying IP addresses
+func (ratings RatingConfig) Validate() error {
+	if ratings.Anonymous && (ratings.FingerprintSalt == "" || IsPlaceholder(ratings.FingerprintSalt)) {
+		return errors.New("ratings.fingerprintSalt must be set to a random secret when ratings.anonymous is enabled")
+	}
+	return nil
 }
 
 // Config config entry
 type Config struct {
-	DBConfig   `json:"db"`
-	AuthConfig `json:"auth"`
+	DBConfig          `json:"db"`
+	AuthConfig        `json:"auth"`
+	ConcurrencyConfig `json:"concurrency"`
+	BatchConfig       `json:"batch"`
+	VersioningConfig  `json:"versioning"`
+	GRPCConfig        `json:"grpc"`
+	RatingConfig      `json:"ratings"`
+
+	// BaseURL public URL of the service, e.g. "https://recipes.example.com", absolute links of documents start with it
+	BaseURL string `json:"baseURL"`
+	// MaxBodySize largest JSON request body in bytes, buffered to be validated or hashed for Idempotency-Key, default 1048576
+	MaxBodySize int64 `json:"maxBodySize"`
+	// TrustedProxies IP addresses or CIDR networks of the reverse proxies whose X-Forwarded-For header gives the client IP
+	TrustedProxies []string `json:"trustedProxies"`
 }
@@ -0,0 +1,27 @@
+module hellofresh
+
+go 1.25.0
+
+require (
+	github.com/gorilla/mux v1.8.1
+	github.com/graphql-go/graphql v0.8.1
+	github.com/lib/pq v1.9.0
+	github.com/onsi/ginkgo v1.16.5
+	github.com/onsi/gomega v1.41.0
+	golang.org/x/crypto v0.54.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260120221211-b8f7ae30c516
+	google.golang.org/grpc v1.80.0
+	google.golang.org/protobuf v1.36.11
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/google/go-cmp v0.7.0 // indirect
+	github.com/nxadm/tail v1.4.8 // indirect
+	go.yaml.in/yaml/v3 v3.0.4 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+	golang.org/x/text v0.40.0 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
+)
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hellofresh/model"
+	"hellofresh/util"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// graphQLRequest payload of POST /graphql
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// graphQLContextKey key of per request values in the resolver context
+type graphQLContextKey int
+
+const (
+	// ratingsKey rating loader of the request
+	ratingsKey graphQLContextKey = iota
+)
+
+// graphQLError domain error reported in the errors of a GraphQL response
+// extensions carry the code, status and field errors of its problem details
+type graphQLError struct {
+	problem *util.Problem
+}
+
+// Error problem detail
+func (err *graphQLError) Error() string {
+	return err.problem.Detail
+}
+
+// Extensions problem code, status and field errors
+func (err *graphQLError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": err.problem.Code, "status": err.problem.Status}
+	if err.problem.Errors != nil {
+		extensions["errors"] = err.problem.Errors
+	}
+	return extensions
+}
+
+// resolverError report err like ResponseWithDomainError does, unexpected errors are logged and not leaked
+func resolverError(err error) error {
+	if problemError, ok := err.(util.ProblemError); ok {
+		return &graphQLError{problem: problemError.Problem()}
+	}
+
+	log.Printf("POST /graphql: %v", err)
+	return &graphQLError{problem: util.NewProblem(http.StatusInternalServerError, "", "Unexpected error")}
+}
+
+// errNotAuthorized mutation without valid credentials
+var errNotAuthorized = &graphQLError{problem: util.NewProblem(http.StatusUnauthorized, "", "Not authorized")}
+
+// difficultyEnum recipe difficulty
+var difficultyEnum = graphql.NewEnum(graphql.EnumConfig{
+	Name: "Difficulty",
+	Values: graphql.EnumValueConfigMap{
+		"EASY":   &graphql.EnumValueConfig{Value: model.Easy},
+		"NORMAL": &graphql.EnumValueConfig{Value: model.Normal},
+		"HARD":   &graphql.EnumValueConfig{Value: model.Hard},
+	},
+})
+
+// ratingSummaryType average and number of rates
+var ratingSummaryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RatingSummary",
+	Fields: graphql.Fields{
+		"average": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		"count":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+	},
+})
+
+// ratingType single rate of a recipe
+var ratingType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Rating",
+	Fields: graphql.Fields{
+		"rate":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"user":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"modified": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+	},
+})
+
+// recipeType recipe, ratings of every recipe in a response are loaded in one batch
+var recipeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Recipe",
+	Fields: graphql.Fields{
+		"id": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.ID),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return string(p.Source.(*model.Recipe).RecipeID()), nil
+			},
+		},
+		"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"prep":        &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		"difficulty":  &graphql.Field{Type: graphql.NewNonNull(difficultyEnum)},
+		"vegetarian":  &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"version":     &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"externalId":  &graphql.Field{Type: graphql.String},
+		"prepMinutes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"cookMinutes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"totalMinutes": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.Int),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				recipe := p.Source.(*model.Recipe)
+				return recipe.PrepMinutes + recipe.CookMinutes, nil
+			},
+		},
+		"ingredients": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if ingredients := p.Source.(*model.Recipe).Ingredients; ingredients != nil {
+					return ingredients, nil
+				}
+				return []string{}, nil
+			},
+		},
+		"rating": &graphql.Field{
+			Type: graphql.NewNonNull(ratingSummaryType),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loadRatings(p, func(rates []*model.RecipeRate) interface{} {
+					return model.NewRatingSummary(rates)
+				}), nil
+			},
+		},
+		"ratings": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(ratingType))),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loadRatings(p, func(rates []*model.RecipeRate) interface{} {
+					return rates
+				}), nil
+			},
+		},
+	},
+})
+
+// recipePageType page of the recipes query, hasNext is true when the page is full
+var recipePageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "RecipePage",
+	Fields: graphql.Fields{
+		"items":   &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(recipeType)))},
+		"offset":  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"limit":   &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"hasNext": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+	},
+})
+
+// recipeFilterInput filters of the recipes query
+var recipeFilterInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "RecipeFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"vegetarian":      &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"difficulty":      &graphql.InputObjectFieldConfig{Type: difficultyEnum},
+		"maxTotalMinutes": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"name":            &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "Case insensitive part of the name"},
+	},
+})
+
+// recipeInput recipe of createRecipe and updateRecipe
+var recipeInput = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "RecipeInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":        &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"prep":        &graphql.InputObjectFieldConfig{Type: graphql.DateTime},
+		"difficulty":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(difficultyEnum)},
+		"vegetarian":  &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"externalId":  &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"prepMinutes": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"cookMinutes": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		"ingredients": &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+	},
+})
+
+// newGraphQLSchema schema of /graphql resolving against the app database
+// queries are public, mutations require the credentials of util.RequireAuth
+func (app *App) newGraphQLSchema() (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"recipe": &graphql.Field{
+				Type: recipeType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: app.resolveRecipe,
+			},
+			"recipes": &graphql.Field{
+				Type: graphql.NewNonNull(recipePageType),
+				Args: graphql.FieldConfigArgument{
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"filter": &graphql.ArgumentConfig{Type: recipeFilterInput},
+				},
+				Resolve: app.resolveRecipes,
+			},
+			"search": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(recipeType))),
+				Args: graphql.FieldConfigArgument{
+					"pattern": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: app.resolveSearch,
+			},
+			"ratingSummary": &graphql.Field{
+				Type: ratingSummaryType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: app.resolveRatingSummary,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createRecipe": &graphql.Field{
+				Type: graphql.NewNonNull(recipeType),
+				Args: graphql.FieldConfigArgument{
+					"recipe": &graphql.ArgumentConfig{Type: graphql.NewNonNull(recipeInput)},
+				},
+				Resolve: authorized(util.PermissionWrite, app.resolveCreateRecipe),
+			},
+			"updateRecipe": &graphql.Field{
+				Type: graphql.NewNonNull(recipeType),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"version": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Expected version, like If-Match"},
+					"recipe":  &graphql.ArgumentConfig{Type: graphql.NewNonNull(recipeInput)},
+				},
+				Resolve: authorized(util.PermissionWrite, app.resolveUpdateRecipe),
+			},
+			"deleteRecipe": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"version": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Expected version, like If-Match"},
+				},
+				Resolve: authorized(util.PermissionDelete, app.resolveDeleteRecipe),
+			},
+			"rateRecipe": &graphql.Field{
+				Type: graphql.NewNonNull(ratingSummaryType),
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"rate": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: authorizedRater(app.resolveRateRecipe),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// postGraphQL POST /graphql
+// errors are reported in the errors of the response, which is 200 whenever the request could be executed
+func (app *App) postGraphQL(w http.ResponseWriter, r *http.Request) {
+	// authenticated first, signed requests need the body they were signed with
+	principal, err := util.Authenticate(r)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	var request graphQLRequest
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+	ctx := util.WithClientIP(util.WithPrincipal(r.Context(), principal), util.ClientIP(r))
+	if principal == nil && app.anonymousRatings() {
+		ctx = util.WithFingerprint(ctx, util.Fingerprint(r, app.Config.RatingConfig.FingerprintSalt))
+	}
+	ctx = context.WithValue(ctx, ratingsKey, app.ratingLoader())
+
+	result := graphql.Do(graphql.Params{
+		Schema:         app.graphQLSchema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        ctx,
+	})
+	util.ResponseWithJSON(w, http.StatusOK, result)
+}
+
+// ratingLoader loader fetching ratings of all recipes of a request level in one accessor call
+func (app *App) ratingLoader() *util.Loader {
+	return util.NewLoader(func(keys []string) (map[string]interface{}, error) {
+		ids := make([]model.ID, len(keys))
+		for i, key := range keys {
+			ids[i] = model.ID(key)
+		}
+
+		recipe := &model.Recipe{}
+		ratings, err := recipe.GetRatingsOf(app.DB, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		results := map[string]interface{}{}
+		for id, rates := range ratings {
+			results[string(id)] = rates
+		}
+		return results, nil
+	})
+}
+
+// loadRatings queue ratings of the source recipe and resolve them through fn once the batch is fetched
+func loadRatings(p graphql.ResolveParams, fn func([]*model.RecipeRate) interface{}) func() (interface{}, error) {
+	thunk := p.Context.Value(ratingsKey).(*util.Loader).Load(string(p.Source.(*model.Recipe).RecipeID()))
+	return func() (interface{}, error) {
+		rates, err := thunk()
+		if err != nil {
+			return nil, resolverError(err)
+		}
+		ratings, _ := rates.([]*model.RecipeRate)
+		if ratings == nil {
+			ratings = []*model.RecipeRate{}
+		}
+		return fn(ratings), nil
+	}
+}
+
+// authorized guard resolve with the credentials of util.RequireAuth and the permission of util.RequirePermission
+func authorized(permission string, resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		principal := util.PrincipalFrom(p.Context)
+		if principal == nil {
+			return nil, errNotAuthorized
+		}
+		if !principal.Can(permission) {
+			return nil, &graphQLError{problem: util.NewProblem(http.StatusForbidden, "", "Permission "+permission+" required")}
+		}
+		return resolve(p)
+	}
+}
+
+// authorizedRater guard rateRecipe like authorized with the rate permission
+// callers without credentials rate with the fingerprint of their client when ratings.anonymous is enabled, as RequireRater does
+func authorizedRater(resolve graphql.FieldResolveFn) graphql.FieldResolveFn {
+	guarded := authorized(util.PermissionRate, resolve)
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if util.PrincipalFrom(p.Context) == nil && util.FingerprintFrom(p.Context) != "" {
+			return resolve(p)
+		}
+		return guarded(p)
+	}
+}
+
+// resolveRecipe query recipe(id)
+func (app *App) resolveRecipe(p graphql.ResolveParams) (interface{}, error) {
+	id := model.ID(p.Args["id"].(string))
+	recipe, err := id.GetRecipe(app.DB)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	return recipe, nil
+}
+
+// resolveRecipes query recipes(offset, limit, filter)
+func (app *App) resolveRecipes(p graphql.ResolveParams) (interface{}, error) {
+	offset, limit := p.Args["offset"].(int), p.Args["limit"].(int)
+	if offset < 0 || limit < 1 || limit > maxPageSize {
+		return nil, resolverError(&model.ValidationError{Message: "Invalid pagination", Fields: []*model.FieldError{
+			{Field: "limit", Code: "out_of_range", Message: "Offset must not be negative and limit between 1 and 100"},
+		}})
+	}
+
+	filter := &model.RecipeFilter{}
+	if args, ok := p.Args["filter"].(map[string]interface{}); ok {
+		if vegetarian, ok := args["vegetarian"].(bool); ok {
+			filter.Vegetarian = &vegetarian
+		}
+		filter.Difficulty, _ = args["difficulty"].(model.Difficulty)
+		filter.MaxTotalMinutes, _ = args["maxTotalMinutes"].(int)
+		filter.Name, _ = args["name"].(string)
+	}
+
+	recipe := &model.Recipe{}
+	recipes, err := recipe.FindRecipes(app.DB, filter, offset, limit)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	if recipes == nil {
+		recipes = []*model.Recipe{}
+	}
+	return map[string]interface{}{"items": recipes, "offset": offset, "limit": limit, "hasNext": len(recipes) == limit}, nil
+}
+
+// resolveSearch query search(pattern)
+func (app *App) resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	recipe := &model.Recipe{}
+	recipes, err := recipe.SearchRecipes(app.DB, p.Args["pattern"].(string))
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	if recipes == nil {
+		recipes = []*model.Recipe{}
+	}
+	return recipes, nil
+}
+
+// resolveRatingSummary query ratingSummary(id)
+func (app *App) resolveRatingSummary(p graphql.ResolveParams) (interface{}, error) {
+	id := model.ID(p.Args["id"].(string))
+	if _, err := id.GetRecipe(app.DB); err != nil {
+		return nil, resolverError(err)
+	}
+
+	rates, err := id.GetRatings(app.DB)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	return model.NewRatingSummary(rates), nil
+}
+
+// resolveCreateRecipe mutation createRecipe(recipe)
+func (app *App) resolveCreateRecipe(p graphql.ResolveParams) (interface{}, error) {
+	recipe, err := recipeFromInput(p.Args["recipe"].(map[string]interface{}))
+	if err != nil {
+		return nil, resolverError(err)
+	}
+
+	authoredBy(p.Context, recipe)
+	if err := recipe.CreateRecipe(p.Context, app.DB); err != nil {
+		return nil, resolverError(err)
+	}
+	return recipe, nil
+}
+
+// resolveUpdateRecipe mutation updateRecipe(id, version, recipe)
+func (app *App) resolveUpdateRecipe(p graphql.ResolveParams) (interface{}, error) {
+	version, err := app.mutationVersion(p)
+	if err != nil {
+		return nil, err
+	}
+
+	id := model.ID(p.Args["id"].(string))
+	if _, err := id.Parse(); err != nil {
+		return nil, resolverError(err)
+	}
+	if err := app.checkOwnerOf(p.Context, id); err != nil {
+		return nil, resolverError(err)
+	}
+
+	recipe, err := recipeFromInput(p.Args["recipe"].(map[string]interface{}))
+	if err != nil {
+		return nil, resolverError(err)
+	}
+
+	recipe.ID = string(id)
+	recipe.Version = version
+	authoredBy(p.Context, recipe)
+	if err := recipe.UpdateRecipe(p.Context, app.DB); err != nil {
+		return nil, resolverError(err)
+	}
+	return recipe, nil
+}
+
+// resolveDeleteRecipe mutation deleteRecipe(id, version)
+func (app *App) resolveDeleteRecipe(p graphql.ResolveParams) (interface{}, error) {
+	version, err := app.mutationVersion(p)
+	if err != nil {
+		return nil, err
+	}
+
+	id := model.ID(p.Args["id"].(string))
+	if err := id.DeleteRecipe(p.Context, app.DB, version); err != nil {
+		return nil, resolverError(err)
+	}
+	return true, nil
+}
+
+// resolveRateRecipe mutation rateRecipe(id, rate)
+func (app *App) resolveRateRecipe(p graphql.ResolveParams) (interface{}, error) {
+	rate := p.Args["rate"].(int)
+	if rate < 1 || rate > 5 {
+		return nil, resolverError(&model.ValidationError{Message: "Invalid rate", Fields: []*model.FieldError{
+			{Field: "rate", Code: "out_of_range", Message: "Rate must be between 1 and 5"},
+		}})
+	}
+
+	id := model.ID(p.Args["id"].(string))
+	if err := id.RateRecipe(p.Context, app.DB, rate); err != nil {
+		return nil, resolverError(err)
+	}
+
+	rates, err := id.GetRatings(app.DB)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	return model.NewRatingSummary(rates), nil
+}
+
+// mutationVersion version argument of a mutation, required when If-Match is required for REST updates
+func (app *App) mutationVersion(p graphql.ResolveParams) (int, error) {
+	version, present := p.Args["version"].(int)
+	if !present && app.Config != nil && app.Config.ConcurrencyConfig.RequireIfMatch {
+		return 0, &graphQLError{problem: util.NewProblem(http.StatusPreconditionRequired, "", "version argument required")}
+	}
+	return version, nil
+}
+
+// recipeFromInput map RecipeInput to a validated recipe, field errors are prefixed with recipe.
+func recipeFromInput(input map[string]interface{}) (*model.Recipe, error) {
+	recipe := &model.Recipe{}
+	recipe.Name, _ = input["name"].(string)
+	recipe.Prep, _ = input["prep"].(time.Time)
+	recipe.Difficulty, _ = input["difficulty"].(model.Difficulty)
+	recipe.Vegetarian, _ = input["vegetarian"].(bool)
+	recipe.ExternalID, _ = input["externalId"].(string)
+	recipe.PrepMinutes, _ = input["prepMinutes"].(int)
+	recipe.CookMinutes, _ = input["cookMinutes"].(int)
+	if ingredients, ok := input["ingredients"].([]interface{}); ok {
+		recipe.Ingredients = make([]string, len(ingredients))
+		for i, ingredient := range ingredients {
+			recipe.Ingredients[i], _ = ingredient.(string)
+		}
+	}
+
+	if err := recipe.Validate(); err != nil {
+		return nil, &model.ValidationError{Message: "Invalid recipe", Fields: prefixFieldErrors("recipe.", err)}
+	}
+	return recipe, nil
+}
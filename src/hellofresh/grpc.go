@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"hellofresh/model"
+	"hellofresh/recipepb"
+	"hellofresh/util"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcProtectedMethods permission required by methods, like their REST routes
+var grpcProtectedMethods = map[string]string{
+	recipepb.RecipeService_Create_FullMethodName: util.PermissionWrite,
+	recipepb.RecipeService_Update_FullMethodName: util.PermissionWrite,
+	recipepb.RecipeService_Delete_FullMethodName: util.PermissionDelete,
+	recipepb.RecipeService_Rate_FullMethodName:   util.PermissionRate,
+	recipepb.RecipeService_Export_FullMethodName: util.PermissionExport,
+}
+
+// grpcFieldNames protobuf names of recipe fields, used to report validation errors in protobuf terms
+var grpcFieldNames = map[string]string{
+	"externalId":  "external_id",
+	"prepMinutes": "prep_minutes",
+	"cookMinutes": "cook_minutes",
+}
+
+// recipeServer RecipeService on top of the accessor layer
+type recipeServer struct {
+	recipepb.UnimplementedRecipeServiceServer
+	app *App
+}
+
+// NewGRPCServer gRPC server of RecipeService with auth and panic recovery
+func (app *App) NewGRPCServer() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(unaryInterceptor), grpc.StreamInterceptor(streamInterceptor))
+	recipepb.RegisterRecipeServiceServer(server, &recipeServer{app: app})
+	return server
+}
+
+// RunGRPC serve RecipeService on addr, separately from the HTTP server of Run
+func (app *App) RunGRPC(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Fatal(app.NewGRPCServer().Serve(listener))
+}
+
+// unaryInterceptor check credentials of protected methods and turn panics into Internal errors
+func unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer recoverGRPC(info.FullMethod, &err)
+
+	ctx, err = authenticateGRPC(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// streamInterceptor streaming counterpart of unaryInterceptor
+func streamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverGRPC(info.FullMethod, &err)
+
+	ctx, err := authenticateGRPC(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &principalStream{ServerStream: stream, ctx: ctx})
+}
+
+// principalStream server stream whose context carries the authenticated principal
+type principalStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context context of the stream with the principal
+func (stream *principalStream) Context() context.Context {
+	return stream.ctx
+}
+
+// recoverGRPC log a panic of method and report it as Internal, like util.Recover
+func recoverGRPC(method string, err *error) {
+	if recovered := recover(); recovered != nil {
+		log.Printf("panic serving %s: %v\n%s", method, recovered, debug.Stack())
+		*err = status.Error(codes.Internal, "Unexpected error")
+	}
+}
+
+// authenticateGRPC attach the principal of the API key or authorization metadata to ctx
+// protected methods fail with Unauthenticated without valid credentials and with PermissionDenied without their permission
+func authenticateGRPC(ctx context.Context, method string) (context.Context, error) {
+	var principal *util.Principal
+	var err error
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(strings.ToLower(util.APIKeyHeader)); len(keys) > 0 {
+		// like the X-API-Key header, an invalid key is not made up for by the authorization metadata
+		principal, err = util.AuthenticateAPIKey(keys[0], grpcClientIP(ctx))
+	} else if authorizations := md.Get("authorization"); len(authorizations) > 0 {
+		principal, err = util.AuthenticateHeader(authorizations[0], grpcClientIP(ctx))
+	}
+	if err != nil {
+		return ctx, grpcError(err)
+	}
+	if principal != nil {
+		ctx = util.WithPrincipal(ctx, principal)
+	}
+	ctx = util.WithClientIP(ctx, grpcClientIP(ctx))
+
+	permission, protected := grpcProtectedMethods[method]
+	switch {
+	case !protected:
+		return ctx, nil
+	case principal == nil:
+		return ctx, status.Error(codes.Unauthenticated, "Not authorized")
+	case !principal.Can(permission):
+		return ctx, status.Error(codes.PermissionDenied, "Permission "+permission+" required")
+	}
+	return ctx, nil
+}
+
+// grpcClientIP IP address of the peer of ctx, empty if unknown
+func grpcClientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return util.ForwardedClientIP(p.Addr.String(), md.Get("x-forwarded-for"))
+}
+
+// grpcError status of err, problem statuses map to the closest code and field errors to BadRequest details
+// errors which do not implement ProblemError are logged and reported as Internal without leaking their message
+func grpcError(err error) error {
+	problemError, ok := err.(util.ProblemError)
+	if !ok {
+		log.Printf("gRPC: %v", err)
+		return status.Error(codes.Internal, "Unexpected error")
+	}
+
+	problem := problemError.Problem()
+	st := status.New(grpcCode(problem.Status), problem.Detail)
+	if fieldErrors, ok := problem.Errors.([]*model.FieldError); ok {
+		badRequest := &errdetails.BadRequest{}
+		for _, fieldError := range fieldErrors {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field: fieldError.Field, Reason: fieldError.Code, Description: fieldError.Message,
+			})
+		}
+		if detailed, err := st.WithDetails(badRequest); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// grpcCode gRPC code closest to HTTP status
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed, http.StatusPreconditionRequired:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+// Get get single recipe
+func (server *recipeServer) Get(ctx context.Context, req *recipepb.GetRecipeRequest) (*recipepb.Recipe, error) {
+	id := model.ID(req.Id)
+	recipe, err := id.GetRecipe(server.app.DB)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return recipeToProto(recipe), nil
+}
+
+// List get recipe page, limit defaults to 10
+func (server *recipeServer) List(ctx context.Context, req *recipepb.ListRecipesRequest) (*recipepb.ListRecipesResponse, error) {
+	start, limit := int(req.Start), int(req.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	if start < 0 || limit < 0 || limit > maxPageSize {
+		return nil, status.Error(codes.InvalidArgument, "start must not be negative and limit between 1 and 100")
+	}
+
+	recipe := &model.Recipe{}
+	recipes, err := recipe.GetRecipes(server.app.DB, start, limit)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return recipesToProto(recipes), nil
+}
+
+// Create create recipe
+func (server *recipeServer) Create(ctx context.Context, req *recipepb.CreateRecipeRequest) (*recipepb.Recipe, error) {
+	recipe, err := recipeFromProto(req.Recipe)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	authoredBy(ctx, recipe)
+	if err := recipe.CreateRecipe(ctx, server.app.DB); err != nil {
+		return nil, grpcError(err)
+	}
+	return recipeToProto(recipe), nil
+}
+
+// Update replace recipe identified by recipe.id
+func (server *recipeServer) Update(ctx context.Context, req *recipepb.UpdateRecipeRequest) (*recipepb.Recipe, error) {
+	if err := server.checkExpectedVersion(req.ExpectedVersion); err != nil {
+		return nil, err
+	}
+
+	id := model.ID(req.GetRecipe().GetId())
+	if _, err := id.Parse(); err != nil {
+		return nil, grpcError(err)
+	}
+	if err := server.app.checkOwnerOf(ctx, id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	recipe, err := recipeFromProto(req.Recipe)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	recipe.ID = string(id)
+	recipe.Version = int(req.ExpectedVersion)
+	authoredBy(ctx, recipe)
+	if err := recipe.UpdateRecipe(ctx, server.app.DB); err != nil {
+		return nil, grpcError(err)
+	}
+	return recipeToProto(recipe), nil
+}
+
+// Delete delete recipe
+func (server *recipeServer) Delete(ctx context.Context, req *recipepb.DeleteRecipeRequest) (*recipepb.DeleteRecipeResponse, error) {
+	if err := server.checkExpectedVersion(req.ExpectedVersion); err != nil {
+		return nil, err
+	}
+
+	id := model.ID(req.Id)
+	if err := id.DeleteRecipe(ctx, server.app.DB, int(req.ExpectedVersion)); err != nil {
+		return nil, grpcError(err)
+	}
+	return &recipepb.DeleteRecipeResponse{}, nil
+}
+
+// Rate rate recipe from 1 to 5 and return its rating summary
+func (server *recipeServer) Rate(ctx context.Context, req *recipepb.RateRecipeRequest) (*recipepb.RatingSummary, error) {
+	if req.Rate < 1 || req.Rate > 5 {
+		return nil, grpcError(&model.ValidationError{Message: "Invalid rate", Fields: []*model.FieldError{
+			{Field: "rate", Code: "out_of_range", Message: "Rate must be between 1 and 5"},
+		}})
+	}
+
+	id := model.ID(req.Id)
+	if err := id.RateRecipe(ctx, server.app.DB, int(req.Rate)); err != nil {
+		return nil, grpcError(err)
+	}
+
+	rates, err := id.GetRatings(server.app.DB)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	summary := model.NewRatingSummary(rates)
+	return &recipepb.RatingSummary{Average: summary.Average, Count: int32(summary.Count)}, nil
+}
+
+// Search search recipes by name pattern
+func (server *recipeServer) Search(ctx context.Context, req *recipepb.SearchRecipesRequest) (*recipepb.ListRecipesResponse, error) {
+	if req.Search == "" {
+		return nil, status.Error(codes.InvalidArgument, "No search pattern")
+	}
+
+	recipe := &model.Recipe{}
+	recipes, err := recipe.SearchRecipes(server.app.DB, req.Search)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return recipesToProto(recipes), nil
+}
+
+// Export stream every recipe, with its ratings when requested
+func (server *recipeServer) Export(req *recipepb.ExportRecipesRequest, stream recipepb.RecipeService_ExportServer) error {
+	recipe := &model.Recipe{}
+	batch := make([]*model.Recipe, 0, exportBatchSize)
+	// send send the batch with the ratings of its recipes read in one lookup, as the REST export does
+	send := func() error {
+		ratings := map[model.ID][]*model.RecipeRate{}
+		if req.Ratings && len(batch) > 0 {
+			ids := make([]model.ID, len(batch))
+			for i, recipe := range batch {
+				ids[i] = recipe.RecipeID()
+			}
+			var err error
+			if ratings, err = recipe.GetRatingsOf(server.app.DB, ids); err != nil {
+				return err
+			}
+		}
+
+		for _, recipe := range batch {
+			exported := &recipepb.ExportedRecipe{Recipe: recipeToProto(recipe)}
+			for _, rate := range ratings[recipe.RecipeID()] {
+				exported.Ratings = append(exported.Ratings, &recipepb.RecipeRate{Rate: int32(rate.Rate), User: rate.User, Modified: timestamppb.New(rate.Modified)})
+			}
+			if err := stream.Send(exported); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	err := recipe.ExportRecipes(server.app.DB, func(recipe *model.Recipe) error {
+		batch = append(batch, recipe)
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		return send()
+	})
+	if err == nil {
+		err = send()
+	}
+
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			// client went away or the stream broke, nothing left to report to
+			return err
+		}
+		return grpcError(err)
+	}
+	return nil
+}
+
+// checkExpectedVersion expected_version is required when If-Match is required for REST updates
+func (server *recipeServer) checkExpectedVersion(version int32) error {
+	if version == 0 && server.app.Config != nil && server.app.Config.ConcurrencyConfig.RequireIfMatch {
+		return status.Error(codes.FailedPrecondition, "expected_version required")
+	}
+	return nil
+}
+
+// recipeToProto map recipe to its protobuf message
+func recipeToProto(recipe *model.Recipe) *recipepb.Recipe {
+	message := &recipepb.Recipe{
+		Name:        recipe.Name,
+		Prep:        timestamppb.New(recipe.Prep),
+		Difficulty:  recipepb.Difficulty(recipe.Difficulty),
+		Vegetarian:  recipe.Vegetarian,
+		Version:     int32(recipe.Version),
+		ExternalId:  recipe.ExternalID,
+		PrepMinutes: int32(recipe.PrepMinutes),
+		CookMinutes: int32(recipe.CookMinutes),
+		Ingredients: recipe.Ingredients,
+	}
+	if recipe.ID != nil {
+		message.Id = string(recipe.RecipeID())
+	}
+	return message
+}
+
+// recipesToProto map recipe list
+func recipesToProto(recipes []*model.Recipe) *recipepb.ListRecipesResponse {
+	response := &recipepb.ListRecipesResponse{Recipes: make([]*recipepb.Recipe, len(recipes))}
+	for i, recipe := range recipes {
+		response.Recipes[i] = recipeToProto(recipe)
+	}
+	return response
+}
+
+// recipeFromProto map protobuf message to a validated recipe, id and version are ignored
+// invalid fields are reported with their protobuf names, prefixed with recipe.
+func recipeFromProto(message *recipepb.Recipe) (*model.Recipe, error) {
+	if message == nil {
+		return nil, &model.ValidationError{Message: "Invalid recipe", Fields: []*model.FieldError{
+			{Field: "recipe", Code: "required", Message: "Recipe is required"},
+		}}
+	}
+
+	recipe := &model.Recipe{
+		Name:        message.Name,
+		Difficulty:  model.Difficulty(message.Difficulty),
+		Vegetarian:  message.Vegetarian,
+		ExternalID:  message.ExternalId,
+		PrepMinutes: int(message.PrepMinutes),
+		CookMinutes: int(message.CookMinutes),
+		Ingredients: message.Ingredients,
+	}
+	if message.Prep != nil {
+		recipe.Prep = message.Prep.AsTime()
+	} else {
+		recipe.Prep = time.Time{}
+	}
+
+	fieldErrors := recipe.FieldErrors("")
+	if len(fieldErrors) == 0 {
+		return recipe, nil
+	}
+	for _, fieldError := range fieldErrors {
+		if name, ok := grpcFieldNames[fieldError.Field]; ok {
+			fieldError.Field = name
+		}
+		fieldError.Field = "recipe." + fieldError.Field
+	}
+	return nil, &model.ValidationError{Message: "Invalid recipe", Fields: fieldErrors}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"hellofresh/model"
+	"hellofresh/util"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// halMediaType media type of the HAL representation of v1 recipes
+const halMediaType = "application/hal+json"
+
+// link HAL link, templated hrefs are RFC 6570 URI templates
+type link struct {
+	Href      string `json:"href"`
+	Templated bool   `json:"templated,omitempty"`
+}
+
+// links HAL _links keyed by relation
+type links map[string]*link
+
+// add add link of rel, links of unregistered routes are nil and left out
+func (l links) add(rel string, link *link) links {
+	if link != nil {
+		l[rel] = link
+	}
+	return l
+}
+
+// recipeResource v1 recipe with its links
+type recipeResource struct {
+	*model.Recipe
+	Links links `json:"_links"`
+}
+
+// recipeCollection HAL document of a v1 recipe list
+type recipeCollection struct {
+	Embedded struct {
+		Recipes []*recipeResource `json:"recipes"`
+	} `json:"_embedded"`
+	Links links `json:"_links"`
+}
+
+// recipeV2Resource v2 recipe with its links
+type recipeV2Resource struct {
+	*model.RecipeV2
+	Links links `json:"_links"`
+}
+
+// nameRoutes name every documented route after its OpenAPI operationId, e.g. getRecipe, getRecipeV1 and getRecipeV2
+// links are generated from these names, so changing a path template does not break consumers
+func (app *App) nameRoutes() {
+	app.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			if operation, ok := routeDoc(method, template); ok {
+				route.Name(operation.OperationID)
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// link link to named route with its variables, nil if the route is not registered
+func (app *App) link(name string, pairs ...string) *link {
+	route := app.Router.Get(name)
+	if route == nil {
+		return nil
+	}
+
+	href, err := route.URL(pairs...)
+	if err != nil {
+		log.Printf("link to %s: %v", name, err)
+		return nil
+	}
+	return &link{Href: href.String()}
+}
+
+// pageLink link to named list route with pagination query parameters
+func (app *App) pageLink(name string, query url.Values, pairs ...string) *link {
+	pageLink := app.link(name, pairs...)
+	if pageLink != nil {
+		pageLink.Href += "?" + query.Encode()
+	}
+	return pageLink
+}
+
+// templatedLink URI template of named route, variables in pairs are filled in and the others are left as {name}
+func (app *App) templatedLink(name string, query string, pairs ...string) *link {
+	route := app.Router.Get(name)
+	if route == nil {
+		return nil
+	}
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+
+	href, _ := openAPIPath(template)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		href = strings.Replace(href, "{"+pairs[i]+"}", url.PathEscape(pairs[i+1]), -1)
+	}
+	if query != "" {
+		href += "{?" + query + "}"
+	}
+	return &link{Href: href, Templated: true}
+}
+
+// v1RouteSuffix suffix of the v1 route names the request was routed through, V1 under /v1 and empty at the root
+func v1RouteSuffix(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil && strings.HasSuffix(route.GetName(), "V1") {
+		return "V1"
+	}
+	return ""
+}
+
+// recipeLinks links of a v1 recipe, pointing into the route tree of the request
+// v1 has no route listing the ratings of a recipe, so ratings points to the v2 one
+func (app *App) recipeLinks(r *http.Request, recipe *model.Recipe) links {
+	suffix := v1RouteSuffix(r)
+	id := string(recipe.RecipeID())
+	return links{}.
+		add("self", app.link("getRecipe"+suffix, "id", id)).
+		add("rate", app.templatedLink("rateRecipe"+suffix, "", "id", id)).
+		add("ratings", app.link("getRatingsV2", "id", id)).
+		add("search", app.templatedLink("searchRecipes"+suffix, ""))
+}
+
+// responseWithHAL write a v1 recipe or recipe page as HAL
+// a recipe is tagged with its version like its other representations, a page (version 0) by content
+func (app *App) responseWithHAL(w http.ResponseWriter, r *http.Request, payload interface{}, version int) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	etag := util.WeakETag(body)
+	if version > 0 {
+		etag = util.RepresentationETag(version, halMediaType)
+	}
+	w.Header().Set("Vary", "Accept")
+	if util.SetETag(w, r, etag) {
+		return
+	}
+	util.ResponseWithBody(w, http.StatusOK, halMediaType, body)
+}
+
+// recipeResource HAL document of a v1 recipe
+func (app *App) recipeResource(r *http.Request, recipe *model.Recipe) *recipeResource {
+	return &recipeResource{Recipe: recipe, Links: app.recipeLinks(r, recipe)}
+}
+
+// recipeCollection HAL document of a v1 recipe list, page links are only added for pages of start and limit
+func (app *App) recipeCollection(r *http.Request, recipes []*model.Recipe) *recipeCollection {
+	suffix := v1RouteSuffix(r)
+	collection := &recipeCollection{Links: links{}}
+	collection.Embedded.Recipes = make([]*recipeResource, len(recipes))
+	for i, recipe := range recipes {
+		collection.Embedded.Recipes[i] = app.recipeResource(r, recipe)
+	}
+
+	collection.Links.add("self", &link{Href: r.URL.RequestURI()})
+	collection.Links.add("search", app.templatedLink("searchRecipes"+suffix, ""))
+
+	vars := mux.Vars(r)
+	start, startErr := strconv.Atoi(vars["start"])
+	limit, limitErr := strconv.Atoi(vars["limit"])
+	if startErr != nil || limitErr != nil {
+		return collection
+	}
+	if len(recipes) == limit {
+		collection.Links.add("next", app.link("getRecipes"+suffix, "start", strconv.Itoa(start+limit), "limit", strconv.Itoa(limit)))
+	}
+	if start > 0 {
+		prev := start - limit
+		if prev < 0 {
+			prev = 0
+		}
+		collection.Links.add("prev", app.link("getRecipes"+suffix, "start", strconv.Itoa(prev), "limit", strconv.Itoa(limit)))
+	}
+	return collection
+}
+
+// recipeV2Resource v2 recipe with links to itself, its ratings and rating it
+func (app *App) recipeV2Resource(recipe *model.Recipe) *recipeV2Resource {
+	id := string(recipe.RecipeID())
+	return &recipeV2Resource{RecipeV2: model.NewRecipeV2(recipe), Links: links{}.
+		add("self", app.link("getRecipeV2", "id", id)).
+		add("ratings", app.link("getRatingsV2", "id", id)).
+		add("rate", app.link("rateRecipeV2", "id", id)),
+	}
+}
+
+// recipeV2Resources map recipes to their v2 representation, never nil
+func (app *App) recipeV2Resources(recipes []*model.Recipe) []*recipeV2Resource {
+	items := make([]*recipeV2Resource, len(recipes))
+	for i, recipe := range recipes {
+		items[i] = app.recipeV2Resource(recipe)
+	}
+	return items
+}
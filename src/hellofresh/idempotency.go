@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hellofresh/model"
+	"hellofresh/util"
+	"log"
+	"net/http"
+)
+
+// idempotencyKeyHeader header clients retry unsafe requests with
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Idempotent middleware replaying the stored response of requests repeated with the same Idempotency-Key
+// keys belong to the principal or anonymous client which sent them, so clients can not replay the responses of others
+// a key reused with another method, path, query or body is rejected with 422, a key whose first request is still running with 409
+// 5xx responses are not stored, so the request can be retried with the same key
+func (app *App) Idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := util.ReadBody(r, app.maxBodySize())
+		if tooLarge, ok := err.(*util.BodyTooLargeError); ok {
+			util.ResponseWithDomainError(w, r, tooLarge)
+			return
+		}
+		if err != nil {
+			util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+
+		scope := app.idempotencyScope(r)
+		record := &model.IdempotencyRecord{Key: scope + " " + key, RequestHash: requestHash(scope, r, body)}
+		if err := record.Reserve(app.DB); err != nil {
+			if err != model.ErrIdempotencyKeyInUse {
+				util.ResponseWithDomainError(w, r, err)
+				return
+			}
+			app.replay(w, r, record)
+			return
+		}
+
+		recorder := &responseRecorder{header: http.Header{}}
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				record.Release(app.DB)
+				panic(recovered)
+			}
+		}()
+		h.ServeHTTP(recorder, r)
+
+		if recorder.code == 0 {
+			recorder.code = http.StatusOK
+		}
+		if recorder.code >= http.StatusInternalServerError {
+			if err := record.Release(app.DB); err != nil {
+				log.Printf("release Idempotency-Key %q: %v", key, err)
+			}
+		} else {
+			record.Status, record.Header, record.Body = recorder.code, recorder.header, recorder.body.Bytes()
+			if err := record.Complete(app.DB); err != nil {
+				log.Printf("store response of Idempotency-Key %q: %v", key, err)
+			}
+		}
+		recorder.sendTo(w)
+	}
+}
+
+// replay write the response stored under the key of record
+func (app *App) replay(w http.ResponseWriter, r *http.Request, record *model.IdempotencyRecord) {
+	stored, err := model.GetIdempotencyRecord(app.DB, record.Key)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	if stored.RequestHash != record.RequestHash {
+		util.ResponseWithProblem(w, r, util.NewProblem(http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was used for a different request"))
+		return
+	}
+	if stored.Status == 0 {
+		util.ResponseWithDomainError(w, r, model.ErrIdempotencyKeyInUse)
+		return
+	}
+
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
+
+// idempotencyScope owner of the Idempotency-Keys of the request, the principal or the fingerprint of an anonymous client
+func (app *App) idempotencyScope(r *http.Request) string {
+	if principal := util.PrincipalFrom(r.Context()); principal != nil {
+		// the account of the auth config has no id
+		if principal.ID == "" {
+			return "config:" + principal.Username
+		}
+		return principal.ID
+	}
+	if fingerprint := util.FingerprintFrom(r.Context()); fingerprint != "" {
+		return model.AnonymousRaterPrefix + fingerprint
+	}
+
+	salt := ""
+	if app.Config != nil {
+		salt = app.Config.RatingConfig.FingerprintSalt
+	}
+	return model.AnonymousRaterPrefix + util.Fingerprint(r, salt)
+}
+
+// requestHash hash of scope, method, path, query and body identifying the request an Idempotency-Key was first used for
+func requestHash(scope string, r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(scope + "\n" + r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
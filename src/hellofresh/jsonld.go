@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hellofresh/model"
+	"hellofresh/util"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// responseWithSchemaRecipe write recipe as schema.org Recipe JSON-LD
+// the document includes ratings, so it is tagged by content rather than by recipe version
+func (app *App) responseWithSchemaRecipe(w http.ResponseWriter, r *http.Request, recipe *model.Recipe) {
+	id := recipe.RecipeID()
+	rates, err := id.GetRatings(app.DB)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	// @id is built from the configured base URL, never from the Host header of the request
+	schema := model.NewSchemaRecipe(recipe, rates, strings.TrimSuffix(app.Config.BaseURL, "/")+"/recipes/"+url.PathEscape(string(id)))
+	payload, err := json.Marshal(schema)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Vary", "Accept")
+	if util.SetETag(w, r, util.WeakETag(payload)) {
+		return
+	}
+	util.ResponseWithBody(w, http.StatusOK, "application/ld+json", payload)
+}
+
+// importSchemaRecipes POST /recipes/import/jsonld
+// recipes identified by @id or url are upserted, the others are created
+func (app *App) importSchemaRecipes(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	recipes, err := model.ParseSchemaRecipes(body)
+	if err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// nothing is imported if one of the recipes is invalid
+	fieldErrors := []*model.FieldError{}
+	for i, recipe := range recipes {
+		fieldErrors = append(fieldErrors, recipe.FieldErrors(fmt.Sprintf("recipes[%d].", i))...)
+	}
+	if len(fieldErrors) > 0 {
+		util.ResponseWithDomainError(w, r, &model.ValidationError{Message: "Invalid recipes", Fields: fieldErrors})
+		return
+	}
+
+	owner, err := upsertOwner(r.Context())
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	// the recipes are imported as an atomic batch, a failure leaves none of them stored
+	// so nothing is imported if one of the recipes belongs to another user
+	operations := make([]*model.BatchOperation, len(recipes))
+	for i, recipe := range recipes {
+		authoredBy(r.Context(), recipe)
+		operations[i] = &model.BatchOperation{Op: model.BatchCreate, Recipe: recipe, Owner: owner}
+		if recipe.ExternalID != "" {
+			operations[i].Op = model.BatchUpsert
+		}
+	}
+
+	batch := &model.Recipe{}
+	results, err := batch.BatchRecipes(r.Context(), app.DB, operations, true)
+	if err == model.ErrBatchAborted {
+		for _, result := range results {
+			if result.Status == model.BatchFailed {
+				err = result.Err()
+			}
+		}
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	imported := make(model.Recipes, len(results))
+	for i, result := range results {
+		imported[i] = result.Recipe
+	}
+	util.Render(w, r, http.StatusOK, imported)
+}
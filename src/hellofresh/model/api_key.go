@@ -0,0 +1,133 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hellofresh/util"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// APIKeyPrefix prefix of every API key, so leaked keys are easy to spot
+const APIKeyPrefix = "hf_"
+
+// APIKeyTouchInterval minimum time between two writes of the last use of a key, so authentication does not write on every request
+const APIKeyTouchInterval = time.Minute
+
+// MaxAPIKeyNameLength maximum number of characters of an API key name
+const MaxAPIKeyNameLength = 100
+
+// APIKeyScopes permissions which can be granted to API keys, managing users and keys is left to accounts
+var APIKeyScopes = []string{util.PermissionExport, util.PermissionRate, util.PermissionWrite, util.PermissionWriteAny, util.PermissionDelete}
+
+// APIKey long-lived credential of a service-to-service client, only a hash of the key is stored
+type APIKey struct {
+	// ID can be string or bson.ObjectId
+	ID   interface{} `json:"id" bson:"_id,omitempty"`
+	Name string      `json:"name" bson:"name"`
+	// Prefix first characters of the key, shown to tell keys apart
+	Prefix string `json:"prefix" bson:"prefix"`
+	// KeyHash SHA-256 hash of the key, never rendered
+	KeyHash string   `json:"-" bson:"keyHash"`
+	Scopes  []string `json:"scopes" bson:"scopes"`
+	// CreatedBy id of the admin who created the key
+	CreatedBy string    `json:"createdBy" bson:"createdBy"`
+	Created   time.Time `json:"created" bson:"created"`
+	// Expires key is rejected from then on, never expires when nil
+	Expires  *time.Time `json:"expires,omitempty" bson:"expires,omitempty"`
+	LastUsed *time.Time `json:"lastUsed,omitempty" bson:"lastUsed,omitempty"`
+	Revoked  *time.Time `json:"revoked,omitempty" bson:"revoked,omitempty"`
+}
+
+// NewAPIKey validate a new key and generate its secret, which is returned once and only stored hashed
+func NewAPIKey(name string, scopes []string, expires *time.Time, createdBy string) (*APIKey, string, error) {
+	fieldErrors := []*FieldError{}
+	invalid := func(field, code, message string) {
+		fieldErrors = append(fieldErrors, &FieldError{Field: field, Code: code, Message: message})
+	}
+
+	if name == "" || len(name) > MaxAPIKeyNameLength {
+		invalid("name", "out_of_range", fmt.Sprintf("Name must have 1 to %d characters", MaxAPIKeyNameLength))
+	}
+	if len(scopes) == 0 {
+		invalid("scopes", "required", "At least one scope is required")
+	}
+	for i, scope := range scopes {
+		if !contains(APIKeyScopes, scope) {
+			invalid(fmt.Sprintf("scopes[%d]", i), "unknown_scope", fmt.Sprintf("Unknown scope %q", scope))
+		}
+	}
+	if expires != nil && !expires.After(time.Now()) {
+		invalid("expires", "out_of_range", "Expiry must be in the future")
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, "", &ValidationError{Message: "Invalid API key", Fields: fieldErrors}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	plain := APIKeyPrefix + hex.EncodeToString(secret)
+	key := &APIKey{Name: name, Prefix: plain[:len(APIKeyPrefix)+8], KeyHash: HashAPIKey(plain), Scopes: scopes, CreatedBy: createdBy, Expires: expires}
+	return key, plain, nil
+}
+
+// HashAPIKey hash keys are stored and looked up by, keys are random so a plain SHA-256 is enough
+func HashAPIKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyID id of a stored key, ID is a bson.ObjectId on mongodb and an integer on postgres
+func (key *APIKey) KeyID() string {
+	if objectID, ok := key.ID.(bson.ObjectId); ok {
+		return objectID.Hex()
+	}
+	return fmt.Sprintf("%v", key.ID)
+}
+
+// Active key is neither revoked nor expired at now
+func (key *APIKey) Active(now time.Time) bool {
+	return key.Revoked == nil && (key.Expires == nil || now.Before(*key.Expires))
+}
+
+// Principal principal authenticated with the key, its scopes are its only permissions
+func (key *APIKey) Principal() *util.Principal {
+	return &util.Principal{ID: "apikey:" + key.KeyID(), Username: key.Name, Roles: []string{}, Scopes: key.Scopes}
+}
+
+// CreateAPIKey store key
+func (key *APIKey) CreateAPIKey(db interface{}) error {
+	key.Created = time.Now().UTC()
+	return accessor.CreateAPIKey(db, key)
+}
+
+// GetAPIKeys list every key, revoked and expired ones included
+func GetAPIKeys(db interface{}) ([]*APIKey, error) {
+	return accessor.ListAPIKeys(db)
+}
+
+// GetAPIKeyByHash get key by the hash of its secret, NotFoundError if there is none
+func GetAPIKeyByHash(db interface{}, hash string) (*APIKey, error) {
+	return accessor.GetAPIKeyByHash(db, hash)
+}
+
+// RevokeAPIKey revoke key with id, NotFoundError if there is none
+func RevokeAPIKey(db interface{}, id string) (*APIKey, error) {
+	return accessor.RevokeAPIKey(db, id, time.Now().UTC())
+}
+
+// TouchAPIKey record that key has just been used, unless that has been recorded less than APIKeyTouchInterval ago
+func (key *APIKey) TouchAPIKey(db interface{}) error {
+	now := time.Now().UTC()
+	if key.LastUsed != nil && now.Sub(*key.LastUsed) < APIKeyTouchInterval {
+		return nil
+	}
+	key.LastUsed = &now
+	return accessor.TouchAPIKey(db, key.KeyID(), now)
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hellofresh/util"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// audited actions
+const (
+	// AuditCreate recipe created
+	AuditCreate = "create"
+	// AuditUpdate recipe updated
+	AuditUpdate = "update"
+	// AuditDelete recipe deleted
+	AuditDelete = "delete"
+	// AuditRate recipe rated
+	AuditRate = "rate"
+	// AuditAuthFailure failed authentication, recorded without recipe
+	AuditAuthFailure = "auth_failure"
+)
+
+// auditIgnoredFields recipe fields left out of diffs, the entry itself records who changed the recipe and when
+var auditIgnoredFields = map[string]bool{"_id": true, "version": true, "createdBy": true, "updatedBy": true, "createdAt": true, "updatedAt": true}
+
+// AuditEntry append-only record of a mutating recipe operation or of a failed authentication
+type AuditEntry struct {
+	// ID can be string or bson.ObjectId
+	ID       interface{} `json:"id" bson:"_id,omitempty"`
+	RecipeID string      `json:"recipeId" bson:"recipeId"`
+	Action   string      `json:"action" bson:"action"`
+	// User id of the principal, or the anonymous rater, empty for unauthenticated internal calls
+	// the attempted username or partner keyId of failed authentications
+	User     string    `json:"user" bson:"user"`
+	ClientIP string    `json:"clientIp" bson:"clientIp"`
+	Time     time.Time `json:"time" bson:"time"`
+	// Changes fields which differ before and after the operation, every field for creates and deletes
+	Changes []*AuditChange `json:"changes" bson:"changes"`
+}
+
+// AuditChange value of a field before and after an operation, nil when the recipe did not exist
+type AuditChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before" bson:"before"`
+	After  interface{} `json:"after" bson:"after"`
+}
+
+// AuditFilter criteria of GetAuditEntries, zero values match every entry
+type AuditFilter struct {
+	RecipeID string
+	User     string
+	Action   string
+	Since    time.Time
+}
+
+// GetAuditEntries entries matching filter, oldest first
+func GetAuditEntries(db interface{}, filter *AuditFilter, start, limit int) ([]*AuditEntry, error) {
+	return accessor.FindAudit(db, filter, start, limit)
+}
+
+// AppendAuthFailure append failure to the audit log, its reason is recorded as change of the field reason
+func AppendAuthFailure(db interface{}, failure *util.AuthFailure) error {
+	entry := &AuditEntry{Action: AuditAuthFailure, User: failure.Username, ClientIP: failure.Client, Time: failure.Time,
+		Changes: []*AuditChange{{Field: "reason", After: failure.Reason}}}
+	return accessor.AppendAudit(db, entry)
+}
+
+// audit append entry of action with changes on recipe id by the principal of ctx
+// db is the transaction of the operation, so an operation which cannot be audited fails and is rolled back where the backend can
+func audit(ctx context.Context, db interface{}, action string, id ID, changes []*AuditChange) error {
+	entry := &AuditEntry{RecipeID: string(id), Action: action, ClientIP: util.ClientIPFrom(ctx), Time: time.Now().UTC(), Changes: changes}
+	entry.User, _ = RaterFrom(ctx)
+	if err := accessor.AppendAudit(db, entry); err != nil {
+		return fmt.Errorf("audit %s of recipe %s: %v", action, id, err)
+	}
+	return nil
+}
+
+// diff changes of the json fields of before and after, sorted by field, nil stands for a recipe which does not exist
+func diff(before, after *Recipe) []*AuditChange {
+	beforeFields, afterFields := auditFields(before), auditFields(after)
+	changes := []*AuditChange{}
+	for field, value := range afterFields {
+		if previous, ok := beforeFields[field]; !ok || !reflect.DeepEqual(previous, value) {
+			changes = append(changes, &AuditChange{Field: field, Before: previous, After: value})
+		}
+	}
+	for field, previous := range beforeFields {
+		if _, ok := afterFields[field]; !ok {
+			changes = append(changes, &AuditChange{Field: field, Before: previous})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// auditFields json fields of recipe without the ignored ones, empty for nil
+func auditFields(recipe *Recipe) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if recipe == nil {
+		return fields
+	}
+
+	encoded, err := json.Marshal(recipe)
+	if err == nil {
+		err = json.Unmarshal(encoded, &fields)
+	}
+	if err != nil {
+		log.Printf("audit diff: %v", err)
+	}
+	for field := range auditIgnoredFields {
+		delete(fields, field)
+	}
+	return fields
+}
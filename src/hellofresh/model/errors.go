@@ -0,0 +1,156 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+	"hellofresh/util"
+	"net/http"
+
+	"github.com/lib/pq"
+	mgo "gopkg.in/mgo.v2"
+)
+
+// NotFoundError resource does not exist
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+// InvalidIDError id is not valid for the storage backend
+type InvalidIDError struct {
+	ID string
+}
+
+// ConflictError request conflicts with the stored state, e.g. a duplicate unique field
+type ConflictError struct {
+	Code    string
+	Message string
+}
+
+// PreconditionFailedError conditional request does not match the stored state
+type PreconditionFailedError struct {
+	Code    string
+	Message string
+}
+
+// ForbiddenError caller may not change the resource, e.g. a recipe of another user
+type ForbiddenError struct {
+	Code    string
+	Message string
+}
+
+// ValidationError payload is invalid, Fields lists every invalid field
+type ValidationError struct {
+	Message string
+	Fields  []*FieldError
+}
+
+// FieldError single invalid field of a ValidationError
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ErrVersionConflict recipe has been modified since the expected version
+var ErrVersionConflict = &PreconditionFailedError{Code: "version_conflict", Message: "Recipe has been modified"}
+
+// ErrNotOwner recipe has been created by another user and the caller may only change own recipes
+var ErrNotOwner = &ForbiddenError{Code: "not_owner", Message: "Recipe is owned by another user"}
+
+// Error error message
+func (err *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %s not found", err.Resource, err.ID)
+}
+
+// Problem 404 problem details
+func (err *NotFoundError) Problem() *util.Problem {
+	return util.NewProblem(http.StatusNotFound, err.Resource+"_not_found", err.Error())
+}
+
+// Error error message
+func (err *InvalidIDError) Error() string {
+	return fmt.Sprintf("Invalid id %q", err.ID)
+}
+
+// Problem 400 problem details
+func (err *InvalidIDError) Problem() *util.Problem {
+	return util.NewProblem(http.StatusBadRequest, "invalid_id", err.Error())
+}
+
+// Error error message
+func (err *ConflictError) Error() string {
+	return err.Message
+}
+
+// Problem 409 problem details
+func (err *ConflictError) Problem() *util.Problem {
+	return util.NewProblem(http.StatusConflict, err.Code, err.Message)
+}
+
+// Error error message
+func (err *PreconditionFailedError) Error() string {
+	return err.Message
+}
+
+// Problem 412 problem details
+func (err *PreconditionFailedError) Problem() *util.Problem {
+	return util.NewProblem(http.StatusPreconditionFailed, err.Code, err.Message)
+}
+
+// Error error message
+func (err *ForbiddenError) Error() string {
+	return err.Message
+}
+
+// Problem 403 problem details
+func (err *ForbiddenError) Problem() *util.Problem {
+	return util.NewProblem(http.StatusForbidden, err.Code, err.Message)
+}
+
+// Error error message
+func (err *ValidationError) Error() string {
+	return err.Message
+}
+
+// Problem 422 problem details listing the field errors
+func (err *ValidationError) Problem() *util.Problem {
+	problem := util.NewProblem(http.StatusUnprocessableEntity, "validation_failed", err.Message)
+	problem.Errors = err.Fields
+	return problem
+}
+
+// mongoError translate mgo errors into domain errors
+func mongoError(err error, resource string, id interface{}) error {
+	switch {
+	case err == nil:
+		return nil
+	case err == mgo.ErrNotFound:
+		return &NotFoundError{Resource: resource, ID: fmt.Sprintf("%s", id)}
+	case mgo.IsDup(err):
+		return &ConflictError{Code: "duplicate_" + resource, Message: fmt.Sprintf("Duplicate %s", resource)}
+	default:
+		return err
+	}
+}
+
+// postgresError translate database/sql and pq errors into domain errors
+func postgresError(err error, resource string, id interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	if err == sql.ErrNoRows {
+		return &NotFoundError{Resource: resource, ID: fmt.Sprintf("%v", id)}
+	}
+
+	if pqErr, ok := err.(*pq.Error); ok {
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			return &ConflictError{Code: "duplicate_" + resource, Message: fmt.Sprintf("Duplicate %s", resource)}
+		case "invalid_text_representation":
+			return &InvalidIDError{ID: fmt.Sprintf("%v", id)}
+		}
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package model
+
+import "time"
+
+// IdempotencyKeyTTL time a response stored under an Idempotency-Key is replayed for, expired records are purged
+const IdempotencyKeyTTL = 24 * time.Hour
+
+// IdempotencyReservationTimeout time after which a key still in progress is considered abandoned, e.g. by a crash,
+// and can be reserved again
+const IdempotencyReservationTimeout = 2 * time.Minute
+
+// IdempotencyRecord request stored under an Idempotency-Key with the response it got
+// Status is 0 while the first request with the key is in progress
+type IdempotencyRecord struct {
+	// Key Idempotency-Key prefixed with the principal or anonymous client which sent it
+	Key string `bson:"_id"`
+	// RequestHash hash of the client, method, path, query and body of the request
+	RequestHash string              `bson:"requestHash"`
+	Status      int                 `bson:"status"`
+	Header      map[string][]string `bson:"header"`
+	Body        []byte              `bson:"body"`
+	Created     time.Time           `bson:"created"`
+}
+
+// ErrIdempotencyKeyInUse key is reserved by another request
+var ErrIdempotencyKeyInUse = &ConflictError{Code: "idempotency_key_in_use", Message: "A request with this Idempotency-Key is in progress or stored"}
+
+// GetIdempotencyRecord get unexpired record stored under key, NotFoundError if there is none
+func GetIdempotencyRecord(db interface{}, key string) (*IdempotencyRecord, error) {
+	return accessor.GetIdempotencyKey(db, key)
+}
+
+// Reserve store record as in progress, ErrIdempotencyKeyInUse if its key is already stored
+// expired records and abandoned reservations of the key are replaced
+func (record *IdempotencyRecord) Reserve(db interface{}) error {
+	record.Status = 0
+	record.Created = time.Now().UTC()
+	return accessor.ReserveIdempotencyKey(db, record)
+}
+
+// Complete store the response of the reserved record
+func (record *IdempotencyRecord) Complete(db interface{}) error {
+	return accessor.CompleteIdempotencyKey(db, record)
+}
+
+// Release remove the reserved record, so the request can be retried with the same key
+func (record *IdempotencyRecord) Release(db interface{}) error {
+	return accessor.ReleaseIdempotencyKey(db, record.Key)
+}
@@ -1,7 +1,9 @@
 package model
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"time"
 
 	mgo "gopkg.in/mgo.v2"
@@ -11,37 +13,216 @@ import (
 // MongoDBAccessor MongoDB restful accessor
 type MongoDBAccessor struct{}
 
+// recipeFields updatable fields of recipe, the author is only set on insert
+func recipeFields(recipe *Recipe) bson.M {
+	return bson.M{
+		"name":        recipe.Name,
+		"prep":        recipe.Prep,
+		"difficulty":  recipe.Difficulty,
+		"vegetarian":  recipe.Vegetarian,
+		"prepMinutes": recipe.PrepMinutes,
+		"cookMinutes": recipe.CookMinutes,
+		"ingredients": recipe.Ingredients,
+		"updatedBy":   recipe.UpdatedBy,
+		"updatedAt":   recipe.UpdatedAt,
+	}
+}
+
 // Description Description
 func (accessor *MongoDBAccessor) Description() string {
 	return "mongodb restful accessor"
 }
 
+// EnsureSchema create missing indexes and backfill fields documents written by older releases lack
+func (accessor *MongoDBAccessor) EnsureSchema(db interface{}) error {
+	recipes := db.(*mgo.Database).C("recipe")
+	// recipes stored before optimistic concurrency have no version, they start at the version of new recipes
+	if _, err := recipes.UpdateAll(bson.M{"version": bson.M{"$not": bson.M{"$gte": 1}}}, bson.M{"$set": bson.M{"version": 1}}); err != nil {
+		return err
+	}
+
+	// imports upsert by external id, most recipes have none
+	if err := recipes.EnsureIndex(mgo.Index{Key: []string{"externalId"}, Unique: true, Sparse: true}); err != nil {
+		return err
+	}
+
+	// one rate per recipe and rater, legacy rates all share one rater and become raters of their own first
+	rates := db.(*mgo.Database).C("reciperate")
+	legacy := RecipeRate{}
+	iter := rates.Find(bson.M{"user": legacyRater}).Iter()
+	for iter.Next(&legacy) {
+		rater := fmt.Sprintf("%s%v", LegacyRaterPrefix, legacy.ID)
+		if objectID, ok := legacy.ID.(bson.ObjectId); ok {
+			rater = LegacyRaterPrefix + objectID.Hex()
+		}
+		if err := rates.UpdateId(legacy.ID, bson.M{"$set": bson.M{"user": rater}}); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	if err := rates.EnsureIndex(mgo.Index{Key: []string{"recipeid", "user"}, Unique: true}); err != nil {
+		return err
+	}
+
+	// expired Idempotency-Keys and refresh tokens are removed by the TTL monitor of mongod
+	idempotency := db.(*mgo.Database).C("idempotency")
+	if err := idempotency.EnsureIndex(mgo.Index{Key: []string{"created"}, ExpireAfter: IdempotencyKeyTTL}); err != nil {
+		return err
+	}
+	refreshTokens := db.(*mgo.Database).C("refreshtoken")
+	if err := refreshTokens.EnsureIndex(mgo.Index{Key: []string{"expires"}, ExpireAfter: time.Second}); err != nil {
+		return err
+	}
+	if err := refreshTokens.EnsureIndex(mgo.Index{Key: []string{"subject"}}); err != nil {
+		return err
+	}
+
+	// audit entries are listed by recipe, user and action in insertion order and since a time
+	audit := db.(*mgo.Database).C("audit")
+	for _, key := range [][]string{{"recipeId", "_id"}, {"user", "_id"}, {"action", "_id"}, {"time"}} {
+		if err := audit.EnsureIndex(mgo.Index{Key: key}); err != nil {
+			return err
+		}
+	}
+	return accessor.ensureAuditAppendOnly(db.(*mgo.Database))
+}
+
+// connectionStatus privileges of the user of a connection, as reported by the connectionStatus command
+type connectionStatus struct {
+	AuthInfo struct {
+		AuthenticatedUsers []bson.M `bson:"authenticatedUsers"`
+		Privileges         []struct {
+			Resource struct {
+				DB          string `bson:"db"`
+				Collection  string `bson:"collection"`
+				Cluster     bool   `bson:"cluster"`
+				AnyResource bool   `bson:"anyResource"`
+			} `bson:"resource"`
+			Actions []string `bson:"actions"`
+		} `bson:"authenticatedUserPrivileges"`
+	} `bson:"authInfo"`
+}
+
+// ensureAuditAppendOnly refuse a database user who may update or remove audit entries, mongodb has no trigger to keep them append-only
+// connections without authentication, e.g. to a local development server, are not checked
+func (accessor *MongoDBAccessor) ensureAuditAppendOnly(db *mgo.Database) error {
+	status := connectionStatus{}
+	if err := db.Run(bson.D{{Name: "connectionStatus", Value: 1}, {Name: "showPrivileges", Value: true}}, &status); err != nil {
+		return err
+	}
+	if len(status.AuthInfo.AuthenticatedUsers) == 0 {
+		return nil
+	}
+
+	for _, privilege := range status.AuthInfo.Privileges {
+		resource := privilege.Resource
+		if resource.Cluster || !resource.AnyResource && (resource.DB != "" && resource.DB != db.Name || resource.Collection != "" && resource.Collection != "audit") {
+			continue
+		}
+		for _, action := range privilege.Actions {
+			if action == "update" || action == "remove" {
+				return fmt.Errorf("the database user may %s audit entries, grant it only find and insert on the audit collection", action)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseID parse id into bson.ObjectId, bson.ObjectIdHex panics on anything but 24 hex characters
+func (accessor *MongoDBAccessor) ParseID(id ID) (interface{}, error) {
+	return accessor.objectID(id)
+}
+
+// objectID parse id into bson.ObjectId
+func (accessor *MongoDBAccessor) objectID(id ID) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(string(id)) {
+		return "", &InvalidIDError{ID: string(id)}
+	}
+	return bson.ObjectIdHex(string(id)), nil
+}
+
 // Get get recipe
 func (accessor *MongoDBAccessor) Get(db interface{}, id *ID) (*Recipe, error) {
+	objectID, err := accessor.objectID(*id)
+	if err != nil {
+		return nil, err
+	}
+
 	recipe := Recipe{}
 	collection := db.(*mgo.Database).C("recipe")
-	err := collection.Find(bson.M{"_id": bson.ObjectIdHex(fmt.Sprintf("%s", *id))}).One(&recipe)
-	return &recipe, err
+	err = collection.FindId(objectID).One(&recipe)
+	return &recipe, mongoError(err, "recipe", *id)
 }
 
-// Update update recipe
-func (accessor *MongoDBAccessor) Update(db interface{}, recipe *Recipe) error {
+// Update update recipe, returns the recipe it replaced as found and modified in one operation
+func (accessor *MongoDBAccessor) Update(db interface{}, recipe *Recipe) (*Recipe, error) {
+	id, err := accessor.objectID(recipe.RecipeID())
+	if err != nil {
+		return nil, err
+	}
+
 	collection := db.(*mgo.Database).C("recipe")
-	colQuerier := bson.M{"_id": bson.ObjectIdHex(recipe.ID.(string))}
-	change := bson.M{"$set": bson.M{"name": recipe.Name, "prep": recipe.Prep, "difficulty": recipe.Difficulty, "vegetarian": recipe.Vegetarian}}
-	return collection.Update(colQuerier, change)
+	colQuerier := bson.M{"_id": id}
+	if recipe.Version > 0 {
+		colQuerier["version"] = recipe.Version
+	}
+
+	recipe.UpdatedAt = time.Now().UTC()
+	change := mgo.Change{Update: bson.M{"$set": recipeFields(recipe), "$inc": bson.M{"version": 1}}}
+	before := &Recipe{}
+	if _, err := collection.Find(colQuerier).Apply(change, before); err != nil {
+		return nil, accessor.versionConflict(collection, id, recipe.Version, err)
+	}
+
+	recipe.Version = before.Version + 1
+	recipe.CreatedBy = before.CreatedBy
+	recipe.CreatedAt = before.CreatedAt
+	return before, nil
 }
 
-// Delete delete recipe
-func (accessor *MongoDBAccessor) Delete(db interface{}, id *ID) error {
+// Delete delete recipe, returns the deleted recipe as found and removed in one operation
+func (accessor *MongoDBAccessor) Delete(db interface{}, id *ID, version int) (*Recipe, error) {
+	objectID, err := accessor.objectID(*id)
+	if err != nil {
+		return nil, err
+	}
+
 	collection := db.(*mgo.Database).C("recipe")
-	return collection.Remove(bson.M{"_id": bson.ObjectIdHex(fmt.Sprintf("%s", *id))})
+	colQuerier := bson.M{"_id": objectID}
+	if version > 0 {
+		colQuerier["version"] = version
+	}
+
+	before := &Recipe{}
+	if _, err := collection.Find(colQuerier).Apply(mgo.Change{Remove: true}, before); err != nil {
+		return nil, accessor.versionConflict(collection, objectID, version, err)
+	}
+	return before, nil
+}
+
+// versionConflict translate not found on a versioned query into ErrVersionConflict if the recipe still exists
+func (accessor *MongoDBAccessor) versionConflict(collection *mgo.Collection, id bson.ObjectId, version int, err error) error {
+	if err == mgo.ErrNotFound && version > 0 {
+		if count, countErr := collection.FindId(id).Count(); countErr == nil && count > 0 {
+			return ErrVersionConflict
+		}
+	}
+	return mongoError(err, "recipe", id.Hex())
 }
 
 // Create create recipe
 func (accessor *MongoDBAccessor) Create(db interface{}, recipe *Recipe) error {
 	collection := db.(*mgo.Database).C("recipe")
-	return collection.Insert(&Recipe{Name: recipe.Name, Prep: recipe.Prep, Difficulty: recipe.Difficulty, Vegetarian: recipe.Vegetarian})
+	recipe.ID = bson.NewObjectId()
+	recipe.Version = 1
+	recipe.CreatedAt = time.Now().UTC()
+	recipe.UpdatedAt = recipe.CreatedAt
+	err := collection.Insert(&Recipe{ID: recipe.ID, Name: recipe.Name, Prep: recipe.Prep, Difficulty: recipe.Difficulty, Vegetarian: recipe.Vegetarian, Version: recipe.Version, ExternalID: recipe.ExternalID, PrepMinutes: recipe.PrepMinutes, CookMinutes: recipe.CookMinutes, Ingredients: recipe.Ingredients,
+		CreatedBy: recipe.CreatedBy, UpdatedBy: recipe.UpdatedBy, CreatedAt: recipe.CreatedAt, UpdatedAt: recipe.UpdatedAt})
+	return mongoError(err, "recipe", recipe.ID)
 }
 
 // List get recipe list
@@ -52,10 +233,38 @@ func (accessor *MongoDBAccessor) List(db interface{}, start, limit int) ([]*Reci
 	return recipes, err
 }
 
-// Rate rate recipe
-func (accessor *MongoDBAccessor) Rate(db interface{}, id *ID, rate int) error {
+// Rate rate recipe as the rater of ctx, upserting the rate of the rater
+// returns the previous rate of the rater as found and modified in one operation, nil for a first rate
+func (accessor *MongoDBAccessor) Rate(ctx context.Context, db interface{}, id *ID, rate int) (*RecipeRate, error) {
+	user, err := RaterFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := accessor.Get(db, id); err != nil {
+		return nil, err
+	}
+	objectID, err := accessor.objectID(*id)
+	if err != nil {
+		return nil, err
+	}
+
+	// rates are stored under the lower case hex of the id, the path may carry upper case hex
 	collection := db.(*mgo.Database).C("reciperate")
-	return collection.Insert(&RecipeRate{RecipeID: fmt.Sprintf("%s", *id), Rate: rate, User: "Jane Doe" /*dummy or use ip*/, Modified: time.Now()})
+	query := collection.Find(bson.M{"recipeid": objectID.Hex(), "user": user})
+	change := mgo.Change{Update: bson.M{"$set": bson.M{"rate": rate, "modified": time.Now()}}, Upsert: true}
+	previous := &RecipeRate{}
+	info, err := query.Apply(change, previous)
+	if mgo.IsDup(err) {
+		// a concurrent first rate of the rater inserted the rate, the unique index kept this one from adding another
+		info, err = query.Apply(change, previous)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.UpsertedId != nil {
+		return nil, nil
+	}
+	return previous, nil
 }
 
 // Search search recipe by search pattern
@@ -66,3 +275,385 @@ func (accessor *MongoDBAccessor) Search(db interface{}, search string) ([]*Recip
 	err := collection.Find(bson.M{"name": regex}).All(&recipes)
 	return recipes, err
 }
+
+// Batch apply batch operations
+// mongodb has no multi document transaction, atomic batches revert applied operations on failure
+// applied is called after each applied operation of batches which are not atomic, for atomic ones once every operation succeeded
+// or for the operations which could not be reverted; its error stops the batch, the operations applied so far stay applied
+func (accessor *MongoDBAccessor) Batch(db interface{}, operations []*BatchOperation, atomic bool, applied BatchApplied) ([]*BatchResult, error) {
+	if !atomic {
+		results := make([]*BatchResult, len(operations))
+		var err error
+		for i, operation := range operations {
+			results[i] = &BatchResult{Index: i, Op: operation.Op}
+			if err != nil {
+				results[i].Status = BatchSkipped
+				continue
+			}
+
+			results[i].complete(applyBatchOperation(accessor, db, operation))
+			if results[i].Status == BatchSucceeded {
+				err = applied(db, results[i])
+			}
+		}
+		return results, err
+	}
+
+	collection := db.(*mgo.Database).C("recipe")
+	results, failed := runAtomicBatch(accessor, db, operations, nil)
+	if failed == nil {
+		for _, result := range results {
+			if err := applied(db, result); err != nil {
+				return results, err
+			}
+		}
+		return results, nil
+	}
+
+	// revert in reverse order to the state each operation found, so recipes touched several times end up in their initial state
+	for i := failed.Index - 1; i >= 0; i-- {
+		if err := accessor.revert(collection, results[i]); err != nil {
+			results[i].Status = BatchRollbackFailed
+			results[i].Error = err.Error()
+			continue
+		}
+		results[i].Status = BatchRolledBack
+	}
+	for _, result := range results[:failed.Index] {
+		if result.Status == BatchRollbackFailed {
+			if err := applied(db, result); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, ErrBatchAborted
+}
+
+// revert undo an applied batch operation, restoring the recipe it replaced or deleted
+func (accessor *MongoDBAccessor) revert(collection *mgo.Collection, result *BatchResult) error {
+	snapshot := result.Before
+	switch result.Op {
+	case BatchCreate:
+		return collection.RemoveId(result.Recipe.ID)
+	case BatchUpsert:
+		if snapshot == nil {
+			return collection.RemoveId(result.Recipe.ID)
+		}
+		return collection.UpdateId(snapshot.ID, snapshot)
+	case BatchUpdate:
+		if snapshot == nil {
+			return nil
+		}
+		return collection.UpdateId(snapshot.ID, snapshot)
+	case BatchDelete:
+		if snapshot == nil {
+			return nil
+		}
+		return collection.Insert(snapshot)
+	}
+	return nil
+}
+
+// Upsert create or update recipe identified by its external id, with owner set only a recipe created by owner is updated
+// the owner is part of the query, so a recipe of another user inserted concurrently is never overwritten
+// returns the recipe it replaced as found and modified in one operation, nil if it created the recipe
+func (accessor *MongoDBAccessor) Upsert(db interface{}, recipe *Recipe, owner string) (*Recipe, error) {
+	collection := db.(*mgo.Database).C("recipe")
+	recipe.UpdatedAt = time.Now().UTC()
+	change := mgo.Change{
+		Update: bson.M{
+			"$set":         recipeFields(recipe),
+			"$setOnInsert": bson.M{"createdBy": recipe.CreatedBy, "createdAt": recipe.UpdatedAt},
+			"$inc":         bson.M{"version": 1},
+		},
+		Upsert: true,
+	}
+	query := bson.M{"externalId": recipe.ExternalID}
+	if owner != "" {
+		query["createdBy"] = owner
+	}
+	before := &Recipe{}
+	info, err := collection.Find(query).Apply(change, before)
+	if mgo.IsDup(err) {
+		// a concurrent upsert inserted the recipe first, this one now updates it unless it belongs to someone else
+		info, err = collection.Find(query).Apply(change, before)
+	}
+	if mgo.IsDup(err) && owner != "" {
+		return nil, ErrNotOwner
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if info.UpsertedId != nil {
+		recipe.ID = info.UpsertedId
+		recipe.Version = 1
+		recipe.CreatedAt = recipe.UpdatedAt
+		return nil, nil
+	}
+	recipe.ID = before.ID
+	recipe.Version = before.Version + 1
+	recipe.CreatedBy = before.CreatedBy
+	recipe.CreatedAt = before.CreatedAt
+	return before, nil
+}
+
+// Transaction run fn with db, mongodb has no multi document transaction so writes of fn are not rolled back when it fails
+func (accessor *MongoDBAccessor) Transaction(db interface{}, fn func(db interface{}) error) error {
+	return fn(db)
+}
+
+// Export call fn for every recipe while iterating the collection
+func (accessor *MongoDBAccessor) Export(db interface{}, fn func(*Recipe) error) error {
+	collection := db.(*mgo.Database).C("recipe")
+	iter := collection.Find(nil).Sort("_id").Iter()
+	recipe := &Recipe{}
+	for iter.Next(recipe) {
+		if err := fn(recipe); err != nil {
+			iter.Close()
+			return err
+		}
+		recipe = &Recipe{}
+	}
+	return iter.Close()
+}
+
+// Ratings get ratings of recipe
+func (accessor *MongoDBAccessor) Ratings(db interface{}, id *ID) ([]*RecipeRate, error) {
+	objectID, err := accessor.objectID(*id)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := []*RecipeRate{}
+	collection := db.(*mgo.Database).C("reciperate")
+	err = collection.Find(bson.M{"recipeid": objectID.Hex()}).Sort("modified").All(&rates)
+	return rates, err
+}
+
+// Find list recipes matching filter ordered by id
+func (accessor *MongoDBAccessor) Find(db interface{}, filter *RecipeFilter, start, limit int) ([]*Recipe, error) {
+	query := bson.M{}
+	if filter.Vegetarian != nil {
+		query["vegetarian"] = *filter.Vegetarian
+	}
+	if filter.Difficulty != 0 {
+		query["difficulty"] = filter.Difficulty
+	}
+	if filter.MaxTotalMinutes > 0 {
+		query["$expr"] = bson.M{"$lte": []interface{}{bson.M{"$add": []string{"$prepMinutes", "$cookMinutes"}}, filter.MaxTotalMinutes}}
+	}
+	if filter.Name != "" {
+		query["name"] = bson.M{"$regex": bson.RegEx{Pattern: regexp.QuoteMeta(filter.Name), Options: "i"}}
+	}
+	if filter.CreatedBy != "" {
+		query["createdBy"] = filter.CreatedBy
+	}
+	if filter.ExternalID != "" {
+		query["externalId"] = filter.ExternalID
+	}
+
+	recipes := []*Recipe{}
+	collection := db.(*mgo.Database).C("recipe")
+	err := collection.Find(query).Sort("_id").Skip(start).Limit(limit).All(&recipes)
+	return recipes, err
+}
+
+// RatingsOf get ratings of several recipes in one query, keyed by the ids as given
+func (accessor *MongoDBAccessor) RatingsOf(db interface{}, ids []ID) (map[ID][]*RecipeRate, error) {
+	ratings := map[ID][]*RecipeRate{}
+	given := map[string][]ID{}
+	keys := []string{}
+	for _, id := range ids {
+		ratings[id] = []*RecipeRate{}
+		// malformed ids have no ratings
+		if objectID, err := accessor.objectID(id); err == nil {
+			given[objectID.Hex()] = append(given[objectID.Hex()], id)
+			keys = append(keys, objectID.Hex())
+		}
+	}
+
+	rates := []*RecipeRate{}
+	collection := db.(*mgo.Database).C("reciperate")
+	if err := collection.Find(bson.M{"recipeid": bson.M{"$in": keys}}).Sort("modified").All(&rates); err != nil {
+		return nil, err
+	}
+	for _, rate := range rates {
+		for _, id := range given[rate.RecipeID] {
+			ratings[id] = append(ratings[id], rate)
+		}
+	}
+	return ratings, nil
+}
+
+// ReserveIdempotencyKey insert in progress record, an expired record or abandoned reservation of the key is removed first
+// as the TTL monitor only runs once a minute
+func (accessor *MongoDBAccessor) ReserveIdempotencyKey(db interface{}, record *IdempotencyRecord) error {
+	collection := db.(*mgo.Database).C("idempotency")
+	stale := bson.M{"_id": record.Key, "$or": []bson.M{
+		{"created": bson.M{"$lt": record.Created.Add(-IdempotencyKeyTTL)}},
+		{"status": 0, "created": bson.M{"$lt": record.Created.Add(-IdempotencyReservationTimeout)}},
+	}}
+	if _, err := collection.RemoveAll(stale); err != nil {
+		return err
+	}
+
+	err := collection.Insert(record)
+	if _, ok := mongoError(err, "idempotency_key", record.Key).(*ConflictError); ok {
+		return ErrIdempotencyKeyInUse
+	}
+	return err
+}
+
+// GetIdempotencyKey get unexpired record of key
+func (accessor *MongoDBAccessor) GetIdempotencyKey(db interface{}, key string) (*IdempotencyRecord, error) {
+	record := &IdempotencyRecord{}
+	collection := db.(*mgo.Database).C("idempotency")
+	err := collection.Find(bson.M{"_id": key, "created": bson.M{"$gte": time.Now().UTC().Add(-IdempotencyKeyTTL)}}).One(record)
+	if err != nil {
+		return nil, mongoError(err, "idempotency_key", key)
+	}
+	return record, nil
+}
+
+// CompleteIdempotencyKey store response of the reserved record
+func (accessor *MongoDBAccessor) CompleteIdempotencyKey(db interface{}, record *IdempotencyRecord) error {
+	collection := db.(*mgo.Database).C("idempotency")
+	return collection.UpdateId(record.Key, bson.M{"$set": bson.M{"status": record.Status, "header": record.Header, "body": record.Body}})
+}
+
+// ReleaseIdempotencyKey delete record of key
+func (accessor *MongoDBAccessor) ReleaseIdempotencyKey(db interface{}, key string) error {
+	collection := db.(*mgo.Database).C("idempotency")
+	if err := collection.RemoveId(key); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// CreateUser insert user, the unique username index is created with the first account
+func (accessor *MongoDBAccessor) CreateUser(db interface{}, user *User) error {
+	collection := db.(*mgo.Database).C("user")
+	if err := collection.EnsureIndex(mgo.Index{Key: []string{"username"}, Unique: true}); err != nil {
+		return err
+	}
+
+	user.ID = bson.NewObjectId()
+	return mongoError(collection.Insert(user), "user", user.Username)
+}
+
+// GetUserByName get user by username
+func (accessor *MongoDBAccessor) GetUserByName(db interface{}, username string) (*User, error) {
+	user := &User{}
+	collection := db.(*mgo.Database).C("user")
+	if err := collection.Find(bson.M{"username": username}).One(user); err != nil {
+		return nil, mongoError(err, "user", username)
+	}
+	return user, nil
+}
+
+// CreateAPIKey insert key, the unique key hash index is created with the first key
+func (accessor *MongoDBAccessor) CreateAPIKey(db interface{}, key *APIKey) error {
+	collection := db.(*mgo.Database).C("apikey")
+	if err := collection.EnsureIndex(mgo.Index{Key: []string{"keyHash"}, Unique: true}); err != nil {
+		return err
+	}
+
+	key.ID = bson.NewObjectId()
+	return mongoError(collection.Insert(key), "api_key", key.Prefix)
+}
+
+// ListAPIKeys get every key ordered by id
+func (accessor *MongoDBAccessor) ListAPIKeys(db interface{}) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	collection := db.(*mgo.Database).C("apikey")
+	err := collection.Find(nil).Sort("_id").All(&keys)
+	return keys, err
+}
+
+// GetAPIKeyByHash get key by the hash of its secret
+func (accessor *MongoDBAccessor) GetAPIKeyByHash(db interface{}, hash string) (*APIKey, error) {
+	key := &APIKey{}
+	collection := db.(*mgo.Database).C("apikey")
+	if err := collection.Find(bson.M{"keyHash": hash}).One(key); err != nil {
+		return nil, mongoError(err, "api_key", "")
+	}
+	return key, nil
+}
+
+// RevokeAPIKey set revoked of key with id, keys revoked before keep their revocation time
+func (accessor *MongoDBAccessor) RevokeAPIKey(db interface{}, id string, revoked time.Time) (*APIKey, error) {
+	if !bson.IsObjectIdHex(id) {
+		return nil, &NotFoundError{Resource: "api_key", ID: id}
+	}
+
+	collection := db.(*mgo.Database).C("apikey")
+	objectID := bson.ObjectIdHex(id)
+	if err := collection.Update(bson.M{"_id": objectID, "revoked": nil}, bson.M{"$set": bson.M{"revoked": revoked}}); err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	key := &APIKey{}
+	if err := collection.FindId(objectID).One(key); err != nil {
+		return nil, mongoError(err, "api_key", id)
+	}
+	return key, nil
+}
+
+// TouchAPIKey set lastUsed of key with id
+func (accessor *MongoDBAccessor) TouchAPIKey(db interface{}, id string, used time.Time) error {
+	if !bson.IsObjectIdHex(id) {
+		return &NotFoundError{Resource: "api_key", ID: id}
+	}
+
+	collection := db.(*mgo.Database).C("apikey")
+	return mongoError(collection.UpdateId(bson.ObjectIdHex(id), bson.M{"$set": bson.M{"lastUsed": used}}), "api_key", id)
+}
+
+// StoreRefreshToken insert token
+func (accessor *MongoDBAccessor) StoreRefreshToken(db interface{}, token *RefreshToken) error {
+	return db.(*mgo.Database).C("refreshtoken").Insert(token)
+}
+
+// ConsumeRefreshToken remove the unexpired token of id, false if there is none
+func (accessor *MongoDBAccessor) ConsumeRefreshToken(db interface{}, id string) (bool, error) {
+	err := db.(*mgo.Database).C("refreshtoken").Remove(bson.M{"_id": id, "expires": bson.M{"$gt": time.Now()}})
+	if err == mgo.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RevokeRefreshTokens remove the tokens of subject
+func (accessor *MongoDBAccessor) RevokeRefreshTokens(db interface{}, subject string) error {
+	_, err := db.(*mgo.Database).C("refreshtoken").RemoveAll(bson.M{"subject": subject})
+	return err
+}
+
+// AppendAudit insert entry, the collection is only ever inserted into
+func (accessor *MongoDBAccessor) AppendAudit(db interface{}, entry *AuditEntry) error {
+	entry.ID = bson.NewObjectId()
+	return db.(*mgo.Database).C("audit").Insert(entry)
+}
+
+// FindAudit list entries matching filter ordered by id
+func (accessor *MongoDBAccessor) FindAudit(db interface{}, filter *AuditFilter, start, limit int) ([]*AuditEntry, error) {
+	query := bson.M{}
+	if filter.RecipeID != "" {
+		query["recipeId"] = filter.RecipeID
+	}
+	if filter.User != "" {
+		query["user"] = filter.User
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if !filter.Since.IsZero() {
+		query["time"] = bson.M{"$gte": filter.Since}
+	}
+
+	entries := []*AuditEntry{}
+	collection := db.(*mgo.Database).C("audit")
+	err := collection.Find(query).Sort("_id").Skip(start).Limit(limit).All(&entries)
+	return entries, err
+}
@@ -1,48 +1,78 @@
 package model
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"hellofresh/config"
-	"hellofresh/dal"
-	"hellofresh/util"
-	"log"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // PostGresAccessor PostGres restful accessor
 type PostGresAccessor struct{}
 
-func init() {
-	config, err := config.GetConfig()
-	if err != nil {
-		util.PanicOnError(err)
-	}
+// executor common interface of *sql.DB and *sql.Tx so accessor methods can run inside a transaction
+type executor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
 
-	// do nothing if database is not postgres
-	if strings.ToLower(config.ProductionDBConfig.Host) != "postgres" {
-		return
+// EnsureSchema make sure tables, columns and indexes exist, tables of older releases get the columns added since
+func (accessor *PostGresAccessor) EnsureSchema(db interface{}) error {
+	database := db.(*sql.DB)
+	for _, query := range []string{recipeTableCreationQuery, recipeRateTableCreationQuery} {
+		if _, err := database.Exec(query); err != nil {
+			return err
+		}
 	}
 
-	// open
-	db, err := dal.Open(config.ProductionDBConfig)
-	if err != nil {
-		util.PanicOnError(err)
+	// columns added after the initial table layout
+	columns := [][3]string{
+		{"recipes", "version", "INT NOT NULL DEFAULT 1"},
+		{"recipes", "external_id", "TEXT"},
+		{"recipes", "prep_minutes", "INT NOT NULL DEFAULT 0"},
+		{"recipes", "cook_minutes", "INT NOT NULL DEFAULT 0"},
+		{"recipes", "ingredients", "TEXT[] NOT NULL DEFAULT '{}'"},
+		{"recipes", "created_by", "TEXT NOT NULL DEFAULT ''"},
+		{"recipes", "updated_by", "TEXT NOT NULL DEFAULT ''"},
+		{"recipes", "created_at", "TIMESTAMP"},
+		{"recipes", "updated_at", "TIMESTAMP"},
+	}
+	for _, column := range columns {
+		if err := ensureColumnExists(database, column[0], column[1], column[2]); err != nil {
+			return err
+		}
 	}
 
-	ensureTableExists(db.(*sql.DB))
+	queries := []string{recipeExternalIDIndexCreationQuery, idempotencyKeyTableCreationQuery, idempotencyKeyCreatedIndexCreationQuery, userTableCreationQuery, apiKeyTableCreationQuery,
+		refreshTokenTableCreationQuery, refreshTokenSubjectIndexCreationQuery}
+	queries = append(queries, recipeRateRaterIndexCreationQueries...)
+	for _, query := range append(queries, auditTableCreationQueries...) {
+		if _, err := database.Exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// ensureTableExists make sure recipes table exists when use postgre
-func ensureTableExists(db *sql.DB) {
-	if _, err := db.Exec(recipeTableCreationQuery); err != nil {
-		log.Fatal(err)
+// ensureColumnExists add column to an existing table if missing
+func ensureColumnExists(db *sql.DB, table, column, definition string) error {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM information_schema.columns WHERE table_name=$1 AND column_name=$2)", table, column).Scan(&exists); err != nil {
+		return err
 	}
 
-	if _, err := db.Exec(recipeRateTableCreationQuery); err != nil {
-		log.Fatal(err)
+	if exists {
+		return nil
 	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
 
 const recipeTableCreationQuery = `CREATE TABLE IF NOT EXISTS recipes
@@ -52,9 +82,112 @@ const recipeTableCreationQuery = `CREATE TABLE IF NOT EXISTS recipes
 	prep TIMESTAMP NOT NULL DEFAULT now(),
 	difficulty INT NOT NULL,
 	vegetarian BOOLEAN NOT NULL,
+	version INT NOT NULL DEFAULT 1,
+	external_id TEXT,
+	prep_minutes INT NOT NULL DEFAULT 0,
+	cook_minutes INT NOT NULL DEFAULT 0,
+	ingredients TEXT[] NOT NULL DEFAULT '{}',
+	created_by TEXT NOT NULL DEFAULT '',
+	updated_by TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP,
 	CONSTRAINT recipes_pkey PRIMARY KEY (id)
 )`
 
+const recipeExternalIDIndexCreationQuery = `CREATE UNIQUE INDEX IF NOT EXISTS recipes_external_id_key ON recipes (external_id)`
+
+const idempotencyKeyTableCreationQuery = `CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+	key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status INT NOT NULL DEFAULT 0,
+	header TEXT NOT NULL DEFAULT '{}',
+	body BYTEA,
+	created TIMESTAMP NOT NULL,
+	CONSTRAINT idempotency_keys_pkey PRIMARY KEY (key)
+)`
+
+// idempotencyKeyCreatedIndexCreationQuery index of the purge of expired keys
+const idempotencyKeyCreatedIndexCreationQuery = `CREATE INDEX IF NOT EXISTS idempotency_keys_created ON idempotency_keys (created)`
+
+const userTableCreationQuery = `CREATE TABLE IF NOT EXISTS users
+(
+	id SERIAL,
+	username TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	roles TEXT[] NOT NULL DEFAULT '{}',
+	created TIMESTAMP NOT NULL,
+	CONSTRAINT users_pkey PRIMARY KEY (id),
+	CONSTRAINT users_username_key UNIQUE (username)
+)`
+
+const apiKeyTableCreationQuery = `CREATE TABLE IF NOT EXISTS api_keys
+(
+	id SERIAL,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL,
+	scopes TEXT[] NOT NULL DEFAULT '{}',
+	created_by TEXT NOT NULL DEFAULT '',
+	created TIMESTAMP NOT NULL,
+	expires TIMESTAMP,
+	last_used TIMESTAMP,
+	revoked TIMESTAMP,
+	CONSTRAINT api_keys_pkey PRIMARY KEY (id),
+	CONSTRAINT api_keys_key_hash_key UNIQUE (key_hash)
+)`
+
+const refreshTokenTableCreationQuery = `CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+	id TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	expires TIMESTAMPTZ NOT NULL,
+	CONSTRAINT refresh_tokens_pkey PRIMARY KEY (id)
+)`
+
+const refreshTokenSubjectIndexCreationQuery = `CREATE INDEX IF NOT EXISTS refresh_tokens_subject ON refresh_tokens (subject)`
+
+// auditTableCreationQueries audit_log table, append-only for every role including its owner
+// updates, deletes and truncates raise an error in the trigger and are not granted; created of older releases was stored without time zone in UTC
+var auditTableCreationQueries = []string{`CREATE TABLE IF NOT EXISTS audit_log
+(
+	id SERIAL,
+	recipe_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	user_id TEXT NOT NULL DEFAULT '',
+	client_ip TEXT NOT NULL DEFAULT '',
+	created TIMESTAMPTZ NOT NULL,
+	changes JSONB NOT NULL DEFAULT '[]',
+	CONSTRAINT audit_log_pkey PRIMARY KEY (id)
+)`,
+	"DROP RULE IF EXISTS audit_log_no_update ON audit_log",
+	"DROP RULE IF EXISTS audit_log_no_delete ON audit_log",
+	`DO $$
+BEGIN
+	IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'audit_log' AND column_name = 'created' AND data_type = 'timestamp without time zone') THEN
+		ALTER TABLE audit_log ALTER COLUMN created TYPE TIMESTAMPTZ USING created AT TIME ZONE 'UTC';
+	END IF;
+END
+$$`,
+	"CREATE INDEX IF NOT EXISTS audit_log_recipe_id_idx ON audit_log (recipe_id)",
+	"CREATE INDEX IF NOT EXISTS audit_log_user_id_idx ON audit_log (user_id, id)",
+	"CREATE INDEX IF NOT EXISTS audit_log_action_idx ON audit_log (action, id)",
+	"CREATE INDEX IF NOT EXISTS audit_log_created_idx ON audit_log (created)",
+	`DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'audit_log_append_only' AND tgrelid = 'audit_log'::regclass) THEN
+		CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $body$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only, % is not allowed', TG_OP;
+		END
+		$body$ LANGUAGE plpgsql;
+		CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log FOR EACH STATEMENT EXECUTE PROCEDURE audit_log_append_only();
+	END IF;
+END
+$$`,
+	"REVOKE UPDATE, DELETE, TRUNCATE ON audit_log FROM PUBLIC, CURRENT_USER",
+}
+
 const recipeRateTableCreationQuery = `CREATE TABLE IF NOT EXISTS reciperates
 (
 	id SERIAL,
@@ -65,77 +198,688 @@ const recipeRateTableCreationQuery = `CREATE TABLE IF NOT EXISTS reciperates
 	CONSTRAINT reciperates_pkey PRIMARY KEY (id)
 )`
 
+// recipeRateRaterIndexCreationQueries one rate per recipe and rater, legacy rates all share one rater and become raters of their own first
+var recipeRateRaterIndexCreationQueries = []string{
+	"UPDATE reciperates SET rateuser='" + LegacyRaterPrefix + "' || id WHERE rateuser='" + legacyRater + "'",
+	"CREATE UNIQUE INDEX IF NOT EXISTS reciperates_recipe_rater ON reciperates (recipeId, rateuser)",
+}
+
+// recipeColumns columns read by scanRecipe
+const recipeColumns = "id, name, prep, difficulty, vegetarian, version, external_id, prep_minutes, cook_minutes, ingredients, created_by, updated_by, created_at, updated_at"
+
+// rowScanner common interface of *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanRecipe scan recipeColumns into recipe
+func scanRecipe(row rowScanner, recipe *Recipe) error {
+	var externalID sql.NullString
+	var createdAt, updatedAt pq.NullTime
+	if err := row.Scan(&recipe.ID, &recipe.Name, &recipe.Prep, &recipe.Difficulty, &recipe.Vegetarian, &recipe.Version, &externalID, &recipe.PrepMinutes, &recipe.CookMinutes, pq.Array(&recipe.Ingredients),
+		&recipe.CreatedBy, &recipe.UpdatedBy, &createdAt, &updatedAt); err != nil {
+		return err
+	}
+
+	recipe.ExternalID = externalID.String
+	recipe.CreatedAt = createdAt.Time
+	recipe.UpdatedAt = updatedAt.Time
+	return nil
+}
+
+// queryRecipes run query selecting recipeColumns
+func queryRecipes(db executor, query string, args ...interface{}) ([]*Recipe, error) {
+	recipes := []*Recipe{}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return recipes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		recipe := Recipe{}
+		if err := scanRecipe(rows, &recipe); err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, &recipe)
+	}
+
+	return recipes, rows.Err()
+}
+
 // Description Description
 func (accessor *PostGresAccessor) Description() string {
 	return "postgres restful accessor"
 }
 
+// ParseID parse id into the SERIAL primary key, ids out of the INT range can not exist
+func (accessor *PostGresAccessor) ParseID(id ID) (interface{}, error) {
+	return accessor.serialID(id)
+}
+
+// serialID parse id into a positive integer
+func (accessor *PostGresAccessor) serialID(id ID) (int64, error) {
+	serial, err := strconv.ParseInt(string(id), 10, 32)
+	if err != nil || serial < 1 {
+		return 0, &InvalidIDError{ID: string(id)}
+	}
+	return serial, nil
+}
+
+// canonicalID id as stored in reciperates, "7", "07" and "+7" are all recipe 7
+func (accessor *PostGresAccessor) canonicalID(id ID) (string, error) {
+	serial, err := accessor.serialID(id)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(serial, 10), nil
+}
+
 // Get get single recipe
 func (accessor *PostGresAccessor) Get(db interface{}, id *ID) (*Recipe, error) {
+	serial, err := accessor.serialID(*id)
+	if err != nil {
+		return nil, err
+	}
+
 	recipe := Recipe{}
-	err := db.(*sql.DB).QueryRow("SELECT name, prep, difficulty, vegetarian FROM recipes WHERE id=$1", fmt.Sprintf("%s", *id)).Scan(&recipe.Name, &recipe.Prep, &recipe.Difficulty, &recipe.Vegetarian)
-	return &recipe, err
+	err = scanRecipe(db.(executor).QueryRow("SELECT "+recipeColumns+" FROM recipes WHERE id=$1", serial), &recipe)
+	return &recipe, postgresError(err, "recipe", *id)
 }
 
-// Update update single recipe
-func (accessor *PostGresAccessor) Update(db interface{}, recipe *Recipe) error {
-	_, err := db.(*sql.DB).Exec("UPDATE recipes SET name=$1, prep=$2, difficulty=$3, vegetarian=$4 WHERE id=$5", recipe.Name, recipe.Prep, recipe.Difficulty, recipe.Vegetarian, recipe.ID)
-	return err
+// Update update single recipe, returns the recipe it replaced
+// the stored recipe is locked while it is compared and updated, so it is exactly the one replaced
+func (accessor *PostGresAccessor) Update(db interface{}, recipe *Recipe) (*Recipe, error) {
+	serial, err := accessor.serialID(recipe.RecipeID())
+	if err != nil {
+		return nil, err
+	}
+
+	before := &Recipe{}
+	err = inTransaction(db, func(tx executor) error {
+		if err := scanRecipe(tx.QueryRow("SELECT "+recipeColumns+" FROM recipes WHERE id=$1 FOR UPDATE", serial), before); err != nil {
+			return postgresError(err, "recipe", recipe.RecipeID())
+		}
+		if recipe.Version > 0 && recipe.Version != before.Version {
+			return ErrVersionConflict
+		}
+
+		// the author of the recipe is kept
+		recipe.UpdatedAt = time.Now().UTC()
+		recipe.CreatedBy, recipe.CreatedAt = before.CreatedBy, before.CreatedAt
+		return tx.QueryRow("UPDATE recipes SET name=$1, prep=$2, difficulty=$3, vegetarian=$4, prep_minutes=$6, cook_minutes=$7, ingredients=$8, updated_by=$9, updated_at=$10, version=version+1 WHERE id=$5 RETURNING version",
+			recipe.Name, recipe.Prep, recipe.Difficulty, recipe.Vegetarian, serial, recipe.PrepMinutes, recipe.CookMinutes, pq.Array(recipe.ingredients()), recipe.UpdatedBy, recipe.UpdatedAt).Scan(&recipe.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
 }
 
-// Delete delete single recipe
-func (accessor *PostGresAccessor) Delete(db interface{}, id *ID) error {
-	_, err := db.(*sql.DB).Exec("DELETE FROM recipes WHERE id=$1", fmt.Sprintf("%s", *id))
-	return err
+// Delete delete single recipe, returns the deleted recipe
+func (accessor *PostGresAccessor) Delete(db interface{}, id *ID, version int) (*Recipe, error) {
+	serial, err := accessor.serialID(*id)
+	if err != nil {
+		return nil, err
+	}
+
+	database := db.(executor)
+	before := &Recipe{}
+	err = scanRecipe(database.QueryRow("DELETE FROM recipes WHERE id=$1 AND ($2=0 OR version=$2) RETURNING "+recipeColumns, serial, version), before)
+	if err != nil {
+		return nil, accessor.versionConflict(database, serial, version, err)
+	}
+	return before, nil
+}
+
+// versionConflict return ErrVersionConflict if a versioned statement matched no row but the recipe still exists
+func (accessor *PostGresAccessor) versionConflict(db executor, id interface{}, version int, err error) error {
+	if err == sql.ErrNoRows && version > 0 {
+		var exists bool
+		if existsErr := db.QueryRow("SELECT EXISTS(SELECT 1 FROM recipes WHERE id=$1)", id).Scan(&exists); existsErr == nil && exists {
+			return ErrVersionConflict
+		}
+	}
+	return postgresError(err, "recipe", id)
 }
 
 // Create create single recipe
 func (accessor *PostGresAccessor) Create(db interface{}, recipe *Recipe) error {
-	return db.(*sql.DB).QueryRow("INSERT INTO recipes(name, prep, difficulty, vegetarian) VALUES($1, $2, $3, $4) RETURNING id", recipe.Name, recipe.Prep, recipe.Difficulty, recipe.Vegetarian).Scan(&recipe.ID)
+	recipe.CreatedAt = time.Now().UTC()
+	recipe.UpdatedAt = recipe.CreatedAt
+	err := db.(executor).QueryRow("INSERT INTO recipes(name, prep, difficulty, vegetarian, external_id, prep_minutes, cook_minutes, ingredients, created_by, updated_by, created_at, updated_at) VALUES($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, $11, $12) RETURNING id, version",
+		recipe.Name, recipe.Prep, recipe.Difficulty, recipe.Vegetarian, recipe.ExternalID, recipe.PrepMinutes, recipe.CookMinutes, pq.Array(recipe.ingredients()), recipe.CreatedBy, recipe.UpdatedBy, recipe.CreatedAt, recipe.UpdatedAt).Scan(&recipe.ID, &recipe.Version)
+	return postgresError(err, "recipe", recipe.ExternalID)
 }
 
 // List get recipe list
 func (accessor *PostGresAccessor) List(db interface{}, start, limit int) ([]*Recipe, error) {
-	recipes := []*Recipe{}
-	rows, err := db.(*sql.DB).Query("SELECT id, name, prep, difficulty, vegetarian FROM recipes LIMIT $1 OFFSET $2", limit, start)
-	defer rows.Close()
+	return queryRecipes(db.(executor), "SELECT "+recipeColumns+" FROM recipes LIMIT $1 OFFSET $2", limit, start)
+}
+
+// Rate rate recipe as the rater of ctx, the rate of a rater who rated before is updated and returned, nil for a first rate
+func (accessor *PostGresAccessor) Rate(ctx context.Context, db interface{}, id *ID, rate int) (*RecipeRate, error) {
+	user, err := RaterFrom(ctx)
 	if err != nil {
-		return recipes, err
+		return nil, err
+	}
+	recipeID, err := accessor.canonicalID(*id)
+	if err != nil {
+		return nil, err
 	}
 
+	var previous *RecipeRate
+	err = inTransaction(db, func(tx executor) error {
+		if _, err := accessor.Get(tx, id); err != nil {
+			return err
+		}
+
+		// the unique index on recipe and rater lets only one of concurrent first rates of a rater insert,
+		// the others find its rate locked and visible on the second attempt and update it
+		modified := time.Now()
+		for attempt := 0; attempt < 2; attempt++ {
+			stored := &RecipeRate{}
+			err := tx.QueryRow("SELECT id, recipeId, rate, rateuser, modified FROM reciperates WHERE recipeId=$1 AND rateuser=$2 FOR UPDATE", recipeID, user).
+				Scan(&stored.ID, &stored.RecipeID, &stored.Rate, &stored.User, &stored.Modified)
+			if err == nil {
+				previous = stored
+				_, err = tx.Exec("UPDATE reciperates SET rate=$2, modified=$3 WHERE id=$1", stored.ID, rate, modified)
+				return err
+			}
+			if err != sql.ErrNoRows {
+				return err
+			}
+
+			result, err := tx.Exec("INSERT INTO reciperates(recipeId, rate, rateuser, modified) VALUES($1, $2, $3, $4) ON CONFLICT (recipeId, rateuser) DO NOTHING", recipeID, rate, user, modified)
+			if err != nil {
+				return err
+			}
+			if inserted, err := result.RowsAffected(); err != nil || inserted == 1 {
+				return err
+			}
+		}
+		return &ConflictError{Code: "concurrent_rate", Message: "The rate of the rater changed concurrently"}
+	})
+	return previous, err
+}
+
+// Search search recipes
+func (accessor *PostGresAccessor) Search(db interface{}, search string) ([]*Recipe, error) {
+	return queryRecipes(db.(executor), "SELECT "+recipeColumns+" FROM recipes where name LIKE '%' || $1 || '%'", search)
+}
+
+// Batch apply batch operations, atomic batches run in a single transaction, the others in one transaction per operation
+// applied runs in the transaction of each applied operation
+func (accessor *PostGresAccessor) Batch(db interface{}, operations []*BatchOperation, atomic bool, applied BatchApplied) ([]*BatchResult, error) {
+	if !atomic {
+		results := make([]*BatchResult, len(operations))
+		for i, operation := range operations {
+			results[i] = &BatchResult{Index: i, Op: operation.Op}
+			err := inTransaction(db, func(tx executor) error {
+				results[i].complete(applyBatchOperation(accessor, tx, operation))
+				if results[i].Status != BatchSucceeded {
+					return results[i].err
+				}
+				return applied(tx, results[i])
+			})
+			if err != nil && results[i].Status == BatchSucceeded {
+				// applied or the commit failed, the operation has been rolled back
+				results[i].fail(err)
+			}
+		}
+		return results, nil
+	}
+
+	var results []*BatchResult
+	var failed *BatchResult
+	err := inTransaction(db, func(tx executor) error {
+		results, failed = runAtomicBatch(accessor, tx, operations, applied)
+		if failed != nil {
+			return ErrBatchAborted
+		}
+		return nil
+	})
+	if failed != nil {
+		markRolledBack(results, failed)
+	}
+	return results, err
+}
+
+// Upsert create or update recipe identified by its external id, with owner set only a recipe created by owner is updated
+// returns the recipe it replaced, nil if it created the recipe; the stored recipe is locked while its owner is checked and it is updated
+func (accessor *PostGresAccessor) Upsert(db interface{}, recipe *Recipe, owner string) (*Recipe, error) {
+	var before *Recipe
+	recipe.UpdatedAt = time.Now().UTC()
+	err := inTransaction(db, func(tx executor) error {
+		stored := &Recipe{}
+		err := scanRecipe(tx.QueryRow("SELECT "+recipeColumns+" FROM recipes WHERE external_id=$1 FOR UPDATE", recipe.ExternalID), stored)
+		if err == sql.ErrNoRows {
+			// a recipe inserted concurrently is left alone and locked by the second select
+			err = tx.QueryRow(`INSERT INTO recipes(name, prep, difficulty, vegetarian, external_id, prep_minutes, cook_minutes, ingredients, created_by, updated_by, created_at, updated_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+				ON CONFLICT (external_id) DO NOTHING RETURNING id, version`, recipe.Name, recipe.Prep, recipe.Difficulty, recipe.Vegetarian, recipe.ExternalID, recipe.PrepMinutes, recipe.CookMinutes, pq.Array(recipe.ingredients()),
+				recipe.CreatedBy, recipe.UpdatedBy, recipe.UpdatedAt).Scan(&recipe.ID, &recipe.Version)
+			if err != sql.ErrNoRows {
+				recipe.CreatedAt = recipe.UpdatedAt
+				return err
+			}
+			err = scanRecipe(tx.QueryRow("SELECT "+recipeColumns+" FROM recipes WHERE external_id=$1 FOR UPDATE", recipe.ExternalID), stored)
+		}
+		if err != nil {
+			return err
+		}
+		if owner != "" && stored.CreatedBy != owner {
+			return ErrNotOwner
+		}
+
+		// updates keep the author of the recipe
+		before = stored
+		recipe.ID, recipe.CreatedBy, recipe.CreatedAt = stored.ID, stored.CreatedBy, stored.CreatedAt
+		return tx.QueryRow("UPDATE recipes SET name=$1, prep=$2, difficulty=$3, vegetarian=$4, prep_minutes=$6, cook_minutes=$7, ingredients=$8, updated_by=$9, updated_at=$10, version=version+1 WHERE id=$5 RETURNING version",
+			recipe.Name, recipe.Prep, recipe.Difficulty, recipe.Vegetarian, stored.ID, recipe.PrepMinutes, recipe.CookMinutes, pq.Array(recipe.ingredients()), recipe.UpdatedBy, recipe.UpdatedAt).Scan(&recipe.Version)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return before, nil
+}
+
+// Transaction run fn with a transaction of db, committed unless fn fails, fn runs in the transaction db is already in
+func (accessor *PostGresAccessor) Transaction(db interface{}, fn func(db interface{}) error) error {
+	return inTransaction(db, func(tx executor) error {
+		return fn(tx)
+	})
+}
+
+// inTransaction run fn in a transaction begun on db unless db already is one, rolled back when fn fails
+func inTransaction(db interface{}, fn func(tx executor) error) error {
+	database, ok := db.(*sql.DB)
+	if !ok {
+		return fn(db.(executor))
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Export call fn for every recipe while iterating the table
+func (accessor *PostGresAccessor) Export(db interface{}, fn func(*Recipe) error) error {
+	rows, err := db.(executor).Query("SELECT " + recipeColumns + " FROM recipes ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
 	for rows.Next() {
 		recipe := Recipe{}
-		if err := rows.Scan(&recipe.ID, &recipe.Name, &recipe.Prep, &recipe.Difficulty, &recipe.Vegetarian); err != nil {
+		if err := scanRecipe(rows, &recipe); err != nil {
+			return err
+		}
+		if err := fn(&recipe); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Ratings get ratings of recipe
+func (accessor *PostGresAccessor) Ratings(db interface{}, id *ID) ([]*RecipeRate, error) {
+	recipeID, err := accessor.canonicalID(*id)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := []*RecipeRate{}
+	rows, err := db.(executor).Query("SELECT id, recipeId, rate, rateuser, modified FROM reciperates WHERE recipeId=$1 ORDER BY modified", recipeID)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rate := RecipeRate{}
+		if err := rows.Scan(&rate.ID, &rate.RecipeID, &rate.Rate, &rate.User, &rate.Modified); err != nil {
 			return nil, err
 		}
-		recipes = append(recipes, &recipe)
+		rates = append(rates, &rate)
 	}
 
-	return recipes, nil
+	return rates, rows.Err()
 }
 
-// Rate rate recipe
-func (accessor *PostGresAccessor) Rate(db interface{}, id *ID, rate int) error {
-	_, err := db.(*sql.DB).Exec("INSERT INTO reciperates(recipeId, rate, rateuser, modified) VALUES($1, $2, $3, $4) RETURNING id", fmt.Sprintf("%s", *id), rate, "Jane Doe" /*dummy or use ip*/, time.Now())
+// likeEscaper escape the wildcards of LIKE patterns so names are matched literally, as by the MongoDB accessor
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Find list recipes matching filter ordered by id
+func (accessor *PostGresAccessor) Find(db interface{}, filter *RecipeFilter, start, limit int) ([]*Recipe, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Vegetarian != nil {
+		where("vegetarian = $%d", *filter.Vegetarian)
+	}
+	if filter.Difficulty != 0 {
+		where("difficulty = $%d", filter.Difficulty)
+	}
+	if filter.MaxTotalMinutes > 0 {
+		where("prep_minutes + cook_minutes <= $%d", filter.MaxTotalMinutes)
+	}
+	if filter.Name != "" {
+		where("name ILIKE '%%' || $%d || '%%'", likeEscaper.Replace(filter.Name))
+	}
+	if filter.CreatedBy != "" {
+		where("created_by = $%d", filter.CreatedBy)
+	}
+	if filter.ExternalID != "" {
+		where("external_id = $%d", filter.ExternalID)
+	}
+
+	query := "SELECT " + recipeColumns + " FROM recipes"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit, start)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return queryRecipes(db.(executor), query, args...)
+}
+
+// RatingsOf get ratings of several recipes in one query, keyed by the ids as given
+func (accessor *PostGresAccessor) RatingsOf(db interface{}, ids []ID) (map[ID][]*RecipeRate, error) {
+	ratings := map[ID][]*RecipeRate{}
+	given := map[string][]ID{}
+	keys := []string{}
+	for _, id := range ids {
+		ratings[id] = []*RecipeRate{}
+		// malformed ids have no ratings
+		if key, err := accessor.canonicalID(id); err == nil {
+			given[key] = append(given[key], id)
+			keys = append(keys, key)
+		}
+	}
+
+	rows, err := db.(executor).Query("SELECT id, recipeId, rate, rateuser, modified FROM reciperates WHERE recipeId = ANY($1) ORDER BY modified", pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rate := RecipeRate{}
+		if err := rows.Scan(&rate.ID, &rate.RecipeID, &rate.Rate, &rate.User, &rate.Modified); err != nil {
+			return nil, err
+		}
+		for _, id := range given[rate.RecipeID] {
+			ratings[id] = append(ratings[id], &rate)
+		}
+	}
+
+	return ratings, rows.Err()
+}
+
+// ReserveIdempotencyKey insert in progress record
+// expired records of every key and an abandoned reservation of the key are purged first
+func (accessor *PostGresAccessor) ReserveIdempotencyKey(db interface{}, record *IdempotencyRecord) error {
+	_, err := db.(executor).Exec("DELETE FROM idempotency_keys WHERE created < $1 OR (key=$2 AND status=0 AND created < $3)",
+		record.Created.Add(-IdempotencyKeyTTL), record.Key, record.Created.Add(-IdempotencyReservationTimeout))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.(executor).Exec("INSERT INTO idempotency_keys(key, request_hash, status, created) VALUES($1, $2, 0, $3)", record.Key, record.RequestHash, record.Created)
+	if _, ok := postgresError(err, "idempotency_key", record.Key).(*ConflictError); ok {
+		return ErrIdempotencyKeyInUse
+	}
 	return err
 }
 
-// Search search recipes
-func (accessor *PostGresAccessor) Search(db interface{}, search string) ([]*Recipe, error) {
-	recipes := []*Recipe{}
-	rows, err := db.(*sql.DB).Query("SELECT id, name, prep, difficulty, vegetarian FROM recipes where name LIKE '%' || $1 || '%'", search)
+// GetIdempotencyKey get unexpired record of key
+func (accessor *PostGresAccessor) GetIdempotencyKey(db interface{}, key string) (*IdempotencyRecord, error) {
+	record := &IdempotencyRecord{}
+	var header string
+	err := db.(executor).QueryRow("SELECT key, request_hash, status, header, body, created FROM idempotency_keys WHERE key=$1 AND created >= $2",
+		key, time.Now().UTC().Add(-IdempotencyKeyTTL)).Scan(&record.Key, &record.RequestHash, &record.Status, &header, &record.Body, &record.Created)
+	if err != nil {
+		return nil, postgresError(err, "idempotency_key", key)
+	}
+
+	if err := json.Unmarshal([]byte(header), &record.Header); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// CompleteIdempotencyKey store response of the reserved record
+func (accessor *PostGresAccessor) CompleteIdempotencyKey(db interface{}, record *IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.(executor).Exec("UPDATE idempotency_keys SET status=$2, header=$3, body=$4 WHERE key=$1", record.Key, record.Status, string(header), record.Body)
+	return err
+}
+
+// ReleaseIdempotencyKey delete record of key
+func (accessor *PostGresAccessor) ReleaseIdempotencyKey(db interface{}, key string) error {
+	_, err := db.(executor).Exec("DELETE FROM idempotency_keys WHERE key=$1", key)
+	return err
+}
+
+// CreateUser insert user, the username is unique
+func (accessor *PostGresAccessor) CreateUser(db interface{}, user *User) error {
+	var id int64
+	err := db.(executor).QueryRow("INSERT INTO users(username, password_hash, roles, created) VALUES($1, $2, $3, $4) RETURNING id",
+		user.Username, user.PasswordHash, pq.Array(user.Roles), user.Created).Scan(&id)
+	if err != nil {
+		return postgresError(err, "user", user.Username)
+	}
+	user.ID = id
+	return nil
+}
+
+// GetUserByName get user by username
+func (accessor *PostGresAccessor) GetUserByName(db interface{}, username string) (*User, error) {
+	user := &User{}
+	var id int64
+	err := db.(executor).QueryRow("SELECT id, username, password_hash, roles, created FROM users WHERE username=$1", username).
+		Scan(&id, &user.Username, &user.PasswordHash, pq.Array(&user.Roles), &user.Created)
+	if err != nil {
+		return nil, postgresError(err, "user", username)
+	}
+	user.ID = id
+	return user, nil
+}
+
+// apiKeyColumns columns read by scanAPIKey
+const apiKeyColumns = "id, name, prefix, key_hash, scopes, created_by, created, expires, last_used, revoked"
+
+// scanAPIKey scan apiKeyColumns into key
+func scanAPIKey(row rowScanner, key *APIKey) error {
+	var id int64
+	var expires, lastUsed, revoked pq.NullTime
+	if err := row.Scan(&id, &key.Name, &key.Prefix, &key.KeyHash, pq.Array(&key.Scopes), &key.CreatedBy, &key.Created, &expires, &lastUsed, &revoked); err != nil {
+		return err
+	}
+
+	key.ID = id
+	key.Expires = nullTime(expires)
+	key.LastUsed = nullTime(lastUsed)
+	key.Revoked = nullTime(revoked)
+	return nil
+}
+
+// nullTime time of a nullable column, nil for NULL
+func nullTime(value pq.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
+// CreateAPIKey insert key
+func (accessor *PostGresAccessor) CreateAPIKey(db interface{}, key *APIKey) error {
+	var id int64
+	err := db.(executor).QueryRow("INSERT INTO api_keys(name, prefix, key_hash, scopes, created_by, created, expires) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id",
+		key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.CreatedBy, key.Created, key.Expires).Scan(&id)
+	if err != nil {
+		return postgresError(err, "api_key", key.Prefix)
+	}
+	key.ID = id
+	return nil
+}
+
+// ListAPIKeys get every key ordered by id
+func (accessor *PostGresAccessor) ListAPIKeys(db interface{}) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	rows, err := db.(executor).Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id")
+	if err != nil {
+		return keys, err
+	}
 	defer rows.Close()
+
+	for rows.Next() {
+		key := &APIKey{}
+		if err := scanAPIKey(rows, key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash get key by the hash of its secret
+func (accessor *PostGresAccessor) GetAPIKeyByHash(db interface{}, hash string) (*APIKey, error) {
+	key := &APIKey{}
+	if err := scanAPIKey(db.(executor).QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash=$1", hash), key); err != nil {
+		return nil, postgresError(err, "api_key", "")
+	}
+	return key, nil
+}
+
+// RevokeAPIKey set revoked of key with id, keys revoked before keep their revocation time
+func (accessor *PostGresAccessor) RevokeAPIKey(db interface{}, id string, revoked time.Time) (*APIKey, error) {
+	serial, err := strconv.ParseInt(id, 10, 32)
 	if err != nil {
-		return recipes, err
+		return nil, &NotFoundError{Resource: "api_key", ID: id}
+	}
+
+	key := &APIKey{}
+	err = scanAPIKey(db.(executor).QueryRow("UPDATE api_keys SET revoked=COALESCE(revoked, $2) WHERE id=$1 RETURNING "+apiKeyColumns, serial, revoked), key)
+	if err != nil {
+		return nil, postgresError(err, "api_key", id)
+	}
+	return key, nil
+}
+
+// TouchAPIKey set last_used of key with id
+func (accessor *PostGresAccessor) TouchAPIKey(db interface{}, id string, used time.Time) error {
+	_, err := db.(executor).Exec("UPDATE api_keys SET last_used=$2 WHERE id=$1", id, used)
+	return err
+}
+
+// StoreRefreshToken insert token, expired tokens are deleted first
+func (accessor *PostGresAccessor) StoreRefreshToken(db interface{}, token *RefreshToken) error {
+	if _, err := db.(executor).Exec("DELETE FROM refresh_tokens WHERE expires < now()"); err != nil {
+		return err
+	}
+
+	_, err := db.(executor).Exec("INSERT INTO refresh_tokens(id, subject, expires) VALUES($1, $2, $3)", token.ID, token.Subject, token.Expires)
+	return err
+}
+
+// ConsumeRefreshToken delete the unexpired token of id, false if there is none
+func (accessor *PostGresAccessor) ConsumeRefreshToken(db interface{}, id string) (bool, error) {
+	result, err := db.(executor).Exec("DELETE FROM refresh_tokens WHERE id=$1 AND expires > now()", id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted == 1, err
+}
+
+// RevokeRefreshTokens delete the tokens of subject
+func (accessor *PostGresAccessor) RevokeRefreshTokens(db interface{}, subject string) error {
+	_, err := db.(executor).Exec("DELETE FROM refresh_tokens WHERE subject=$1", subject)
+	return err
+}
+
+// AppendAudit insert entry
+func (accessor *PostGresAccessor) AppendAudit(db interface{}, entry *AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	var id int64
+	err = db.(executor).QueryRow("INSERT INTO audit_log(recipe_id, action, user_id, client_ip, created, changes) VALUES($1, $2, $3, $4, $5, $6) RETURNING id",
+		entry.RecipeID, entry.Action, entry.User, entry.ClientIP, entry.Time, changes).Scan(&id)
+	if err != nil {
+		return err
 	}
+	entry.ID = id
+	return nil
+}
+
+// FindAudit list entries matching filter ordered by id
+func (accessor *PostGresAccessor) FindAudit(db interface{}, filter *AuditFilter, start, limit int) ([]*AuditEntry, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.RecipeID != "" {
+		where("recipe_id = $%d", filter.RecipeID)
+	}
+	if filter.User != "" {
+		where("user_id = $%d", filter.User)
+	}
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		where("created >= $%d", filter.Since)
+	}
+
+	query := "SELECT id, recipe_id, action, user_id, client_ip, created, changes FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit, start)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	entries := []*AuditEntry{}
+	rows, err := db.(executor).Query(query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
 
 	for rows.Next() {
-		recipe := Recipe{}
-		if err := rows.Scan(&recipe.ID, &recipe.Name, &recipe.Prep, &recipe.Difficulty, &recipe.Vegetarian); err != nil {
+		var id int64
+		var changes []byte
+		entry := &AuditEntry{}
+		if err := rows.Scan(&id, &entry.RecipeID, &entry.Action, &entry.User, &entry.ClientIP, &entry.Time, &changes); err != nil {
 			return nil, err
 		}
-		recipes = append(recipes, &recipe)
+		entry.ID = id
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
 	}
 
-	return recipes, nil
+	return entries, rows.Err()
 }
@@ -2,9 +2,15 @@
 package model
 
 import (
+	"context"
+	"fmt"
 	"hellofresh/config"
 	"hellofresh/util"
+	"strconv"
+	"strings"
 	"time"
+
+	"gopkg.in/mgo.v2/bson"
 )
 
 // Difficulty three level of difficulties
@@ -30,6 +36,53 @@ type Recipe struct {
 	Prep       time.Time   `json:"prep"`
 	Difficulty Difficulty  `json:"difficulty"`
 	Vegetarian bool        `json:"vegetarian"`
+	// Version incremented on every update, used for optimistic concurrency
+	Version int `json:"version" bson:"version"`
+	// ExternalID id of the recipe in an external system, used to upsert on import
+	ExternalID string `json:"externalId,omitempty" bson:"externalId,omitempty"`
+	// PrepMinutes preparation time in minutes
+	PrepMinutes int `json:"prepMinutes" bson:"prepMinutes"`
+	// CookMinutes cooking time in minutes
+	CookMinutes int `json:"cookMinutes" bson:"cookMinutes"`
+	// Ingredients ingredient lines, e.g. "200g spaghetti"
+	Ingredients []string `json:"ingredients" bson:"ingredients"`
+	// CreatedBy id of the user who created the recipe, empty for recipes created before authorship was tracked
+	// the authorship fields are only part of the v2 representation, the v1 shape is unchanged
+	CreatedBy string `json:"-" bson:"createdBy,omitempty"`
+	// UpdatedBy id of the user who last created or updated the recipe
+	UpdatedBy string `json:"-" bson:"updatedBy,omitempty"`
+	// CreatedAt and UpdatedAt are set by the accessors, zero for recipes created before authorship was tracked
+	CreatedAt time.Time `json:"-" bson:"createdAt,omitempty"`
+	UpdatedAt time.Time `json:"-" bson:"updatedAt,omitempty"`
+}
+
+// Recipes recipe list
+type Recipes []*Recipe
+
+// MarshalCSV recipe list as CSV records with header, ingredients are separated by "|"
+func (recipes Recipes) MarshalCSV() ([][]string, error) {
+	records := [][]string{{"id", "name", "prep", "difficulty", "vegetarian", "version", "externalId", "prepMinutes", "cookMinutes", "ingredients"}}
+	for _, recipe := range recipes {
+		records = append(records, []string{
+			string(recipe.RecipeID()),
+			recipe.Name,
+			recipe.Prep.Format(time.RFC3339),
+			strconv.Itoa(int(recipe.Difficulty)),
+			strconv.FormatBool(recipe.Vegetarian),
+			strconv.Itoa(recipe.Version),
+			recipe.ExternalID,
+			strconv.Itoa(recipe.PrepMinutes),
+			strconv.Itoa(recipe.CookMinutes),
+			strings.Join(recipe.Ingredients, "|"),
+		})
+	}
+	return records, nil
+}
+
+// ExportRecipe recipe line of the NDJSON export
+type ExportRecipe struct {
+	*Recipe
+	Ratings []*RecipeRate `json:"ratings,omitempty"`
 }
 
 // accessor database accessor
@@ -47,24 +100,102 @@ func init() {
 	}
 }
 
+// SetAccessor use a as database accessor, e.g. a stub in tests without database, returns the accessor it replaces
+func SetAccessor(a RecipeRestFulAccessor) RecipeRestFulAccessor {
+	previous := accessor
+	accessor = a
+	return previous
+}
+
+// EnsureSchema create missing tables and indexes and migrate data stored by older releases
+func EnsureSchema(db interface{}) error {
+	return accessor.EnsureSchema(db)
+}
+
+// AuthoredBy set userID as author of the next write, CreatedBy is only stored when the recipe is created
+func (recipe *Recipe) AuthoredBy(userID string) {
+	recipe.CreatedBy = userID
+	recipe.UpdatedBy = userID
+}
+
+// OwnedBy recipe has been created by userID, recipes without author are owned by nobody
+func (recipe *Recipe) OwnedBy(userID string) bool {
+	return recipe.CreatedBy != "" && recipe.CreatedBy == userID
+}
+
+// RecipeID id of a stored recipe, ID is a bson.ObjectId on mongodb and an integer on postgres
+func (recipe *Recipe) RecipeID() ID {
+	if objectID, ok := recipe.ID.(bson.ObjectId); ok {
+		return ID(objectID.Hex())
+	}
+	return ID(fmt.Sprintf("%v", recipe.ID))
+}
+
+// ingredients never nil, so NOT NULL columns receive an empty list
+func (recipe *Recipe) ingredients() []string {
+	if recipe.Ingredients == nil {
+		return []string{}
+	}
+	return recipe.Ingredients
+}
+
+// Parse parse id into the primary key of the backend, InvalidIDError if it is malformed
+func (id *ID) Parse() (interface{}, error) {
+	return accessor.ParseID(*id)
+}
+
+// Canonical id as the backend stores it, "007" is recipe "7" on postgres and hex digits are lower case on mongodb
+func (id *ID) Canonical() (ID, error) {
+	parsed, err := accessor.ParseID(*id)
+	if err != nil {
+		return "", err
+	}
+	switch parsed := parsed.(type) {
+	case int64:
+		return ID(strconv.FormatInt(parsed, 10)), nil
+	case bson.ObjectId:
+		return ID(parsed.Hex()), nil
+	}
+	return *id, nil
+}
+
 // GetRecipe get single recipe
 func (id *ID) GetRecipe(db interface{}) (*Recipe, error) {
 	return accessor.Get(db, id)
 }
 
-// UpdateRecipe update single recipe
-func (recipe *Recipe) UpdateRecipe(db interface{}) error {
-	return accessor.Update(db, recipe)
+// UpdateRecipe update single recipe as the principal of ctx, the change is audited in the same transaction
+// if recipe.Version is set, update only succeeds when the stored version matches
+func (recipe *Recipe) UpdateRecipe(ctx context.Context, db interface{}) error {
+	return accessor.Transaction(db, func(db interface{}) error {
+		before, err := accessor.Update(db, recipe)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, db, AuditUpdate, recipe.RecipeID(), diff(before, recipe))
+	})
 }
 
-// DeleteRecipe delete single recipe
-func (id *ID) DeleteRecipe(db interface{}) error {
-	return accessor.Delete(db, id)
+// DeleteRecipe delete single recipe as the principal of ctx, the deleted fields are audited in the same transaction
+// if version is set, delete only succeeds when the stored version matches
+func (id *ID) DeleteRecipe(ctx context.Context, db interface{}, version int) error {
+	return accessor.Transaction(db, func(db interface{}) error {
+		before, err := accessor.Delete(db, id, version)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, db, AuditDelete, before.RecipeID(), diff(before, nil))
+	})
 }
 
-// CreateRecipe create single recipe
-func (recipe *Recipe) CreateRecipe(db interface{}) error {
-	return accessor.Create(db, recipe)
+// CreateRecipe create single recipe as the principal of ctx, the creation is audited in the same transaction
+func (recipe *Recipe) CreateRecipe(ctx context.Context, db interface{}) error {
+	return accessor.Transaction(db, func(db interface{}) error {
+		if err := accessor.Create(db, recipe); err != nil {
+			return err
+		}
+		return audit(ctx, db, AuditCreate, recipe.RecipeID(), diff(nil, recipe))
+	})
 }
 
 // GetRecipes get recipe list
@@ -72,12 +203,77 @@ func (recipe *Recipe) GetRecipes(db interface{}, start, limit int) ([]*Recipe, e
 	return accessor.List(db, start, limit)
 }
 
-// RateRecipe rate recipe
-func (id *ID) RateRecipe(db interface{}, rate int) error {
-	return accessor.Rate(db, id, rate)
+// RateRecipe rate recipe as the rater of ctx, rating again replaces the previous rate of the rater
+// the rate is audited with the previous one in the same transaction
+func (id *ID) RateRecipe(ctx context.Context, db interface{}, rate int) error {
+	canonical, err := id.Canonical()
+	if err != nil {
+		return err
+	}
+
+	return accessor.Transaction(db, func(db interface{}) error {
+		previous, err := accessor.Rate(ctx, db, &canonical, rate)
+		if err != nil {
+			return err
+		}
+
+		change := &AuditChange{Field: "rate", After: rate}
+		if previous != nil {
+			change.Before = previous.Rate
+		}
+		return audit(ctx, db, AuditRate, canonical, []*AuditChange{change})
+	})
 }
 
 // SearchRecipes search recipes
 func (recipe *Recipe) SearchRecipes(db interface{}, search string) ([]*Recipe, error) {
 	return accessor.Search(db, search)
 }
+
+// BatchRecipes apply create, update and delete operations in one batch as the principal of ctx
+// atomic batches are all-or-nothing and return ErrBatchAborted when rolled back, every applied operation is audited
+func (recipe *Recipe) BatchRecipes(ctx context.Context, db interface{}, operations []*BatchOperation, atomic bool) ([]*BatchResult, error) {
+	return accessor.Batch(db, operations, atomic, func(db interface{}, result *BatchResult) error {
+		switch {
+		case result.Op == BatchDelete:
+			return audit(ctx, db, AuditDelete, result.Before.RecipeID(), diff(result.Before, nil))
+		case result.Before == nil:
+			return audit(ctx, db, AuditCreate, result.Recipe.RecipeID(), diff(nil, result.Recipe))
+		default:
+			return audit(ctx, db, AuditUpdate, result.Recipe.RecipeID(), diff(result.Before, result.Recipe))
+		}
+	})
+}
+
+// UpsertRecipe create or update recipe by its external id as the principal of ctx, returns true if created
+// with owner set only a recipe created by owner is updated, ErrNotOwner otherwise; the creation or the change is audited in the same transaction
+func (recipe *Recipe) UpsertRecipe(ctx context.Context, db interface{}, owner string) (bool, error) {
+	var created bool
+	err := accessor.Transaction(db, func(db interface{}) error {
+		before, err := accessor.Upsert(db, recipe, owner)
+		if err != nil {
+			return err
+		}
+
+		created = before == nil
+		if created {
+			return audit(ctx, db, AuditCreate, recipe.RecipeID(), diff(nil, recipe))
+		}
+		return audit(ctx, db, AuditUpdate, recipe.RecipeID(), diff(before, recipe))
+	})
+	return created, err
+}
+
+// ExportRecipes call fn for every recipe without loading the whole collection
+func (recipe *Recipe) ExportRecipes(db interface{}, fn func(*Recipe) error) error {
+	return accessor.Export(db, fn)
+}
+
+// GetRatings get ratings of recipe, whichever form of its id is given
+func (id *ID) GetRatings(db interface{}) ([]*RecipeRate, error) {
+	canonical, err := id.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	return accessor.Ratings(db, &canonical)
+}
@@ -0,0 +1,163 @@
+package model
+
+import (
+	"errors"
+)
+
+// batch operation types
+const (
+	// BatchCreate create recipe
+	BatchCreate = "create"
+	// BatchUpdate update recipe
+	BatchUpdate = "update"
+	// BatchDelete delete recipe
+	BatchDelete = "delete"
+	// BatchUpsert create or update recipe by its external id, used by imports rather than the batch endpoint
+	BatchUpsert = "upsert"
+)
+
+// batch result status
+const (
+	// BatchSucceeded operation applied
+	BatchSucceeded = "succeeded"
+	// BatchFailed operation failed
+	BatchFailed = "failed"
+	// BatchSkipped operation not run because an earlier operation of an atomic batch failed
+	BatchSkipped = "skipped"
+	// BatchRolledBack operation applied and reverted afterwards
+	BatchRolledBack = "rolledback"
+	// BatchRollbackFailed operation applied but could not be reverted
+	BatchRollbackFailed = "rollbackfailed"
+)
+
+// ErrBatchAborted atomic batch has been aborted and rolled back
+var ErrBatchAborted = errors.New("Batch aborted")
+
+// ErrUnknownBatchOperation operation type is not create, update or delete
+var ErrUnknownBatchOperation = errors.New("Unknown batch operation")
+
+// ErrMissingBatchRecipe create or update operation without recipe
+var ErrMissingBatchRecipe = errors.New("Missing recipe in batch operation")
+
+// BatchOperation single operation of a batch request
+type BatchOperation struct {
+	// Op create, update or delete
+	Op string `json:"op"`
+	// ID recipe id for update and delete
+	ID string `json:"id,omitempty"`
+	// Version expected version for update and delete, 0 for unconditional
+	Version int `json:"version,omitempty"`
+	// Recipe payload for create and update
+	Recipe *Recipe `json:"recipe,omitempty"`
+	// Owner restricts an upsert to a recipe created by this user id, empty for none
+	Owner string `json:"-"`
+}
+
+// BatchResult outcome of a single batch operation
+type BatchResult struct {
+	Index  int     `json:"index"`
+	Op     string  `json:"op"`
+	Status string  `json:"status"`
+	Recipe *Recipe `json:"recipe,omitempty"`
+	Error  string  `json:"error,omitempty"`
+	// Before stored recipe the operation replaced or deleted, nil for creates
+	Before *Recipe `json:"-"`
+	// err cause of a failed operation
+	err error
+}
+
+// BatchApplied called with every applied operation of a batch and the database it was applied with
+// on postgres it runs in the transaction of the operation, so an error reverts the operation; on mongodb it fails the batch
+type BatchApplied func(db interface{}, result *BatchResult) error
+
+// Err cause of a failed operation, nil unless failed
+func (result *BatchResult) Err() error {
+	return result.err
+}
+
+// complete record the outcome of the operation, before is the recipe it replaced or deleted
+func (result *BatchResult) complete(recipe, before *Recipe, err error) {
+	if err != nil {
+		result.fail(err)
+		return
+	}
+
+	result.Status = BatchSucceeded
+	result.Recipe = recipe
+	result.Before = before
+}
+
+// fail record err as the outcome of the operation
+func (result *BatchResult) fail(err error) {
+	result.Status = BatchFailed
+	result.Error = err.Error()
+	result.err = err
+}
+
+// applyBatchOperation apply single operation with accessor, returns the recipe after and before the operation
+func applyBatchOperation(accessor RecipeRestFulAccessor, db interface{}, operation *BatchOperation) (*Recipe, *Recipe, error) {
+	switch operation.Op {
+	case BatchCreate, BatchUpdate, BatchUpsert:
+		if operation.Recipe == nil {
+			return nil, nil, ErrMissingBatchRecipe
+		}
+
+		recipe := *operation.Recipe
+		switch operation.Op {
+		case BatchCreate:
+			recipe.ID = nil
+			err := accessor.Create(db, &recipe)
+			return &recipe, nil, err
+		case BatchUpsert:
+			recipe.ID = nil
+			before, err := accessor.Upsert(db, &recipe, operation.Owner)
+			return &recipe, before, err
+		}
+
+		recipe.ID = operation.ID
+		recipe.Version = operation.Version
+		before, err := accessor.Update(db, &recipe)
+		return &recipe, before, err
+
+	case BatchDelete:
+		id := ID(operation.ID)
+		before, err := accessor.Delete(db, &id, operation.Version)
+		return nil, before, err
+
+	default:
+		return nil, nil, ErrUnknownBatchOperation
+	}
+}
+
+// runAtomicBatch apply operations until the first failure, remaining operations are skipped
+// applied is called after each applied operation, unless nil, its error fails the operation
+// returns the failed result, nil if every operation succeeded
+func runAtomicBatch(accessor RecipeRestFulAccessor, db interface{}, operations []*BatchOperation, applied BatchApplied) ([]*BatchResult, *BatchResult) {
+	results := make([]*BatchResult, len(operations))
+	var failed *BatchResult
+	for i, operation := range operations {
+		results[i] = &BatchResult{Index: i, Op: operation.Op}
+		if failed != nil {
+			results[i].Status = BatchSkipped
+			continue
+		}
+
+		results[i].complete(applyBatchOperation(accessor, db, operation))
+		if results[i].Status == BatchSucceeded && applied != nil {
+			if err := applied(db, results[i]); err != nil {
+				results[i].fail(err)
+			}
+		}
+		if results[i].Status == BatchFailed {
+			failed = results[i]
+		}
+	}
+	return results, failed
+}
+
+// markRolledBack mark operations applied before the failed one as rolled back
+func markRolledBack(results []*BatchResult, failed *BatchResult) {
+	for _, result := range results[:failed.Index] {
+		result.Status = BatchRolledBack
+	}
+}
@@ -0,0 +1,28 @@
+package model
+
+// RecipeFilter criteria recipes are listed by, zero values match every recipe
+type RecipeFilter struct {
+	// Vegetarian only vegetarian or only non vegetarian recipes when set
+	Vegetarian *bool
+	// Difficulty only recipes of this difficulty when set
+	Difficulty Difficulty
+	// MaxTotalMinutes only recipes with preparation and cooking time up to this when set
+	MaxTotalMinutes int
+	// Name only recipes whose name contains this, case insensitive
+	Name string
+	// CreatedBy only recipes created by this user id when set
+	CreatedBy string
+	// ExternalID only the recipe with this external id when set
+	ExternalID string
+}
+
+// FindRecipes list recipes matching filter
+func (recipe *Recipe) FindRecipes(db interface{}, filter *RecipeFilter, start, limit int) ([]*Recipe, error) {
+	return accessor.Find(db, filter, start, limit)
+}
+
+// GetRatingsOf get ratings of several recipes in one lookup, keyed by recipe id
+// recipes without ratings map to an empty list
+func (recipe *Recipe) GetRatingsOf(db interface{}, ids []ID) (map[ID][]*RecipeRate, error) {
+	return accessor.RatingsOf(db, ids)
+}
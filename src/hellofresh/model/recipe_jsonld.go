@@ -0,0 +1,293 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaContext JSON-LD context of schema.org documents
+const schemaContext = "https://schema.org"
+
+// vegetarianDiet schema.org RestrictedDiet for vegetarian recipes
+const vegetarianDiet = "https://schema.org/VegetarianDiet"
+
+// ErrNoSchemaRecipe JSON-LD document does not contain a schema.org Recipe
+var ErrNoSchemaRecipe = errors.New("No schema.org Recipe found")
+
+// ErrInvalidDuration duration is not an ISO 8601 duration
+var ErrInvalidDuration = errors.New("Invalid ISO 8601 duration")
+
+// isoDuration ISO 8601 duration, only days, hours, minutes and seconds are meaningful for recipes
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// SchemaRecipe schema.org/Recipe JSON-LD document
+type SchemaRecipe struct {
+	Context          string           `json:"@context"`
+	Type             string           `json:"@type"`
+	ID               string           `json:"@id,omitempty"`
+	Identifier       string           `json:"identifier,omitempty"`
+	Name             string           `json:"name"`
+	DatePublished    string           `json:"datePublished,omitempty"`
+	EducationalLevel string           `json:"educationalLevel,omitempty"`
+	SuitableForDiet  string           `json:"suitableForDiet,omitempty"`
+	PrepTime         string           `json:"prepTime,omitempty"`
+	CookTime         string           `json:"cookTime,omitempty"`
+	TotalTime        string           `json:"totalTime,omitempty"`
+	RecipeIngredient []string         `json:"recipeIngredient,omitempty"`
+	AggregateRating  *AggregateRating `json:"aggregateRating,omitempty"`
+}
+
+// AggregateRating schema.org/AggregateRating computed from recipe rates
+type AggregateRating struct {
+	Type        string  `json:"@type"`
+	RatingValue float64 `json:"ratingValue"`
+	RatingCount int     `json:"ratingCount"`
+	BestRating  int     `json:"bestRating"`
+	WorstRating int     `json:"worstRating"`
+}
+
+// String difficulty name
+func (difficulty Difficulty) String() string {
+	switch difficulty {
+	case Easy:
+		return "Easy"
+	case Normal:
+		return "Normal"
+	case Hard:
+		return "Hard"
+	default:
+		return strconv.Itoa(int(difficulty))
+	}
+}
+
+// ParseDifficulty parse difficulty name, common synonyms of educational levels are accepted
+func ParseDifficulty(name string) (Difficulty, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "easy", "beginner", "1":
+		return Easy, true
+	case "normal", "medium", "intermediate", "2":
+		return Normal, true
+	case "hard", "difficult", "advanced", "expert", "3":
+		return Hard, true
+	default:
+		return 0, false
+	}
+}
+
+// NewAggregateRating aggregate rates, nil if recipe has not been rated
+func NewAggregateRating(rates []*RecipeRate) *AggregateRating {
+	if len(rates) == 0 {
+		return nil
+	}
+
+	sum := 0
+	for _, rate := range rates {
+		sum += rate.Rate
+	}
+	average := float64(sum) / float64(len(rates))
+	return &AggregateRating{
+		Type:        "AggregateRating",
+		RatingValue: math.Floor(average*10+0.5) / 10,
+		RatingCount: len(rates),
+		BestRating:  5,
+		WorstRating: 1,
+	}
+}
+
+// NewSchemaRecipe map recipe and its rates to schema.org Recipe
+func NewSchemaRecipe(recipe *Recipe, rates []*RecipeRate, url string) *SchemaRecipe {
+	schema := &SchemaRecipe{
+		Context:          schemaContext,
+		Type:             "Recipe",
+		ID:               url,
+		Identifier:       string(recipe.RecipeID()),
+		Name:             recipe.Name,
+		EducationalLevel: recipe.Difficulty.String(),
+		PrepTime:         FormatDuration(recipe.PrepMinutes),
+		CookTime:         FormatDuration(recipe.CookMinutes),
+		TotalTime:        FormatDuration(recipe.PrepMinutes + recipe.CookMinutes),
+		RecipeIngredient: recipe.Ingredients,
+		AggregateRating:  NewAggregateRating(rates),
+	}
+
+	if !recipe.Prep.IsZero() {
+		schema.DatePublished = recipe.Prep.Format("2006-01-02")
+	}
+	if recipe.Vegetarian {
+		schema.SuitableForDiet = vegetarianDiet
+	}
+	return schema
+}
+
+// FormatDuration format minutes as ISO 8601 duration, empty for 0
+func FormatDuration(minutes int) string {
+	if minutes <= 0 {
+		return ""
+	}
+
+	hours, minutes := minutes/60, minutes%60
+	duration := "PT"
+	if hours > 0 {
+		duration += fmt.Sprintf("%dH", hours)
+	}
+	if minutes > 0 {
+		duration += fmt.Sprintf("%dM", minutes)
+	}
+	return duration
+}
+
+// ParseDuration parse ISO 8601 duration into minutes, seconds are rounded up
+func ParseDuration(duration string) (int, error) {
+	duration = strings.ToUpper(strings.TrimSpace(duration))
+	match := isoDuration.FindStringSubmatch(duration)
+	if match == nil || duration == "P" || strings.HasSuffix(duration, "T") {
+		return 0, ErrInvalidDuration
+	}
+
+	parts := make([]int, 4)
+	for i, value := range match[1:] {
+		if value != "" {
+			parts[i], _ = strconv.Atoi(value)
+		}
+	}
+
+	days, hours, minutes, seconds := parts[0], parts[1], parts[2], parts[3]
+	return days*24*60 + hours*60 + minutes + (seconds+59)/60, nil
+}
+
+// ParseSchemaRecipes parse every schema.org Recipe of a JSON-LD document
+// the document can be a single node, an array of nodes or a node with @graph
+func ParseSchemaRecipes(data []byte) ([]*Recipe, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	recipes := []*Recipe{}
+	for _, node := range schemaNodes(document) {
+		if !isSchemaRecipe(node) {
+			continue
+		}
+
+		recipe, err := schemaNodeToRecipe(node)
+		if err != nil {
+			return nil, err
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	if len(recipes) == 0 {
+		return nil, ErrNoSchemaRecipe
+	}
+	return recipes, nil
+}
+
+// schemaNodes flatten arrays and @graph into a list of nodes
+func schemaNodes(document interface{}) []map[string]interface{} {
+	nodes := []map[string]interface{}{}
+	switch value := document.(type) {
+	case []interface{}:
+		for _, item := range value {
+			nodes = append(nodes, schemaNodes(item)...)
+		}
+	case map[string]interface{}:
+		if graph, ok := value["@graph"]; ok {
+			return append(nodes, schemaNodes(graph)...)
+		}
+		nodes = append(nodes, value)
+	}
+	return nodes
+}
+
+// isSchemaRecipe node @type is or includes Recipe
+func isSchemaRecipe(node map[string]interface{}) bool {
+	for _, nodeType := range schemaStrings(node["@type"]) {
+		if nodeType == "Recipe" || nodeType == "schema:Recipe" || strings.HasSuffix(nodeType, "schema.org/Recipe") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaNodeToRecipe map schema.org Recipe node to recipe
+// nodes without educationalLevel get Normal difficulty
+func schemaNodeToRecipe(node map[string]interface{}) (*Recipe, error) {
+	recipe := &Recipe{Difficulty: Normal, Ingredients: schemaStrings(node["recipeIngredient"])}
+	recipe.Name = schemaString(node["name"])
+
+	// @id and url both identify the recipe on the partner side
+	recipe.ExternalID = schemaString(node["@id"])
+	if recipe.ExternalID == "" {
+		recipe.ExternalID = schemaString(node["url"])
+	}
+
+	if level := schemaString(node["educationalLevel"]); level != "" {
+		difficulty, ok := ParseDifficulty(level)
+		if !ok {
+			return nil, fmt.Errorf("Unknown educationalLevel %q", level)
+		}
+		recipe.Difficulty = difficulty
+	}
+
+	for _, diet := range schemaStrings(node["suitableForDiet"]) {
+		if strings.HasSuffix(diet, "VegetarianDiet") || strings.HasSuffix(diet, "VeganDiet") {
+			recipe.Vegetarian = true
+		}
+	}
+
+	var err error
+	if prepTime := schemaString(node["prepTime"]); prepTime != "" {
+		if recipe.PrepMinutes, err = ParseDuration(prepTime); err != nil {
+			return nil, fmt.Errorf("prepTime: %v", err)
+		}
+	}
+	if cookTime := schemaString(node["cookTime"]); cookTime != "" {
+		if recipe.CookMinutes, err = ParseDuration(cookTime); err != nil {
+			return nil, fmt.Errorf("cookTime: %v", err)
+		}
+	}
+
+	if published := schemaString(node["datePublished"]); published != "" {
+		if recipe.Prep, err = time.Parse(time.RFC3339, published); err != nil {
+			if recipe.Prep, err = time.Parse("2006-01-02", published); err != nil {
+				return nil, fmt.Errorf("datePublished: %v", err)
+			}
+		}
+	}
+	return recipe, nil
+}
+
+// schemaString first string value of a JSON-LD property
+func schemaString(value interface{}) string {
+	values := schemaStrings(value)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// schemaStrings string values of a JSON-LD property which may be a single value, an array or a node with @id
+func schemaStrings(value interface{}) []string {
+	values := []string{}
+	switch value := value.(type) {
+	case string:
+		values = append(values, value)
+	case []interface{}:
+		for _, item := range value {
+			values = append(values, schemaStrings(item)...)
+		}
+	case map[string]interface{}:
+		if id, ok := value["@id"].(string); ok {
+			values = append(values, id)
+		} else if text, ok := value["@value"].(string); ok {
+			values = append(values, text)
+		}
+	}
+	return values
+}
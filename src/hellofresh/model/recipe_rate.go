@@ -1,9 +1,23 @@
 package model
 
 import (
+	"context"
+	"hellofresh/util"
 	"time"
 )
 
+// AnonymousRaterPrefix prefix of the user of anonymous rates, followed by the hashed client fingerprint
+const AnonymousRaterPrefix = "anonymous:"
+
+// legacyRater user of the rates stored before raters were tracked, migrated to LegacyRaterPrefix and the rate id
+const legacyRater = "Jane Doe"
+
+// LegacyRaterPrefix prefix of the user of rates stored before raters were tracked, so each stays a rate of its own
+const LegacyRaterPrefix = "legacy:"
+
+// ErrRaterRequired rate without an authenticated principal nor the fingerprint of an anonymous client
+var ErrRaterRequired = &ForbiddenError{Code: "rater_required", Message: "Credentials are required to rate"}
+
 // RecipeRate recipe rate entity
 type RecipeRate struct {
 	// ID
@@ -12,8 +26,19 @@ type RecipeRate struct {
 	RecipeID string
 	// Rate Rated score from 1-5
 	Rate int
-	// User Who rated it => we can definitely do recommandation based on rate score and user name
+	// User id of the account or API key who rated it, or AnonymousRaterPrefix and the client fingerprint
 	User string
 	// Modified Last modified time
 	Modified time.Time
 }
+
+// RaterFrom user rates made with ctx are recorded for, the authenticated principal or else the anonymous client
+func RaterFrom(ctx context.Context) (string, error) {
+	if principal := util.PrincipalFrom(ctx); principal != nil {
+		return principal.ID, nil
+	}
+	if fingerprint := util.FingerprintFrom(ctx); fingerprint != "" {
+		return AnonymousRaterPrefix + fingerprint, nil
+	}
+	return "", ErrRaterRequired
+}
@@ -1,20 +1,48 @@
 package model
 
 import (
+	"context"
 	"errors"
 	"strings"
+	"time"
 )
 
 // RecipeRestFulAccessor db accessor interface
+// Update, Delete and Upsert return the stored recipe they replaced, Upsert nil when it created the recipe, Rate the previous rate of the rater
 type RecipeRestFulAccessor interface {
 	Description() string
+	EnsureSchema(db interface{}) error
+	ParseID(id ID) (interface{}, error)
 	List(db interface{}, start, limit int) ([]*Recipe, error)
 	Create(db interface{}, recipe *Recipe) error
 	Get(db interface{}, id *ID) (*Recipe, error)
-	Update(db interface{}, recipe *Recipe) error
-	Delete(db interface{}, id *ID) error
-	Rate(db interface{}, id *ID, rate int) error
+	Update(db interface{}, recipe *Recipe) (*Recipe, error)
+	Delete(db interface{}, id *ID, version int) (*Recipe, error)
+	Rate(ctx context.Context, db interface{}, id *ID, rate int) (*RecipeRate, error)
 	Search(db interface{}, search string) ([]*Recipe, error)
+	Batch(db interface{}, operations []*BatchOperation, atomic bool, applied BatchApplied) ([]*BatchResult, error)
+	Upsert(db interface{}, recipe *Recipe, owner string) (*Recipe, error)
+	Transaction(db interface{}, fn func(db interface{}) error) error
+	Export(db interface{}, fn func(*Recipe) error) error
+	Ratings(db interface{}, id *ID) ([]*RecipeRate, error)
+	Find(db interface{}, filter *RecipeFilter, start, limit int) ([]*Recipe, error)
+	RatingsOf(db interface{}, ids []ID) (map[ID][]*RecipeRate, error)
+	ReserveIdempotencyKey(db interface{}, record *IdempotencyRecord) error
+	GetIdempotencyKey(db interface{}, key string) (*IdempotencyRecord, error)
+	CompleteIdempotencyKey(db interface{}, record *IdempotencyRecord) error
+	ReleaseIdempotencyKey(db interface{}, key string) error
+	CreateUser(db interface{}, user *User) error
+	GetUserByName(db interface{}, username string) (*User, error)
+	CreateAPIKey(db interface{}, key *APIKey) error
+	ListAPIKeys(db interface{}) ([]*APIKey, error)
+	GetAPIKeyByHash(db interface{}, hash string) (*APIKey, error)
+	RevokeAPIKey(db interface{}, id string, revoked time.Time) (*APIKey, error)
+	TouchAPIKey(db interface{}, id string, used time.Time) error
+	StoreRefreshToken(db interface{}, token *RefreshToken) error
+	ConsumeRefreshToken(db interface{}, id string) (bool, error)
+	RevokeRefreshTokens(db interface{}, subject string) error
+	AppendAudit(db interface{}, entry *AuditEntry) error
+	FindAudit(db interface{}, filter *AuditFilter, start, limit int) ([]*AuditEntry, error)
 }
 
 // GetAccessor get accessor by client
@@ -0,0 +1,118 @@
+package model
+
+import "time"
+
+// v2FieldNames v2 names of recipe fields, used to report validation errors in v2 terms
+var v2FieldNames = map[string]string{
+	"prep":        "published",
+	"prepMinutes": "times.prep",
+	"cookMinutes": "times.cook",
+}
+
+// RecipeV2 recipe representation of the v2 API
+// difficulty is named, durations are grouped with their total and the prep date is called published
+type RecipeV2 struct {
+	ID          string      `json:"id,omitempty"`
+	Name        string      `json:"name"`
+	Published   time.Time   `json:"published"`
+	Difficulty  string      `json:"difficulty"`
+	Vegetarian  bool        `json:"vegetarian"`
+	Version     int         `json:"version,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	Times       RecipeTimes `json:"times"`
+	Ingredients []string    `json:"ingredients"`
+	// CreatedBy, UpdatedBy, CreatedAt and UpdatedAt are read only and omitted for recipes created before authorship was tracked
+	CreatedBy string     `json:"createdBy,omitempty"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// RecipeTimes preparation, cooking and total time in minutes, total is read only
+type RecipeTimes struct {
+	Prep  int `json:"prep"`
+	Cook  int `json:"cook"`
+	Total int `json:"total"`
+}
+
+// RatingSummary average and number of rates of a recipe
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+// NewRecipeV2 map recipe to its v2 representation
+func NewRecipeV2(recipe *Recipe) *RecipeV2 {
+	v2 := &RecipeV2{
+		Name:        recipe.Name,
+		Published:   recipe.Prep,
+		Difficulty:  recipe.Difficulty.String(),
+		Vegetarian:  recipe.Vegetarian,
+		Version:     recipe.Version,
+		ExternalID:  recipe.ExternalID,
+		Times:       RecipeTimes{Prep: recipe.PrepMinutes, Cook: recipe.CookMinutes, Total: recipe.PrepMinutes + recipe.CookMinutes},
+		Ingredients: recipe.ingredients(),
+		CreatedBy:   recipe.CreatedBy,
+		UpdatedBy:   recipe.UpdatedBy,
+	}
+	if !recipe.CreatedAt.IsZero() {
+		v2.CreatedAt = &recipe.CreatedAt
+	}
+	if !recipe.UpdatedAt.IsZero() {
+		v2.UpdatedAt = &recipe.UpdatedAt
+	}
+	if recipe.ID != nil {
+		v2.ID = string(recipe.RecipeID())
+	}
+	return v2
+}
+
+// NewRatingSummary summarize rates, average is rounded to one decimal and 0 without rates
+func NewRatingSummary(rates []*RecipeRate) *RatingSummary {
+	summary := &RatingSummary{Count: len(rates)}
+	if aggregate := NewAggregateRating(rates); aggregate != nil {
+		summary.Average = aggregate.RatingValue
+	}
+	return summary
+}
+
+// Recipe map v2 representation back to recipe, read only fields are ignored
+// invalid fields are reported with their v2 names in a single ValidationError
+func (v2 *RecipeV2) Recipe() (*Recipe, error) {
+	fieldErrors := []*FieldError{}
+	difficulty, ok := ParseDifficulty(v2.Difficulty)
+	if !ok {
+		fieldErrors = append(fieldErrors, &FieldError{Field: "difficulty", Code: "not_allowed", Message: "Difficulty must be Easy, Normal or Hard"})
+	}
+
+	recipe := &Recipe{
+		Name:        v2.Name,
+		Prep:        v2.Published,
+		Difficulty:  difficulty,
+		Vegetarian:  v2.Vegetarian,
+		Version:     v2.Version,
+		ExternalID:  v2.ExternalID,
+		PrepMinutes: v2.Times.Prep,
+		CookMinutes: v2.Times.Cook,
+		Ingredients: v2.Ingredients,
+	}
+	if v2.ID != "" {
+		recipe.ID = v2.ID
+	}
+
+	for _, fieldError := range recipe.FieldErrors("") {
+		if fieldError.Field == "difficulty" {
+			// already reported by name
+			continue
+		}
+		if name, ok := v2FieldNames[fieldError.Field]; ok {
+			fieldError.Field = name
+		}
+		fieldErrors = append(fieldErrors, fieldError)
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, &ValidationError{Message: "Invalid recipe", Fields: fieldErrors}
+	}
+	return recipe, nil
+}
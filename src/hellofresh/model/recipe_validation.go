@@ -0,0 +1,168 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// validation limits of recipe fields
+const (
+	// MaxNameLength maximum number of characters of a recipe name
+	MaxNameLength = 200
+	// MaxMinutes maximum preparation or cooking time, one day
+	MaxMinutes = 24 * 60
+	// MaxIngredients maximum number of ingredient lines
+	MaxIngredients = 100
+	// MaxIngredientLength maximum number of characters of an ingredient line
+	MaxIngredientLength = 200
+)
+
+// timeType type of time fields, which are decoded as a whole although they are structs
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonFieldIndexes map json names of struct fields to their index
+func jsonFieldIndexes(structType reflect.Type) map[string]int {
+	indexes := map[string]int{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		indexes[name] = i
+	}
+	return indexes
+}
+
+// DecodeRecipe decode json object into recipe, fields missing from data keep their value
+// unknown fields, except the allowed ones, and fields of the wrong type are all reported in a single ValidationError
+// data which is not a json object returns the json error
+func DecodeRecipe(data []byte, recipe *Recipe, allowed ...string) error {
+	return decodeObject(data, recipe, allowed)
+}
+
+// DecodeRecipeV2 decode json object into v2 recipe as DecodeRecipe does, fields of times are reported as times.prep and so on
+func DecodeRecipeV2(data []byte, v2 *RecipeV2) error {
+	return decodeObject(data, v2, nil)
+}
+
+// decodeObject decode json object into the struct target points to, every field error is reported in a single ValidationError
+func decodeObject(data []byte, target interface{}, allowed []string) error {
+	fieldErrors, err := decodeFields(data, reflect.ValueOf(target).Elem(), "", allowed)
+	if err != nil {
+		return err
+	}
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Message: "Invalid recipe", Fields: fieldErrors}
+	}
+	return nil
+}
+
+// decodeFields decode json object field by field into the struct value, nested structs are decoded the same way
+// field errors are named after their json path prefixed with prefix, data which is not a json object returns the json error
+func decodeFields(data []byte, value reflect.Value, prefix string, allowed []string) ([]*FieldError, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	indexes := jsonFieldIndexes(value.Type())
+	fieldErrors := []*FieldError{}
+	for _, name := range names {
+		index, known := indexes[name]
+		if !known {
+			if !contains(allowed, name) {
+				fieldErrors = append(fieldErrors, &FieldError{Field: prefix + name, Code: "unknown_field", Message: "Unknown field"})
+			}
+			continue
+		}
+
+		field := value.Field(index)
+		if field.Kind() == reflect.Struct && field.Type() != timeType {
+			nested, err := decodeFields(fields[name], field, prefix+name+".", nil)
+			if err == nil {
+				fieldErrors = append(fieldErrors, nested...)
+				continue
+			}
+		} else if err := json.Unmarshal(fields[name], field.Addr().Interface()); err == nil {
+			continue
+		}
+		fieldErrors = append(fieldErrors, &FieldError{Field: prefix + name, Code: "invalid_type", Message: fmt.Sprintf("Invalid value %s", fields[name])})
+	}
+	return fieldErrors, nil
+}
+
+// Validate check recipe fields, every invalid field is reported in a single ValidationError
+func (recipe *Recipe) Validate() error {
+	fieldErrors := recipe.FieldErrors("")
+	if len(fieldErrors) > 0 {
+		return &ValidationError{Message: "Invalid recipe", Fields: fieldErrors}
+	}
+	return nil
+}
+
+// FieldErrors invalid fields of recipe, field names are prefixed so nested recipes can be reported
+func (recipe *Recipe) FieldErrors(prefix string) []*FieldError {
+	fieldErrors := []*FieldError{}
+	invalid := func(field, code, message string) {
+		fieldErrors = append(fieldErrors, &FieldError{Field: prefix + field, Code: code, Message: message})
+	}
+
+	name := strings.TrimSpace(recipe.Name)
+	if name == "" {
+		invalid("name", "required", "Name is required")
+	} else if utf8.RuneCountInString(name) > MaxNameLength {
+		invalid("name", "too_long", fmt.Sprintf("Name must not exceed %d characters", MaxNameLength))
+	}
+
+	if recipe.Difficulty < Easy || recipe.Difficulty > Hard {
+		invalid("difficulty", "out_of_range", fmt.Sprintf("Difficulty must be between %d and %d", Easy, Hard))
+	}
+
+	if recipe.PrepMinutes < 0 || recipe.PrepMinutes > MaxMinutes {
+		invalid("prepMinutes", "out_of_range", fmt.Sprintf("Preparation time must be between 0 and %d minutes", MaxMinutes))
+	}
+
+	if recipe.CookMinutes < 0 || recipe.CookMinutes > MaxMinutes {
+		invalid("cookMinutes", "out_of_range", fmt.Sprintf("Cooking time must be between 0 and %d minutes", MaxMinutes))
+	}
+
+	if len(recipe.Ingredients) > MaxIngredients {
+		invalid("ingredients", "too_many", fmt.Sprintf("A recipe must not have more than %d ingredients", MaxIngredients))
+	}
+
+	for i, ingredient := range recipe.Ingredients {
+		field := fmt.Sprintf("ingredients[%d]", i)
+		if strings.TrimSpace(ingredient) == "" {
+			invalid(field, "required", "Ingredient must not be empty")
+		} else if utf8.RuneCountInString(ingredient) > MaxIngredientLength {
+			invalid(field, "too_long", fmt.Sprintf("Ingredient must not exceed %d characters", MaxIngredientLength))
+		}
+	}
+
+	return fieldErrors
+}
+
+// contains values include value
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
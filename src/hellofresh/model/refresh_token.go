@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// RefreshToken refresh token issued by POST /auth/token, stored so it can be exchanged once and revoked
+type RefreshToken struct {
+	// ID jti claim of the token
+	ID string `bson:"_id"`
+	// Subject id of the principal the token was issued to
+	Subject string    `bson:"subject"`
+	Expires time.Time `bson:"expires"`
+}
+
+// StoreRefreshToken store token, expired tokens are purged
+func (token *RefreshToken) StoreRefreshToken(db interface{}) error {
+	return accessor.StoreRefreshToken(db, token)
+}
+
+// ConsumeRefreshToken remove the unexpired token of id, false when it has already been exchanged or revoked
+func ConsumeRefreshToken(db interface{}, id string) (bool, error) {
+	return accessor.ConsumeRefreshToken(db, id)
+}
+
+// RevokeRefreshTokens remove every refresh token of subject
+func RevokeRefreshTokens(db interface{}, subject string) error {
+	return accessor.RevokeRefreshTokens(db, subject)
+}
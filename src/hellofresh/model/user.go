@@ -0,0 +1,206 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"hellofresh/util"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// validation limits of user accounts
+const (
+	// MinUsernameLength minimum number of characters of a username
+	MinUsernameLength = 3
+	// MaxUsernameLength maximum number of characters of a username
+	MaxUsernameLength = 50
+	// MinPasswordLength minimum number of bytes of a password
+	MinPasswordLength = 8
+	// MaxPasswordLength maximum number of bytes of a password, bcrypt ignores anything beyond
+	MaxPasswordLength = 72
+)
+
+// UsernamePattern characters allowed in usernames
+var UsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Roles roles which can be granted to users
+var Roles = []string{util.RoleViewer, util.RoleRater, util.RoleEditor, util.RoleAdmin}
+
+// User account authenticating against the API
+type User struct {
+	// ID can be string or bson.ObjectId
+	ID       interface{} `json:"id" bson:"_id,omitempty"`
+	Username string      `json:"username" bson:"username"`
+	// PasswordHash bcrypt hash of the password, never rendered
+	PasswordHash string    `json:"-" bson:"passwordHash"`
+	Roles        []string  `json:"roles" bson:"roles"`
+	Created      time.Time `json:"created" bson:"created"`
+}
+
+// NewUser validate a new account and hash its password, every invalid field is reported in a single ValidationError
+func NewUser(username, password string, roles []string) (*User, error) {
+	fieldErrors := []*FieldError{}
+	invalid := func(field, code, message string) {
+		fieldErrors = append(fieldErrors, &FieldError{Field: field, Code: code, Message: message})
+	}
+
+	switch {
+	case len(username) < MinUsernameLength || len(username) > MaxUsernameLength:
+		invalid("username", "out_of_range", fmt.Sprintf("Username must have %d to %d characters", MinUsernameLength, MaxUsernameLength))
+	case !UsernamePattern.MatchString(username):
+		invalid("username", "invalid_format", "Username may only contain letters, digits, '.', '_' and '-'")
+	}
+
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		invalid("password", "out_of_range", fmt.Sprintf("Password must have %d to %d bytes", MinPasswordLength, MaxPasswordLength))
+	}
+
+	for i, role := range roles {
+		if !contains(Roles, role) {
+			invalid(fmt.Sprintf("roles[%d]", i), "unknown_role", fmt.Sprintf("Unknown role %q", role))
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, &ValidationError{Message: "Invalid user", Fields: fieldErrors}
+	}
+
+	if roles == nil {
+		roles = []string{}
+	}
+	user := &User{Username: username, Roles: roles}
+	return user, user.SetPassword(password)
+}
+
+// UserID id of a stored user, ID is a bson.ObjectId on mongodb and an integer on postgres
+func (user *User) UserID() string {
+	if objectID, ok := user.ID.(bson.ObjectId); ok {
+		return objectID.Hex()
+	}
+	return fmt.Sprintf("%v", user.ID)
+}
+
+// SetPassword replace the password hash
+func (user *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword password matches the stored hash
+// a match is remembered for passwordCacheTTL, so clients sending Basic credentials with every request cost one bcrypt comparison
+func (user *User) CheckPassword(password string) bool {
+	key := verifiedPasswords.key(user.PasswordHash, password)
+	if verifiedPasswords.contains(key) {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return false
+	}
+	verifiedPasswords.add(key)
+	return true
+}
+
+// passwordCacheTTL time a verified password is accepted without bcrypt comparison
+const passwordCacheTTL = time.Minute
+
+// passwordCacheSize maximum number of verified passwords remembered, the oldest is evicted first
+const passwordCacheSize = 10000
+
+// passwordCache verified password and hash pairs by HMAC under a key of the process, so the cache holds no password
+type passwordCache struct {
+	sync.Mutex
+	secret   []byte
+	verified map[string]time.Time
+}
+
+// verifiedPasswords passwords verified by CheckPassword
+var verifiedPasswords = &passwordCache{secret: randomSecret(), verified: map[string]time.Time{}}
+
+// randomSecret 32 random bytes
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		util.PanicOnError(err)
+	}
+	return secret
+}
+
+// key HMAC of hash and password, a changed password hash never matches the entries of the previous one
+func (cache *passwordCache) key(hash, password string) string {
+	mac := hmac.New(sha256.New, cache.secret)
+	mac.Write([]byte(hash + "\x00" + password))
+	return string(mac.Sum(nil))
+}
+
+// contains key has been verified within passwordCacheTTL
+func (cache *passwordCache) contains(key string) bool {
+	cache.Lock()
+	defer cache.Unlock()
+	verified, ok := cache.verified[key]
+	return ok && time.Since(verified) < passwordCacheTTL
+}
+
+// add remember key as verified now, expired entries and then the oldest are evicted when the cache is full
+func (cache *passwordCache) add(key string) {
+	cache.Lock()
+	defer cache.Unlock()
+	if len(cache.verified) >= passwordCacheSize {
+		oldest, oldestTime := "", time.Now()
+		for cached, verified := range cache.verified {
+			if time.Since(verified) >= passwordCacheTTL {
+				delete(cache.verified, cached)
+			} else if verified.Before(oldestTime) {
+				oldest, oldestTime = cached, verified
+			}
+		}
+		if len(cache.verified) >= passwordCacheSize {
+			delete(cache.verified, oldest)
+		}
+	}
+	cache.verified[key] = time.Now()
+}
+
+// unknownUser account checked for usernames without account, hashed on first use
+var unknownUser struct {
+	once sync.Once
+	user User
+}
+
+// CheckUnknownPassword spend as long as CheckPassword for a username without account, so usernames cannot be probed by timing
+func CheckUnknownPassword(password string) {
+	unknownUser.once.Do(func() {
+		unknownUser.user.SetPassword("password of no account")
+	})
+	unknownUser.user.CheckPassword(password)
+}
+
+// Principal principal authenticated as user
+func (user *User) Principal() *util.Principal {
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return &util.Principal{ID: user.UserID(), Username: user.Username, Roles: roles}
+}
+
+// CreateUser create user, ConflictError duplicate_user if the username is taken
+func (user *User) CreateUser(db interface{}) error {
+	user.Created = time.Now().UTC()
+	return accessor.CreateUser(db, user)
+}
+
+// GetUserByName get user by username, NotFoundError if there is none
+func GetUserByName(db interface{}, username string) (*User, error) {
+	return accessor.GetUserByName(db, username)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hellofresh/model"
+	"hellofresh/util"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// importProgressInterval number of lines between two progress reports
+const importProgressInterval = 100
+
+// maxImportLineSize maximum size of a single NDJSON line
+const maxImportLineSize = 1024 * 1024
+
+// exportBatchSize number of exported recipes whose ratings are read in one lookup and which are flushed together
+const exportBatchSize = 100
+
+// exportWriteTimeout time granted to write a batch of the export, the whole export may outlast the server WriteTimeout
+const exportWriteTimeout = 15 * time.Second
+
+// importLineTimeout time granted to read and store a line of the import and to write its report, the whole import may outlast
+// the server ReadTimeout and WriteTimeout
+const importLineTimeout = 15 * time.Second
+
+// importProgress progress line of POST /recipes/import
+type importProgress struct {
+	Processed int  `json:"processed"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	Failed    int  `json:"failed"`
+	Done      bool `json:"done"`
+}
+
+// importFailure error line of POST /recipes/import
+type importFailure struct {
+	Line   int                 `json:"line"`
+	Error  string              `json:"error"`
+	Errors []*model.FieldError `json:"errors,omitempty"`
+}
+
+// exportRecipes GET /recipes/export
+func (app *App) exportRecipes(w http.ResponseWriter, r *http.Request) {
+	withRatings := strings.ToLower(r.URL.Query().Get("ratings")) == "true"
+	encoder := json.NewEncoder(w)
+	controller := http.NewResponseController(w)
+	started, exported := false, 0
+
+	recipe := &model.Recipe{}
+	batch := make([]*model.Recipe, 0, exportBatchSize)
+	// send write the batch and flush it to the client
+	send := func() error {
+		ratings := map[model.ID][]*model.RecipeRate{}
+		if withRatings && len(batch) > 0 {
+			ids := make([]model.ID, len(batch))
+			for i, recipe := range batch {
+				ids[i] = recipe.RecipeID()
+			}
+			var err error
+			if ratings, err = recipe.GetRatingsOf(app.DB, ids); err != nil {
+				return err
+			}
+		}
+
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		// not supported by recorders of tests, which have no deadline anyway
+		controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		for _, recipe := range batch {
+			// Encode terminates every recipe with a newline
+			if err := encoder.Encode(&model.ExportRecipe{Recipe: recipe, Ratings: ratings[recipe.RecipeID()]}); err != nil {
+				return err
+			}
+			exported++
+		}
+		batch = batch[:0]
+		controller.Flush()
+		return nil
+	}
+
+	err := recipe.ExportRecipes(app.DB, func(recipe *model.Recipe) error {
+		batch = append(batch, recipe)
+		if len(batch) < exportBatchSize {
+			return nil
+		}
+		return send()
+	})
+	if err == nil {
+		err = send()
+	}
+
+	if err != nil {
+		if !started {
+			util.ResponseWithDomainError(w, r, err)
+			return
+		}
+		// status has already been sent, the truncated stream is all we can do
+		log.Printf("export aborted after %d recipes: %v", exported, err)
+	}
+}
+
+// importRecipes POST /recipes/import
+// recipes with externalId are upserted, the others are created. ratings in the payload are ignored
+func (app *App) importRecipes(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	// progress is reported while the body is still read, deadlines and full duplex are not supported by recorders of tests
+	controller := http.NewResponseController(w)
+	controller.EnableFullDuplex()
+	extendDeadlines := func() {
+		deadline := time.Now().Add(importLineTimeout)
+		controller.SetReadDeadline(deadline)
+		controller.SetWriteDeadline(deadline)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	report := func(line interface{}) {
+		encoder.Encode(line)
+		controller.Flush()
+	}
+
+	progress := &importProgress{}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+	lineNumber := 0
+	for extendDeadlines(); scanner.Scan(); extendDeadlines() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		progress.Processed++
+		if created, err := app.importRecipe(r.Context(), line); err != nil {
+			progress.Failed++
+			report(importFailed(r, lineNumber, err))
+		} else if created {
+			progress.Created++
+		} else {
+			progress.Updated++
+		}
+
+		if progress.Processed%importProgressInterval == 0 {
+			report(progress)
+		}
+	}
+
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		report(&importFailure{Line: lineNumber + 1, Error: fmt.Sprintf("Line longer than %d bytes", maxImportLineSize)})
+	} else if err != nil {
+		report(importFailed(r, lineNumber+1, err))
+	}
+
+	progress.Done = true
+	report(progress)
+}
+
+// importFailed failure report of line, only domain errors tell their message, the others are logged and reported as unexpected
+func importFailed(r *http.Request, line int, err error) *importFailure {
+	if _, ok := err.(util.ProblemError); !ok {
+		log.Printf("%s %s: line %d: %v", r.Method, r.URL.Path, line, err)
+		return &importFailure{Line: line, Error: "Unexpected error"}
+	}
+
+	failure := &importFailure{Line: line, Error: err.Error()}
+	if validationError, ok := err.(*model.ValidationError); ok {
+		failure.Errors = validationError.Fields
+	}
+	return failure
+}
+
+// importRecipe import single NDJSON line as the principal of ctx, returns true if the recipe has been created
+func (app *App) importRecipe(ctx context.Context, line string) (bool, error) {
+	recipe := model.Recipe{}
+	if err := model.DecodeRecipe([]byte(line), &recipe, "ratings"); err != nil {
+		return false, err
+	}
+	if err := recipe.Validate(); err != nil {
+		return false, err
+	}
+
+	recipe.ID = nil
+	authoredBy(ctx, &recipe)
+	if recipe.ExternalID == "" {
+		return true, recipe.CreateRecipe(ctx, app.DB)
+	}
+	owner, err := upsertOwner(ctx)
+	if err != nil {
+		return false, err
+	}
+	return recipe.UpsertRecipe(ctx, app.DB, owner)
+}
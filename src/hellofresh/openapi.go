@@ -0,0 +1,745 @@
+package main
+
+import (
+	"hellofresh/model"
+	"hellofresh/openapi"
+	"hellofresh/util"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// credentials security requirement of protected operations, basic auth or a bearer token depending on auth.type, an API key or a partner signature
+var credentials = []map[string][]string{{"basicAuth": {}}, {"bearerAuth": {}}, {"apiKey": {}}, {"hmacSignature": {}}}
+
+// raterCredentials security requirement of rating operations, credentials or none when ratings.anonymous is enabled
+var raterCredentials = append(append([]map[string][]string{}, credentials...), map[string][]string{})
+
+// renderedMediaTypes media types util.Render can encode every payload in
+var renderedMediaTypes = []string{"application/json", "application/xml", "text/xml", "application/msgpack", "application/x-msgpack"}
+
+// problemMediaTypes media types of error responses
+var problemMediaTypes = []string{"application/problem+json", "application/problem+xml"}
+
+// routeVariable variable of a mux path template, with its optional pattern
+var routeVariable = regexp.MustCompile(`\{([^}:]+)(?::([^}]+))?\}`)
+
+// rendered content of payload in every media type util.Render supports
+func rendered(schema *openapi.Schema) map[string]*openapi.MediaType {
+	return openapi.Content(schema, renderedMediaTypes...)
+}
+
+// renderedList rendered content of a recipe list, which can also be encoded as CSV
+func renderedList() map[string]*openapi.MediaType {
+	content := rendered(openapi.ArrayOf(openapi.Ref("Recipe")))
+	content["text/csv"] = &openapi.MediaType{Schema: &openapi.Schema{Type: "string"}}
+	content[halMediaType] = &openapi.MediaType{Schema: openapi.Ref("RecipeCollectionHAL")}
+	return content
+}
+
+// problem error response
+func problem(description string) *openapi.Response {
+	return &openapi.Response{Description: description, Content: openapi.Content(openapi.Ref("Problem"), problemMediaTypes...)}
+}
+
+// header request header parameter
+func header(name, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+// idempotencyKey Idempotency-Key header of operations whose response is replayed for retries
+func idempotencyKey() *openapi.Parameter {
+	parameter := header(idempotencyKeyHeader, "Unique key of the request, repeats with the same key get the stored response")
+	maxLength := 255
+	parameter.Schema.MaxLength = &maxLength
+	return parameter
+}
+
+// query query string parameter
+func query(name, description string, schema *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// recipeBody request body holding a single recipe
+func recipeBody(description string) *openapi.RequestBody {
+	return &openapi.RequestBody{Description: description, Required: true, Content: openapi.Content(openapi.Ref("Recipe"), "application/json")}
+}
+
+// withErrors add problem responses of the given status codes, plus 406 and 500 which every route can return
+// routes checking credentials, which answer 401, also answer 429 while failed logins are throttled and 413 for oversized signed bodies
+// routes taking a request body answer 413 too, added by init
+func withErrors(responses map[string]*openapi.Response, codes ...string) map[string]*openapi.Response {
+	descriptions := map[string]string{
+		"400": "Malformed id or payload",
+		"401": "Missing or wrong credentials",
+		"403": "Role or setting does not allow the operation",
+		"404": "Recipe not found",
+		"406": "None of the accepted media types is supported",
+		"409": "Duplicate external id",
+		"412": "If-Match does not match the stored version",
+		"422": "Invalid fields",
+		"413": "Request body exceeds maxBodySize, or auth.signing.maxBodySize when signed",
+		"428": "If-Match header required",
+		"429": "Too many failed logins of the username or client IP, Retry-After tells when to retry",
+		"500": "Unexpected error",
+	}
+	for _, code := range codes {
+		if code == "401" {
+			codes = append(codes, "413", "429")
+			break
+		}
+	}
+	for _, code := range append(codes, "406", "500") {
+		responses[code] = problem(descriptions[code])
+	}
+	return responses
+}
+
+// unversionedRoutes routes of routeDocs which belong to no API version
+var unversionedRoutes = map[string]bool{
+	"GET /":                   true,
+	"GET /openapi.json":       true,
+	"POST /graphql":           true,
+	"POST /users/register":    true,
+	"POST /auth/token":        true,
+	"POST /auth/revoke":       true,
+	"POST /users":             true,
+	"GET /users/me":           true,
+	"GET /users/{id}/recipes": true,
+	"POST /api-keys":          true,
+	"GET /api-keys":           true,
+	"DELETE /api-keys/{id}":   true,
+	"GET /recipes/{id}/audit": true,
+	"GET /audit":              true,
+}
+
+// routeDocs documentation of unversioned and v1 routes, keyed by method and mux path template without version prefix
+// v1 routes are served at /v1 and at the root
+var routeDocs = map[string]*openapi.Operation{
+	"GET /": {
+		OperationID: "aliveCheck",
+		Summary:     "Alive check",
+		Tags:        []string{"health"},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Service is alive", Content: rendered(&openapi.Schema{Type: "string"})}}),
+	},
+	"GET /openapi.json": {
+		OperationID: "getOpenAPI",
+		Summary:     "OpenAPI 3 document of this API",
+		Tags:        []string{"health"},
+		Responses:   map[string]*openapi.Response{"200": {Description: "OpenAPI document", Content: openapi.Content(&openapi.Schema{Type: "object"}, "application/json")}},
+	},
+	"POST /graphql": {
+		OperationID: "postGraphQL",
+		Summary:     "GraphQL queries and mutations, mutations require credentials",
+		Tags:        []string{"graphql"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("GraphQLRequest"), "application/json")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Result of the operation, resolver errors are reported in errors", Content: openapi.Content(openapi.Ref("GraphQLResponse"), "application/json")},
+		}, "400", "413", "429"),
+	},
+	"POST /auth/token": {
+		OperationID: "issueToken",
+		Summary:     "Exchange credentials or a refresh token for access and refresh tokens, when auth.type is jwt",
+		Tags:        []string{"users"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("TokenRequest"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Issued tokens", Content: rendered(openapi.Ref("TokenPair"))}}, "400", "401", "403"),
+	},
+	"POST /auth/revoke": {
+		OperationID: "revokeToken",
+		Summary:     "Revoke every refresh token of the subject of a refresh token, unknown tokens are ignored, when auth.type is jwt",
+		Tags:        []string{"users"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("TokenRevocation"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Refresh tokens revoked"}}, "400", "403"),
+	},
+	"POST /users/register": {
+		OperationID: "registerUser",
+		Summary:     "Register account with the rater role, when enabled by auth.registration",
+		Tags:        []string{"users"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("Registration"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"201": {Description: "Created account", Content: rendered(openapi.Ref("User"))}}, "400", "403", "409", "422"),
+	},
+	"POST /users": {
+		OperationID: "createUser",
+		Summary:     "Create account with roles, admin only",
+		Tags:        []string{"users"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("UserRequest"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"201": {Description: "Created account", Content: rendered(openapi.Ref("User"))}}, "400", "401", "403", "409", "422"),
+		Security:    credentials,
+	},
+	"GET /users/me": {
+		OperationID: "getCurrentUser",
+		Summary:     "Account of the credentials",
+		Tags:        []string{"users"},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Authenticated account", Content: rendered(openapi.Ref("Principal"))}}, "401"),
+		Security:    credentials,
+	},
+	"GET /users/{id}/recipes": {
+		OperationID: "getUserRecipes",
+		Summary:     "List recipes created by user",
+		Tags:        []string{"users"},
+		Parameters: []*openapi.Parameter{
+			query("offset", "Number of recipes to skip", (&openapi.Schema{Type: "integer"}).Range(0, math.MaxInt32)),
+			query("limit", "Page size", (&openapi.Schema{Type: "integer"}).Range(1, maxPageSize)),
+			header("If-None-Match", "ETag of a cached copy"),
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Page of recipes of the user", Content: renderedList()},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400"),
+	},
+	"POST /api-keys": {
+		OperationID: "createAPIKey",
+		Summary:     "Create API key of a service client, admin only, the key is only returned once",
+		Tags:        []string{"api-keys"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("APIKeyRequest"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"201": {Description: "Created key including the key itself", Content: rendered(openapi.Ref("CreatedAPIKey"))}}, "400", "401", "403", "422"),
+		Security:    credentials,
+	},
+	"GET /api-keys": {
+		OperationID: "getAPIKeys",
+		Summary:     "List API keys without their secret, admin only",
+		Tags:        []string{"api-keys"},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Every key, revoked and expired ones included", Content: rendered(openapi.ArrayOf(openapi.Ref("APIKey")))}}, "401", "403"),
+		Security:    credentials,
+	},
+	"DELETE /api-keys/{id}": {
+		OperationID: "revokeAPIKey",
+		Summary:     "Revoke API key, admin only",
+		Tags:        []string{"api-keys"},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Revoked key", Content: rendered(openapi.Ref("APIKey"))}}, "400", "401", "403", "404"),
+		Security:    credentials,
+	},
+	"GET /recipes/{id}/audit": {
+		OperationID: "getRecipeAudit",
+		Summary:     "Audit log of recipe, admin only, kept after the recipe is deleted",
+		Tags:        []string{"audit"},
+		Parameters: []*openapi.Parameter{
+			query("offset", "Number of entries to skip", (&openapi.Schema{Type: "integer"}).Range(0, math.MaxInt32)),
+			query("limit", "Page size", (&openapi.Schema{Type: "integer"}).Range(1, maxPageSize)),
+		},
+		Responses: withErrors(map[string]*openapi.Response{"200": {Description: "Changes of the recipe, oldest first", Content: rendered(openapi.ArrayOf(openapi.Ref("AuditEntry")))}}, "400", "401", "403"),
+		Security:  credentials,
+	},
+	"GET /audit": {
+		OperationID: "getAudit",
+		Summary:     "Audit log of every recipe change and failed authentication, admin only",
+		Tags:        []string{"audit"},
+		Parameters: []*openapi.Parameter{
+			query("user", "Id of the user who made the changes, or the username of failed authentications", &openapi.Schema{Type: "string"}),
+			query("action", "Only entries of this action", &openapi.Schema{Type: "string", Enum: []interface{}{model.AuditCreate, model.AuditUpdate, model.AuditDelete, model.AuditRate, model.AuditAuthFailure}}),
+			query("since", "Only changes from this RFC 3339 time on", &openapi.Schema{Type: "string", Format: "date-time"}),
+			query("offset", "Number of entries to skip", (&openapi.Schema{Type: "integer"}).Range(0, math.MaxInt32)),
+			query("limit", "Page size", (&openapi.Schema{Type: "integer"}).Range(1, maxPageSize)),
+		},
+		Responses: withErrors(map[string]*openapi.Response{"200": {Description: "Changes, oldest first", Content: rendered(openapi.ArrayOf(openapi.Ref("AuditEntry")))}}, "400", "401", "403"),
+		Security:  credentials,
+	},
+	"POST /recipes": {
+		OperationID: "createRecipe",
+		Summary:     "Create recipe",
+		Tags:        []string{"recipes"},
+		RequestBody: recipeBody("Recipe to create, _id and version are ignored"),
+		Parameters:  []*openapi.Parameter{idempotencyKey()},
+		Responses:   withErrors(map[string]*openapi.Response{"201": {Description: "Created recipe, ETag holds its version", Content: rendered(openapi.Ref("Recipe"))}}, "400", "401", "403", "409", "422"),
+		Security:    credentials,
+	},
+	"POST /recipes:batch": {
+		OperationID: "batchRecipes",
+		Summary:     "Create, update and delete recipes in one batch",
+		Tags:        []string{"recipes"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("BatchRequest"), "application/json")},
+		Parameters:  []*openapi.Parameter{idempotencyKey()},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Result of every operation", Content: rendered(openapi.Ref("BatchResponse"))},
+			"422": {Description: "Atomic batch rolled back, or invalid recipes reported as problem", Content: func() map[string]*openapi.MediaType {
+				content := rendered(openapi.Ref("BatchResponse"))
+				for mediaType, problem := range problem("").Content {
+					content[mediaType] = problem
+				}
+				return content
+			}()},
+		}, "400", "401", "403", "409"),
+		Security: credentials,
+	},
+	"GET /recipes/export": {
+		OperationID: "exportRecipes",
+		Summary:     "Export every recipe as newline-delimited JSON",
+		Tags:        []string{"import-export"},
+		Parameters:  []*openapi.Parameter{query("ratings", "Include the ratings of each recipe", &openapi.Schema{Type: "boolean"})},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "One recipe per line", Content: openapi.Content(openapi.Ref("ExportRecipe"), "application/x-ndjson")}}, "401", "403"),
+		Security:    credentials,
+	},
+	"POST /recipes/import": {
+		OperationID: "importRecipes",
+		Summary:     "Import recipes from newline-delimited JSON",
+		Tags:        []string{"import-export"},
+		RequestBody: &openapi.RequestBody{Description: "One recipe per line, recipes with externalId are upserted", Required: true, Content: openapi.Content(openapi.Ref("Recipe"), "application/x-ndjson")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Progress, failures and summary lines", Content: openapi.Content(openapi.Ref("ImportProgress"), "application/x-ndjson")}}, "401", "403"),
+		Security:    credentials,
+	},
+	"POST /recipes/import/jsonld": {
+		OperationID: "importSchemaRecipes",
+		Summary:     "Import schema.org Recipe JSON-LD documents",
+		Tags:        []string{"import-export"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(&openapi.Schema{Description: "SchemaRecipe node, array of nodes or document with @graph"}, "application/ld+json", "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Imported recipes", Content: renderedList()}}, "400", "401", "403", "409", "422"),
+		Security:    credentials,
+	},
+	"GET /recipes/{id}": {
+		OperationID: "getRecipe",
+		Summary:     "Get recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-None-Match", "ETag of a cached copy")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Recipe, ETag holds its version", Content: func() map[string]*openapi.MediaType {
+				content := rendered(openapi.Ref("Recipe"))
+				content["application/ld+json"] = &openapi.MediaType{Schema: openapi.Ref("SchemaRecipe")}
+				content[halMediaType] = &openapi.MediaType{Schema: openapi.Ref("RecipeHAL")}
+				return content
+			}()},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400", "404"),
+	},
+	"GET /recipes/{start:[0-9]+}/{limit:[0-9]+}": {
+		OperationID: "getRecipes",
+		Summary:     "List recipes",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-None-Match", "ETag of a cached copy")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Page of recipes", Content: renderedList()},
+			"304": {Description: "Cached copy is up to date"},
+		}),
+	},
+	"PUT /recipes/{id}": {
+		OperationID: "updateRecipe",
+		Summary:     "Replace recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-Match", "ETag of the version being replaced")},
+		RequestBody: recipeBody("New state of the recipe"),
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Updated recipe", Content: rendered(openapi.Ref("Recipe"))}}, "400", "401", "403", "404", "412", "422", "428"),
+		Security:    credentials,
+	},
+	"PATCH /recipes/{id}": {
+		OperationID: "patchRecipe",
+		Summary:     "Update some fields of recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-Match", "ETag of the version being updated")},
+		RequestBody: &openapi.RequestBody{Description: "Fields to update, missing fields keep their value", Required: true, Content: openapi.Content(openapi.Ref("RecipePatch"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Updated recipe", Content: rendered(openapi.Ref("Recipe"))}}, "400", "401", "403", "404", "412", "422", "428"),
+		Security:    credentials,
+	},
+	"DELETE /recipes/{id}": {
+		OperationID: "deleteRecipe",
+		Summary:     "Delete recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-Match", "ETag of the version being deleted")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Recipe deleted", Content: rendered(openapi.Ref("Result"))}}, "400", "401", "403", "404", "412", "428"),
+		Security:    credentials,
+	},
+	"PUT /recipes/{id}/rate/{rate:[1-5]}": {
+		OperationID: "rateRecipe",
+		Summary:     "Rate recipe from 1 to 5, rating again replaces the previous rate",
+		Tags:        []string{"ratings"},
+		Parameters:  []*openapi.Parameter{idempotencyKey()},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Rate recorded", Content: rendered(openapi.Ref("Result"))}}, "400", "401", "403", "404", "409", "422"),
+		Security:    raterCredentials,
+	},
+	"GET /recipes/search/{search:.+}": {
+		OperationID: "searchRecipes",
+		Summary:     "Search recipes by name pattern",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-None-Match", "ETag of a cached copy")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Matching recipes", Content: renderedList()},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400"),
+	},
+}
+
+// v2SharedRoutes v1 routes also served by v2 unchanged
+var v2SharedRoutes = []string{"POST /recipes:batch", "GET /recipes/export", "POST /recipes/import", "POST /recipes/import/jsonld"}
+
+// v2RouteDocs documentation of v2 routes, keyed by method and mux path template without /v2 prefix
+var v2RouteDocs = map[string]*openapi.Operation{
+	"GET /recipes": {
+		OperationID: "listRecipesV2",
+		Summary:     "List recipes",
+		Tags:        []string{"recipes"},
+		Parameters: []*openapi.Parameter{
+			query("offset", "Number of recipes to skip", (&openapi.Schema{Type: "integer"}).Range(0, math.MaxInt32)),
+			query("limit", "Page size", (&openapi.Schema{Type: "integer"}).Range(1, maxPageSize)),
+			header("If-None-Match", "ETag of a cached copy"),
+		},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Page of recipes, next links the following page", Content: rendered(openapi.Ref("RecipePageV2"))},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400"),
+	},
+	"POST /recipes": {
+		OperationID: "createRecipeV2",
+		Summary:     "Create recipe",
+		Tags:        []string{"recipes"},
+		RequestBody: &openapi.RequestBody{Description: "Recipe to create, id, version and times.total are ignored", Required: true, Content: openapi.Content(openapi.Ref("RecipeV2"), "application/json")},
+		Parameters:  []*openapi.Parameter{idempotencyKey()},
+		Responses:   withErrors(map[string]*openapi.Response{"201": {Description: "Created recipe, Location links it", Content: rendered(openapi.Ref("RecipeV2"))}}, "400", "401", "403", "409", "422"),
+		Security:    credentials,
+	},
+	"GET /recipes/search": {
+		OperationID: "searchRecipesV2",
+		Summary:     "Search recipes by name pattern",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{{Name: "q", In: "query", Description: "Name pattern", Required: true, Schema: &openapi.Schema{Type: "string"}}, header("If-None-Match", "ETag of a cached copy")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Matching recipes", Content: rendered(openapi.Ref("RecipeListV2"))},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400"),
+	},
+	"GET /recipes/{id}": {
+		OperationID: "getRecipeV2",
+		Summary:     "Get recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-None-Match", "ETag of a cached copy")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Recipe, ETag holds its version", Content: rendered(openapi.Ref("RecipeV2"))},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400", "404"),
+	},
+	"PUT /recipes/{id}": {
+		OperationID: "updateRecipeV2",
+		Summary:     "Replace recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-Match", "ETag of the version being replaced")},
+		RequestBody: &openapi.RequestBody{Description: "New state of the recipe", Required: true, Content: openapi.Content(openapi.Ref("RecipeV2"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Updated recipe", Content: rendered(openapi.Ref("RecipeV2"))}}, "400", "401", "403", "404", "412", "422", "428"),
+		Security:    credentials,
+	},
+	"PATCH /recipes/{id}": {
+		OperationID: "patchRecipeV2",
+		Summary:     "Update some fields of recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-Match", "ETag of the version being updated")},
+		RequestBody: &openapi.RequestBody{Description: "Fields to update, missing fields keep their value", Required: true, Content: openapi.Content(openapi.Ref("RecipeV2Patch"), "application/json")},
+		Responses:   withErrors(map[string]*openapi.Response{"200": {Description: "Updated recipe", Content: rendered(openapi.Ref("RecipeV2"))}}, "400", "401", "403", "404", "412", "422", "428"),
+		Security:    credentials,
+	},
+	"DELETE /recipes/{id}": {
+		OperationID: "deleteRecipeV2",
+		Summary:     "Delete recipe",
+		Tags:        []string{"recipes"},
+		Parameters:  []*openapi.Parameter{header("If-Match", "ETag of the version being deleted")},
+		Responses:   withErrors(map[string]*openapi.Response{"204": {Description: "Recipe deleted"}}, "400", "401", "403", "404", "412", "428"),
+		Security:    credentials,
+	},
+	"GET /recipes/{id}/ratings": {
+		OperationID: "getRatingsV2",
+		Summary:     "Rating summary of recipe",
+		Tags:        []string{"ratings"},
+		Parameters:  []*openapi.Parameter{header("If-None-Match", "ETag of a cached copy")},
+		Responses: withErrors(map[string]*openapi.Response{
+			"200": {Description: "Average and number of rates", Content: rendered(openapi.Ref("RatingSummary"))},
+			"304": {Description: "Cached copy is up to date"},
+		}, "400", "404"),
+	},
+	"POST /recipes/{id}/ratings": {
+		OperationID: "rateRecipeV2",
+		Summary:     "Rate recipe from 1 to 5, rating again replaces the previous rate",
+		Tags:        []string{"ratings"},
+		RequestBody: &openapi.RequestBody{Required: true, Content: openapi.Content(openapi.Ref("RateRequestV2"), "application/json")},
+		Parameters:  []*openapi.Parameter{idempotencyKey()},
+		Responses:   withErrors(map[string]*openapi.Response{"201": {Description: "Rating summary including the new rate", Content: rendered(openapi.Ref("RatingSummary"))}}, "400", "401", "403", "404", "409", "422"),
+		Security:    raterCredentials,
+	},
+}
+
+func init() {
+	// request bodies are read up to maxBodySize
+	for _, docs := range []map[string]*openapi.Operation{routeDocs, v2RouteDocs} {
+		for _, operation := range docs {
+			if operation.RequestBody != nil {
+				withErrors(operation.Responses, "413")
+			}
+		}
+	}
+
+	for _, key := range v2SharedRoutes {
+		shared := *routeDocs[key]
+		shared.OperationID += "V2"
+		v2RouteDocs[key] = &shared
+	}
+}
+
+// routeDoc documentation of a route by method and full mux path template
+// v1 operations are flagged deprecated, those served at /v1 get a distinct operation id
+func routeDoc(method, template string) (*openapi.Operation, bool) {
+	if unversionedRoutes[method+" "+template] {
+		return routeDocs[method+" "+template], true
+	}
+
+	if strings.HasPrefix(template, "/v2/") {
+		operation, ok := v2RouteDocs[method+" "+strings.TrimPrefix(template, "/v2")]
+		return operation, ok
+	}
+
+	operation, ok := routeDocs[method+" "+strings.TrimPrefix(template, "/v1")]
+	if !ok {
+		return nil, false
+	}
+	deprecated := *operation
+	deprecated.Deprecated = true
+	if strings.HasPrefix(template, "/v1/") {
+		deprecated.OperationID += "V1"
+	}
+	return &deprecated, true
+}
+
+// recipeSchema schema of model.Recipe with the validation rules
+func recipeSchema() *openapi.Schema {
+	schema := openapi.SchemaOf(model.Recipe{})
+	schema.Required = []string{"name", "difficulty"}
+	schema.AdditionalProperties = false
+	schema.Properties["_id"].Description = "ObjectId hex string on MongoDB, integer on Postgres"
+	schema.Properties["difficulty"].Range(float64(model.Easy), float64(model.Hard)).Description = "1 Easy, 2 Normal, 3 Hard"
+	schema.Properties["prepMinutes"].Range(0, model.MaxMinutes)
+	schema.Properties["cookMinutes"].Range(0, model.MaxMinutes)
+
+	nameLength, ingredientLength, ingredients := model.MaxNameLength, model.MaxIngredientLength, model.MaxIngredients
+	schema.Properties["name"].MaxLength = &nameLength
+	schema.Properties["ingredients"].MaxItems = &ingredients
+	schema.Properties["ingredients"].Nullable = true
+	schema.Properties["ingredients"].Items.MaxLength = &ingredientLength
+	return schema
+}
+
+// recipeV2Schema schema of model.RecipeV2 with the validation rules, no field is required
+func recipeV2Schema() *openapi.Schema {
+	schema := openapi.SchemaOf(model.RecipeV2{})
+	schema.AdditionalProperties = false
+	schema.Properties["difficulty"].Enum = []interface{}{model.Easy.String(), model.Normal.String(), model.Hard.String()}
+
+	times := schema.Properties["times"]
+	times.AdditionalProperties = false
+	times.Properties["prep"].Range(0, model.MaxMinutes)
+	times.Properties["cook"].Range(0, model.MaxMinutes)
+	times.Properties["total"].Description = "Read only, prep + cook"
+	schema.Properties["createdBy"].Description = "Read only, id of the user who created the recipe"
+	schema.Properties["updatedBy"].Description = "Read only, id of the user who last changed the recipe"
+	schema.Properties["createdAt"].Description = "Read only, omitted for recipes created before authorship was tracked"
+	schema.Properties["updatedAt"].Description = "Read only, omitted for recipes created before authorship was tracked"
+
+	nameLength, ingredientLength, ingredients := model.MaxNameLength, model.MaxIngredientLength, model.MaxIngredients
+	schema.Properties["name"].MaxLength = &nameLength
+	schema.Properties["ingredients"].MaxItems = &ingredients
+	schema.Properties["ingredients"].Items.MaxLength = &ingredientLength
+	schema.Properties["_links"] = openapi.Ref("Links")
+	return schema
+}
+
+// itemsSchema reference RecipeV2 from the items of a list schema
+func itemsSchema(schema *openapi.Schema) *openapi.Schema {
+	schema.Properties["items"] = openapi.ArrayOf(openapi.Ref("RecipeV2"))
+	schema.Properties["_links"] = openapi.Ref("Links")
+	return schema
+}
+
+// componentSchemas schemas shared by the operations
+func componentSchemas() map[string]*openapi.Schema {
+	batchRequest := openapi.SchemaOf(batchRequest{})
+	batchRequest.Required = []string{"operations"}
+	operation := batchRequest.Properties["operations"].Items
+	operation.Required = []string{"op"}
+	operation.Properties["op"].Enum = []interface{}{model.BatchCreate, model.BatchUpdate, model.BatchDelete}
+	operation.Properties["recipe"] = openapi.Ref("Recipe")
+
+	batchResponse := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"committed": {Type: "boolean"},
+		"results":   openapi.ArrayOf(openapi.Ref("BatchResult")),
+	}}
+
+	recipePatch := recipeSchema()
+	recipePatch.Required = nil
+
+	exportRecipe := recipeSchema()
+	exportRecipe.Required = nil
+	exportRecipe.Properties["ratings"] = openapi.ArrayOf(openapi.Ref("RecipeRate"))
+
+	recipeHAL := recipeSchema()
+	recipeHAL.Required = nil
+	recipeHAL.Properties["_links"] = openapi.Ref("Links")
+
+	recipeV2 := recipeV2Schema()
+	recipeV2.Required = []string{"name", "difficulty"}
+
+	rateRequest := openapi.SchemaOf(rateRequestV2{})
+	rateRequest.Required = []string{"rate"}
+	rateRequest.Properties["rate"].Range(1, 5)
+
+	userRequest := openapi.SchemaOf(userRequest{})
+	userRequest.Required = []string{"username", "password"}
+	userRequest.AdditionalProperties = false
+	usernameLength, passwordLength := model.MaxUsernameLength, model.MaxPasswordLength
+	userRequest.Properties["username"].MaxLength = &usernameLength
+	userRequest.Properties["username"].Pattern = model.UsernamePattern.String()
+	userRequest.Properties["password"].MaxLength = &passwordLength
+	userRequest.Properties["roles"].Items.Enum = stringsOf(model.Roles)
+
+	registration := &openapi.Schema{Type: "object", Required: userRequest.Required, AdditionalProperties: false, Properties: map[string]*openapi.Schema{
+		"username": userRequest.Properties["username"],
+		"password": userRequest.Properties["password"],
+	}}
+
+	tokenRequest := openapi.SchemaOf(tokenRequest{})
+	tokenRequest.Required = []string{"grant_type"}
+	tokenRequest.AdditionalProperties = false
+	tokenRequest.Properties["grant_type"].Enum = []interface{}{passwordGrant, refreshTokenGrant}
+
+	tokenRevocation := openapi.SchemaOf(revokeRequest{})
+	tokenRevocation.Required = []string{"token"}
+	tokenRevocation.AdditionalProperties = false
+
+	apiKeyRequest := openapi.SchemaOf(apiKeyRequest{})
+	apiKeyRequest.Required = []string{"name", "scopes"}
+	apiKeyRequest.AdditionalProperties = false
+	apiKeyNameLength := model.MaxAPIKeyNameLength
+	apiKeyRequest.Properties["name"].MaxLength = &apiKeyNameLength
+	apiKeyRequest.Properties["scopes"].Items.Enum = stringsOf(model.APIKeyScopes)
+
+	auditEntry := openapi.SchemaOf(model.AuditEntry{})
+	auditEntry.Properties["action"].Enum = []interface{}{model.AuditCreate, model.AuditUpdate, model.AuditDelete, model.AuditRate, model.AuditAuthFailure}
+	auditEntry.Properties["user"].Description = "Id of the account, API key or partner, anonymous:<fingerprint> for anonymous rates, the attempted username or keyId of failed authentications"
+
+	return map[string]*openapi.Schema{
+		"AuditEntry":      auditEntry,
+		"APIKeyRequest":   apiKeyRequest,
+		"APIKey":          openapi.SchemaOf(model.APIKey{}),
+		"CreatedAPIKey":   openapi.SchemaOf(createdAPIKey{}),
+		"TokenRequest":    tokenRequest,
+		"TokenRevocation": tokenRevocation,
+		"TokenPair":       openapi.SchemaOf(util.TokenPair{}),
+		"User":            openapi.SchemaOf(model.User{}),
+		"UserRequest":     userRequest,
+		"Registration":    registration,
+		"Principal":       openapi.SchemaOf(util.Principal{}),
+		"RecipeV2":        recipeV2,
+		"RecipeV2Patch":   recipeV2Schema(),
+		"RecipePageV2":    itemsSchema(openapi.SchemaOf(recipePageV2{})),
+		"RecipeListV2":    itemsSchema(openapi.SchemaOf(recipeListV2{})),
+		"RatingSummary":   openapi.SchemaOf(model.RatingSummary{}),
+		"RateRequestV2":   rateRequest,
+		"Recipe":          recipeSchema(),
+		"RecipeHAL":       recipeHAL,
+		"RecipeCollectionHAL": &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+			"_embedded": {Type: "object", Properties: map[string]*openapi.Schema{"recipes": openapi.ArrayOf(openapi.Ref("RecipeHAL"))}},
+			"_links":    openapi.Ref("Links"),
+		}},
+		"Links": &openapi.Schema{Type: "object", Description: "HAL links keyed by relation", AdditionalProperties: openapi.Ref("Link")},
+		"Link": &openapi.Schema{Type: "object", Required: []string{"href"}, Properties: map[string]*openapi.Schema{
+			"href":      {Type: "string", Description: "URL, or RFC 6570 URI template when templated"},
+			"templated": {Type: "boolean"},
+		}},
+		"RecipePatch":    recipePatch,
+		"RecipeRate":     openapi.SchemaOf(model.RecipeRate{}),
+		"ExportRecipe":   exportRecipe,
+		"SchemaRecipe":   openapi.SchemaOf(model.SchemaRecipe{}),
+		"BatchRequest":   batchRequest,
+		"BatchResult":    openapi.SchemaOf(model.BatchResult{}),
+		"BatchResponse":  batchResponse,
+		"ImportProgress": openapi.SchemaOf(importProgress{}),
+		"Problem":        openapi.SchemaOf(util.Problem{}),
+		"FieldError":     openapi.SchemaOf(model.FieldError{}),
+		"Result":         &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"result": {Type: "string"}}},
+		"GraphQLRequest": &openapi.Schema{Type: "object", Required: []string{"query"}, AdditionalProperties: false, Properties: map[string]*openapi.Schema{
+			"query":         {Type: "string"},
+			"variables":     {Type: "object", Nullable: true},
+			"operationName": {Type: "string", Nullable: true},
+		}},
+		"GraphQLResponse": &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+			"data":   {Nullable: true},
+			"errors": openapi.ArrayOf(&openapi.Schema{Type: "object"}),
+		}},
+	}
+}
+
+// stringsOf values as enum of a schema
+func stringsOf(values []string) []interface{} {
+	enum := make([]interface{}, len(values))
+	for i, value := range values {
+		enum[i] = value
+	}
+	return enum
+}
+
+// OpenAPI generate the OpenAPI document of the registered routes
+// routes without documentation in routeDocs or v2RouteDocs are left out and returned as "METHOD template"
+func (app *App) OpenAPI() (*openapi.Document, []string) {
+	document := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info:    openapi.Info{Title: "hellofresh recipes", Description: "Recipes RESTful API", Version: "1.0.0"},
+		Paths:   map[string]openapi.PathItem{},
+		Components: openapi.Components{
+			Schemas: componentSchemas(),
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"basicAuth":     {Type: "http", Scheme: "basic", Description: "Username and password of an account, the auth section of config.json seeds the first admin"},
+				"bearerAuth":    {Type: "http", Scheme: "bearer", Description: "Access token accepted instead of basic auth, a JWT of POST /auth/token when auth.type is jwt or an opaque token of the identity provider when it is oauth2"},
+				"hmacSignature": {Type: "http", Scheme: util.SignatureScheme, Description: "Request signed by a partner of auth.signing: Authorization: HMAC-SHA256 keyId, timestamp, nonce and signature over method, path, timestamp, nonce and body hash"},
+				"apiKey":        {Type: "apiKey", In: "header", Name: util.APIKeyHeader, Description: "API key of a service client created with POST /api-keys, its scopes are its permissions"},
+			},
+		},
+	}
+
+	undocumented := []string{}
+	app.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			// version prefixes only hold subrouters
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+
+		for _, method := range methods {
+			operation, ok := routeDoc(method, template)
+			if !ok {
+				undocumented = append(undocumented, method+" "+template)
+				continue
+			}
+
+			path, parameters := openAPIPath(template)
+			documented := *operation
+			documented.Parameters = append(parameters, operation.Parameters...)
+			if document.Paths[path] == nil {
+				document.Paths[path] = openapi.PathItem{}
+			}
+			document.Paths[path][strings.ToLower(method)] = &documented
+		}
+		return nil
+	})
+
+	sort.Strings(undocumented)
+	return document, undocumented
+}
+
+// openAPIPath convert mux path template into an OpenAPI path and its path parameters
+// variable patterns become parameter schema patterns
+func openAPIPath(template string) (string, []*openapi.Parameter) {
+	parameters := []*openapi.Parameter{}
+	for _, match := range routeVariable.FindAllStringSubmatch(template, -1) {
+		schema := &openapi.Schema{Type: "string"}
+		if match[2] != "" {
+			schema.Pattern = "^" + match[2] + "$"
+		}
+		parameters = append(parameters, &openapi.Parameter{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+	return routeVariable.ReplaceAllString(template, "{$1}"), parameters
+}
+
+// getOpenAPI GET /openapi.json
+func (app *App) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	document, _ := app.OpenAPI()
+	util.ResponseWithJSON(w, http.StatusOK, document)
+}
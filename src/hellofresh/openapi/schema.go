@@ -0,0 +1,83 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaOf schema of the json representation of value
+// fields are named by their json tag, no field is required and interface{} fields accept any value
+func SchemaOf(value interface{}) *Schema {
+	return schemaOf(reflect.TypeOf(value))
+}
+
+// schemaOf schema of the json representation of type
+func schemaOf(t reflect.Type) *Schema {
+	if t == nil || t == rawMessageType {
+		return &Schema{}
+	}
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return ArrayOf(schemaOf(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addProperties(schema, t)
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+// addProperties add json fields of struct type, fields of embedded structs are promoted like encoding/json does
+func addProperties(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addProperties(schema, embedded)
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = schemaOf(field.Type)
+	}
+}
@@ -0,0 +1,206 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Violation value not matching its schema, field is the json path of the value
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// patterns compiled schema patterns, shared by concurrent requests
+var (
+	patterns      = map[string]*regexp.Regexp{}
+	patternsMutex sync.Mutex
+)
+
+// Validate check a decoded json value against schema, every violation is returned
+// references are resolved in schemas, field prefixes the reported fields
+func (schema *Schema) Validate(value interface{}, schemas map[string]*Schema, field string) []*Violation {
+	if schema.Ref != "" {
+		referenced, ok := schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+		if !ok {
+			return []*Violation{{Field: field, Code: "unknown_schema", Message: fmt.Sprintf("Unknown schema %s", schema.Ref)}}
+		}
+		return referenced.Validate(value, schemas, field)
+	}
+
+	violation := func(code, format string, args ...interface{}) []*Violation {
+		return []*Violation{{Field: field, Code: code, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if value == nil {
+		if schema.Type == "" || schema.Nullable {
+			return nil
+		}
+		return violation("invalid_type", "Expected %s, got null", schema.Type)
+	}
+
+	if !hasType(value, schema.Type) {
+		return violation("invalid_type", "Expected %s", schema.Type)
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		return violation("not_allowed", "Value must be one of %v", schema.Enum)
+	}
+
+	switch value := value.(type) {
+	case string:
+		return schema.validateString(value, violation)
+	case float64:
+		if (schema.Minimum != nil && value < *schema.Minimum) || (schema.Maximum != nil && value > *schema.Maximum) {
+			return violation("out_of_range", "Value must be between %v and %v", bound(schema.Minimum), bound(schema.Maximum))
+		}
+	case []interface{}:
+		if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+			return violation("too_many", "At most %d items are allowed", *schema.MaxItems)
+		}
+		violations := []*Violation{}
+		if schema.Items != nil {
+			for i, item := range value {
+				violations = append(violations, schema.Items.Validate(item, schemas, fmt.Sprintf("%s[%d]", field, i))...)
+			}
+		}
+		return violations
+	case map[string]interface{}:
+		return schema.validateObject(value, schemas, field)
+	}
+	return nil
+}
+
+// validateString check string length, pattern and format
+func (schema *Schema) validateString(value string, violation func(code, format string, args ...interface{}) []*Violation) []*Violation {
+	if schema.MaxLength != nil && utf8.RuneCountInString(value) > *schema.MaxLength {
+		return violation("too_long", "At most %d characters are allowed", *schema.MaxLength)
+	}
+
+	if schema.Pattern != "" && !compiledPattern(schema.Pattern).MatchString(value) {
+		return violation("invalid_format", "Value must match %s", schema.Pattern)
+	}
+
+	if schema.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			return violation("invalid_format", "Value must be an RFC 3339 date-time")
+		}
+	}
+	return nil
+}
+
+// validateObject check required, known and additional properties, in property order
+func (schema *Schema) validateObject(value map[string]interface{}, schemas map[string]*Schema, field string) []*Violation {
+	prefix := field
+	if prefix != "" {
+		prefix += "."
+	}
+
+	violations := []*Violation{}
+	for _, name := range schema.Required {
+		if _, ok := value[name]; !ok {
+			violations = append(violations, &Violation{Field: prefix + name, Code: "required", Message: "Field is required"})
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if property, ok := schema.Properties[name]; ok {
+			violations = append(violations, property.Validate(value[name], schemas, prefix+name)...)
+			continue
+		}
+
+		switch additional := schema.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				violations = append(violations, &Violation{Field: prefix + name, Code: "unknown_field", Message: "Unknown field"})
+			}
+		case *Schema:
+			violations = append(violations, additional.Validate(value[name], schemas, prefix+name)...)
+		}
+	}
+	return violations
+}
+
+// compiledPattern compile pattern once
+func compiledPattern(pattern string) *regexp.Regexp {
+	patternsMutex.Lock()
+	defer patternsMutex.Unlock()
+	compiled, ok := patterns[pattern]
+	if !ok {
+		compiled = regexp.MustCompile(pattern)
+		patterns[pattern] = compiled
+	}
+	return compiled
+}
+
+// ParseParameter convert the string value of a path, query or header parameter to the type of its schema
+func ParseParameter(raw string, schema *Schema) (interface{}, error) {
+	switch schema.Type {
+	case "integer", "number":
+		return strconv.ParseFloat(raw, 64)
+	case "boolean":
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+// hasType json value is of the schema type, any type matches an empty type
+func hasType(value interface{}, schemaType string) bool {
+	switch schemaType {
+	case "":
+		return true
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return false
+}
+
+// inEnum value equals one of the enum values
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// bound printable minimum or maximum, unbounded when not set
+func bound(limit *float64) interface{} {
+	if limit == nil {
+		return "unbounded"
+	}
+	return *limit
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"hellofresh/util"
+	"net/http"
+)
+
+// RequireRater middleware of the rating routes, RequireAuth with the rate permission
+// callers without credentials rate with the fingerprint of their client when ratings.anonymous is enabled
+func (app *App) RequireRater(h http.HandlerFunc) http.HandlerFunc {
+	authorized := util.Use(h, util.RequirePermission(util.PermissionRate), util.RequireAuth)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.anonymousRatings() || util.HasCredentials(r) {
+			authorized(w, r)
+			return
+		}
+
+		fingerprint := util.Fingerprint(r, app.Config.RatingConfig.FingerprintSalt)
+		h.ServeHTTP(w, r.WithContext(util.WithClientIP(util.WithFingerprint(r.Context(), fingerprint), util.ClientIP(r))))
+	}
+}
+
+// anonymousRatings ratings.anonymous is enabled, callers without credentials may rate
+func (app *App) anonymousRatings() bool {
+	return app.Config != nil && app.Config.RatingConfig.Anonymous
+}
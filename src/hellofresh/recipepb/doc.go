@@ -0,0 +1,4 @@
+// Package recipepb generated protobuf messages and gRPC stubs of RecipeService
+package recipepb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative recipe.proto
@@ -0,0 +1,986 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v5.29.3
+// source: recipe.proto
+
+package recipepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Difficulty int32
+
+const (
+	Difficulty_DIFFICULTY_UNSPECIFIED Difficulty = 0
+	Difficulty_DIFFICULTY_EASY        Difficulty = 1
+	Difficulty_DIFFICULTY_NORMAL      Difficulty = 2
+	Difficulty_DIFFICULTY_HARD        Difficulty = 3
+)
+
+// Enum value maps for Difficulty.
+var (
+	Difficulty_name = map[int32]string{
+		0: "DIFFICULTY_UNSPECIFIED",
+		1: "DIFFICULTY_EASY",
+		2: "DIFFICULTY_NORMAL",
+		3: "DIFFICULTY_HARD",
+	}
+	Difficulty_value = map[string]int32{
+		"DIFFICULTY_UNSPECIFIED": 0,
+		"DIFFICULTY_EASY":        1,
+		"DIFFICULTY_NORMAL":      2,
+		"DIFFICULTY_HARD":        3,
+	}
+)
+
+func (x Difficulty) Enum() *Difficulty {
+	p := new(Difficulty)
+	*p = x
+	return p
+}
+
+func (x Difficulty) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Difficulty) Descriptor() protoreflect.EnumDescriptor {
+	return file_recipe_proto_enumTypes[0].Descriptor()
+}
+
+func (Difficulty) Type() protoreflect.EnumType {
+	return &file_recipe_proto_enumTypes[0]
+}
+
+func (x Difficulty) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Difficulty.Descriptor instead.
+func (Difficulty) EnumDescriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{0}
+}
+
+type Recipe struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Id         string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name       string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Prep       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=prep,proto3" json:"prep,omitempty"`
+	Difficulty Difficulty             `protobuf:"varint,4,opt,name=difficulty,proto3,enum=hellofresh.recipe.v1.Difficulty" json:"difficulty,omitempty"`
+	Vegetarian bool                   `protobuf:"varint,5,opt,name=vegetarian,proto3" json:"vegetarian,omitempty"`
+	// version incremented on every update
+	Version       int32    `protobuf:"varint,6,opt,name=version,proto3" json:"version,omitempty"`
+	ExternalId    string   `protobuf:"bytes,7,opt,name=external_id,json=externalId,proto3" json:"external_id,omitempty"`
+	PrepMinutes   int32    `protobuf:"varint,8,opt,name=prep_minutes,json=prepMinutes,proto3" json:"prep_minutes,omitempty"`
+	CookMinutes   int32    `protobuf:"varint,9,opt,name=cook_minutes,json=cookMinutes,proto3" json:"cook_minutes,omitempty"`
+	Ingredients   []string `protobuf:"bytes,10,rep,name=ingredients,proto3" json:"ingredients,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Recipe) Reset() {
+	*x = Recipe{}
+	mi := &file_recipe_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Recipe) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Recipe) ProtoMessage() {}
+
+func (x *Recipe) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Recipe.ProtoReflect.Descriptor instead.
+func (*Recipe) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Recipe) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Recipe) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Recipe) GetPrep() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Prep
+	}
+	return nil
+}
+
+func (x *Recipe) GetDifficulty() Difficulty {
+	if x != nil {
+		return x.Difficulty
+	}
+	return Difficulty_DIFFICULTY_UNSPECIFIED
+}
+
+func (x *Recipe) GetVegetarian() bool {
+	if x != nil {
+		return x.Vegetarian
+	}
+	return false
+}
+
+func (x *Recipe) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Recipe) GetExternalId() string {
+	if x != nil {
+		return x.ExternalId
+	}
+	return ""
+}
+
+func (x *Recipe) GetPrepMinutes() int32 {
+	if x != nil {
+		return x.PrepMinutes
+	}
+	return 0
+}
+
+func (x *Recipe) GetCookMinutes() int32 {
+	if x != nil {
+		return x.CookMinutes
+	}
+	return 0
+}
+
+func (x *Recipe) GetIngredients() []string {
+	if x != nil {
+		return x.Ingredients
+	}
+	return nil
+}
+
+type RecipeRate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rate          int32                  `protobuf:"varint,1,opt,name=rate,proto3" json:"rate,omitempty"`
+	User          string                 `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	Modified      *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=modified,proto3" json:"modified,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RecipeRate) Reset() {
+	*x = RecipeRate{}
+	mi := &file_recipe_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RecipeRate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RecipeRate) ProtoMessage() {}
+
+func (x *RecipeRate) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RecipeRate.ProtoReflect.Descriptor instead.
+func (*RecipeRate) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RecipeRate) GetRate() int32 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+func (x *RecipeRate) GetUser() string {
+	if x != nil {
+		return x.User
+	}
+	return ""
+}
+
+func (x *RecipeRate) GetModified() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Modified
+	}
+	return nil
+}
+
+type RatingSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Average       float64                `protobuf:"fixed64,1,opt,name=average,proto3" json:"average,omitempty"`
+	Count         int32                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RatingSummary) Reset() {
+	*x = RatingSummary{}
+	mi := &file_recipe_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RatingSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RatingSummary) ProtoMessage() {}
+
+func (x *RatingSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RatingSummary.ProtoReflect.Descriptor instead.
+func (*RatingSummary) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RatingSummary) GetAverage() float64 {
+	if x != nil {
+		return x.Average
+	}
+	return 0
+}
+
+func (x *RatingSummary) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type GetRecipeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecipeRequest) Reset() {
+	*x = GetRecipeRequest{}
+	mi := &file_recipe_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecipeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecipeRequest) ProtoMessage() {}
+
+func (x *GetRecipeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecipeRequest.ProtoReflect.Descriptor instead.
+func (*GetRecipeRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetRecipeRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListRecipesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Start int32                  `protobuf:"varint,1,opt,name=start,proto3" json:"start,omitempty"`
+	// limit defaults to 10
+	Limit         int32 `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRecipesRequest) Reset() {
+	*x = ListRecipesRequest{}
+	mi := &file_recipe_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRecipesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRecipesRequest) ProtoMessage() {}
+
+func (x *ListRecipesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRecipesRequest.ProtoReflect.Descriptor instead.
+func (*ListRecipesRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListRecipesRequest) GetStart() int32 {
+	if x != nil {
+		return x.Start
+	}
+	return 0
+}
+
+func (x *ListRecipesRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type ListRecipesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Recipes       []*Recipe              `protobuf:"bytes,1,rep,name=recipes,proto3" json:"recipes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRecipesResponse) Reset() {
+	*x = ListRecipesResponse{}
+	mi := &file_recipe_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRecipesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRecipesResponse) ProtoMessage() {}
+
+func (x *ListRecipesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRecipesResponse.ProtoReflect.Descriptor instead.
+func (*ListRecipesResponse) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListRecipesResponse) GetRecipes() []*Recipe {
+	if x != nil {
+		return x.Recipes
+	}
+	return nil
+}
+
+type CreateRecipeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Recipe        *Recipe                `protobuf:"bytes,1,opt,name=recipe,proto3" json:"recipe,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRecipeRequest) Reset() {
+	*x = CreateRecipeRequest{}
+	mi := &file_recipe_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRecipeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRecipeRequest) ProtoMessage() {}
+
+func (x *CreateRecipeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRecipeRequest.ProtoReflect.Descriptor instead.
+func (*CreateRecipeRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CreateRecipeRequest) GetRecipe() *Recipe {
+	if x != nil {
+		return x.Recipe
+	}
+	return nil
+}
+
+type UpdateRecipeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// recipe.id identifies the recipe, id and version of the payload are otherwise ignored
+	Recipe *Recipe `protobuf:"bytes,1,opt,name=recipe,proto3" json:"recipe,omitempty"`
+	// expected_version plays the role of If-Match, 0 updates unconditionally
+	ExpectedVersion int32 `protobuf:"varint,2,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *UpdateRecipeRequest) Reset() {
+	*x = UpdateRecipeRequest{}
+	mi := &file_recipe_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateRecipeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateRecipeRequest) ProtoMessage() {}
+
+func (x *UpdateRecipeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateRecipeRequest.ProtoReflect.Descriptor instead.
+func (*UpdateRecipeRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *UpdateRecipeRequest) GetRecipe() *Recipe {
+	if x != nil {
+		return x.Recipe
+	}
+	return nil
+}
+
+func (x *UpdateRecipeRequest) GetExpectedVersion() int32 {
+	if x != nil {
+		return x.ExpectedVersion
+	}
+	return 0
+}
+
+type DeleteRecipeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// expected_version plays the role of If-Match, 0 deletes unconditionally
+	ExpectedVersion int32 `protobuf:"varint,2,opt,name=expected_version,json=expectedVersion,proto3" json:"expected_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *DeleteRecipeRequest) Reset() {
+	*x = DeleteRecipeRequest{}
+	mi := &file_recipe_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRecipeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRecipeRequest) ProtoMessage() {}
+
+func (x *DeleteRecipeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRecipeRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRecipeRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteRecipeRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteRecipeRequest) GetExpectedVersion() int32 {
+	if x != nil {
+		return x.ExpectedVersion
+	}
+	return 0
+}
+
+type DeleteRecipeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRecipeResponse) Reset() {
+	*x = DeleteRecipeResponse{}
+	mi := &file_recipe_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRecipeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRecipeResponse) ProtoMessage() {}
+
+func (x *DeleteRecipeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRecipeResponse.ProtoReflect.Descriptor instead.
+func (*DeleteRecipeResponse) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{9}
+}
+
+type RateRecipeRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// rate from 1 to 5
+	Rate          int32 `protobuf:"varint,2,opt,name=rate,proto3" json:"rate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RateRecipeRequest) Reset() {
+	*x = RateRecipeRequest{}
+	mi := &file_recipe_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RateRecipeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RateRecipeRequest) ProtoMessage() {}
+
+func (x *RateRecipeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RateRecipeRequest.ProtoReflect.Descriptor instead.
+func (*RateRecipeRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *RateRecipeRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RateRecipeRequest) GetRate() int32 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+type SearchRecipesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Search        string                 `protobuf:"bytes,1,opt,name=search,proto3" json:"search,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRecipesRequest) Reset() {
+	*x = SearchRecipesRequest{}
+	mi := &file_recipe_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRecipesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRecipesRequest) ProtoMessage() {}
+
+func (x *SearchRecipesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRecipesRequest.ProtoReflect.Descriptor instead.
+func (*SearchRecipesRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SearchRecipesRequest) GetSearch() string {
+	if x != nil {
+		return x.Search
+	}
+	return ""
+}
+
+type ExportRecipesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ratings       bool                   `protobuf:"varint,1,opt,name=ratings,proto3" json:"ratings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportRecipesRequest) Reset() {
+	*x = ExportRecipesRequest{}
+	mi := &file_recipe_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportRecipesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportRecipesRequest) ProtoMessage() {}
+
+func (x *ExportRecipesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportRecipesRequest.ProtoReflect.Descriptor instead.
+func (*ExportRecipesRequest) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ExportRecipesRequest) GetRatings() bool {
+	if x != nil {
+		return x.Ratings
+	}
+	return false
+}
+
+type ExportedRecipe struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Recipe        *Recipe                `protobuf:"bytes,1,opt,name=recipe,proto3" json:"recipe,omitempty"`
+	Ratings       []*RecipeRate          `protobuf:"bytes,2,rep,name=ratings,proto3" json:"ratings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExportedRecipe) Reset() {
+	*x = ExportedRecipe{}
+	mi := &file_recipe_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExportedRecipe) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExportedRecipe) ProtoMessage() {}
+
+func (x *ExportedRecipe) ProtoReflect() protoreflect.Message {
+	mi := &file_recipe_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExportedRecipe.ProtoReflect.Descriptor instead.
+func (*ExportedRecipe) Descriptor() ([]byte, []int) {
+	return file_recipe_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ExportedRecipe) GetRecipe() *Recipe {
+	if x != nil {
+		return x.Recipe
+	}
+	return nil
+}
+
+func (x *ExportedRecipe) GetRatings() []*RecipeRate {
+	if x != nil {
+		return x.Ratings
+	}
+	return nil
+}
+
+var File_recipe_proto protoreflect.FileDescriptor
+
+const file_recipe_proto_rawDesc = "" +
+	"\n" +
+	"\frecipe.proto\x12\x14hellofresh.recipe.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe1\x02\n" +
+	"\x06Recipe\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12.\n" +
+	"\x04prep\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04prep\x12@\n" +
+	"\n" +
+	"difficulty\x18\x04 \x01(\x0e2 .hellofresh.recipe.v1.DifficultyR\n" +
+	"difficulty\x12\x1e\n" +
+	"\n" +
+	"vegetarian\x18\x05 \x01(\bR\n" +
+	"vegetarian\x12\x18\n" +
+	"\aversion\x18\x06 \x01(\x05R\aversion\x12\x1f\n" +
+	"\vexternal_id\x18\a \x01(\tR\n" +
+	"externalId\x12!\n" +
+	"\fprep_minutes\x18\b \x01(\x05R\vprepMinutes\x12!\n" +
+	"\fcook_minutes\x18\t \x01(\x05R\vcookMinutes\x12 \n" +
+	"\vingredients\x18\n" +
+	" \x03(\tR\vingredients\"l\n" +
+	"\n" +
+	"RecipeRate\x12\x12\n" +
+	"\x04rate\x18\x01 \x01(\x05R\x04rate\x12\x12\n" +
+	"\x04user\x18\x02 \x01(\tR\x04user\x126\n" +
+	"\bmodified\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\bmodified\"?\n" +
+	"\rRatingSummary\x12\x18\n" +
+	"\aaverage\x18\x01 \x01(\x01R\aaverage\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x05R\x05count\"\"\n" +
+	"\x10GetRecipeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"@\n" +
+	"\x12ListRecipesRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\x05R\x05start\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\"M\n" +
+	"\x13ListRecipesResponse\x126\n" +
+	"\arecipes\x18\x01 \x03(\v2\x1c.hellofresh.recipe.v1.RecipeR\arecipes\"K\n" +
+	"\x13CreateRecipeRequest\x124\n" +
+	"\x06recipe\x18\x01 \x01(\v2\x1c.hellofresh.recipe.v1.RecipeR\x06recipe\"v\n" +
+	"\x13UpdateRecipeRequest\x124\n" +
+	"\x06recipe\x18\x01 \x01(\v2\x1c.hellofresh.recipe.v1.RecipeR\x06recipe\x12)\n" +
+	"\x10expected_version\x18\x02 \x01(\x05R\x0fexpectedVersion\"P\n" +
+	"\x13DeleteRecipeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12)\n" +
+	"\x10expected_version\x18\x02 \x01(\x05R\x0fexpectedVersion\"\x16\n" +
+	"\x14DeleteRecipeResponse\"7\n" +
+	"\x11RateRecipeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04rate\x18\x02 \x01(\x05R\x04rate\".\n" +
+	"\x14SearchRecipesRequest\x12\x16\n" +
+	"\x06search\x18\x01 \x01(\tR\x06search\"0\n" +
+	"\x14ExportRecipesRequest\x12\x18\n" +
+	"\aratings\x18\x01 \x01(\bR\aratings\"\x82\x01\n" +
+	"\x0eExportedRecipe\x124\n" +
+	"\x06recipe\x18\x01 \x01(\v2\x1c.hellofresh.recipe.v1.RecipeR\x06recipe\x12:\n" +
+	"\aratings\x18\x02 \x03(\v2 .hellofresh.recipe.v1.RecipeRateR\aratings*i\n" +
+	"\n" +
+	"Difficulty\x12\x1a\n" +
+	"\x16DIFFICULTY_UNSPECIFIED\x10\x00\x12\x13\n" +
+	"\x0fDIFFICULTY_EASY\x10\x01\x12\x15\n" +
+	"\x11DIFFICULTY_NORMAL\x10\x02\x12\x13\n" +
+	"\x0fDIFFICULTY_HARD\x10\x032\xd5\x05\n" +
+	"\rRecipeService\x12K\n" +
+	"\x03Get\x12&.hellofresh.recipe.v1.GetRecipeRequest\x1a\x1c.hellofresh.recipe.v1.Recipe\x12[\n" +
+	"\x04List\x12(.hellofresh.recipe.v1.ListRecipesRequest\x1a).hellofresh.recipe.v1.ListRecipesResponse\x12Q\n" +
+	"\x06Create\x12).hellofresh.recipe.v1.CreateRecipeRequest\x1a\x1c.hellofresh.recipe.v1.Recipe\x12Q\n" +
+	"\x06Update\x12).hellofresh.recipe.v1.UpdateRecipeRequest\x1a\x1c.hellofresh.recipe.v1.Recipe\x12_\n" +
+	"\x06Delete\x12).hellofresh.recipe.v1.DeleteRecipeRequest\x1a*.hellofresh.recipe.v1.DeleteRecipeResponse\x12T\n" +
+	"\x04Rate\x12'.hellofresh.recipe.v1.RateRecipeRequest\x1a#.hellofresh.recipe.v1.RatingSummary\x12_\n" +
+	"\x06Search\x12*.hellofresh.recipe.v1.SearchRecipesRequest\x1a).hellofresh.recipe.v1.ListRecipesResponse\x12\\\n" +
+	"\x06Export\x12*.hellofresh.recipe.v1.ExportRecipesRequest\x1a$.hellofresh.recipe.v1.ExportedRecipe0\x01B\x15Z\x13hellofresh/recipepbb\x06proto3"
+
+var (
+	file_recipe_proto_rawDescOnce sync.Once
+	file_recipe_proto_rawDescData []byte
+)
+
+func file_recipe_proto_rawDescGZIP() []byte {
+	file_recipe_proto_rawDescOnce.Do(func() {
+		file_recipe_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_recipe_proto_rawDesc), len(file_recipe_proto_rawDesc)))
+	})
+	return file_recipe_proto_rawDescData
+}
+
+var file_recipe_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_recipe_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_recipe_proto_goTypes = []any{
+	(Difficulty)(0),               // 0: hellofresh.recipe.v1.Difficulty
+	(*Recipe)(nil),                // 1: hellofresh.recipe.v1.Recipe
+	(*RecipeRate)(nil),            // 2: hellofresh.recipe.v1.RecipeRate
+	(*RatingSummary)(nil),         // 3: hellofresh.recipe.v1.RatingSummary
+	(*GetRecipeRequest)(nil),      // 4: hellofresh.recipe.v1.GetRecipeRequest
+	(*ListRecipesRequest)(nil),    // 5: hellofresh.recipe.v1.ListRecipesRequest
+	(*ListRecipesResponse)(nil),   // 6: hellofresh.recipe.v1.ListRecipesResponse
+	(*CreateRecipeRequest)(nil),   // 7: hellofresh.recipe.v1.CreateRecipeRequest
+	(*UpdateRecipeRequest)(nil),   // 8: hellofresh.recipe.v1.UpdateRecipeRequest
+	(*DeleteRecipeRequest)(nil),   // 9: hellofresh.recipe.v1.DeleteRecipeRequest
+	(*DeleteRecipeResponse)(nil),  // 10: hellofresh.recipe.v1.DeleteRecipeResponse
+	(*RateRecipeRequest)(nil),     // 11: hellofresh.recipe.v1.RateRecipeRequest
+	(*SearchRecipesRequest)(nil),  // 12: hellofresh.recipe.v1.SearchRecipesRequest
+	(*ExportRecipesRequest)(nil),  // 13: hellofresh.recipe.v1.ExportRecipesRequest
+	(*ExportedRecipe)(nil),        // 14: hellofresh.recipe.v1.ExportedRecipe
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_recipe_proto_depIdxs = []int32{
+	15, // 0: hellofresh.recipe.v1.Recipe.prep:type_name -> google.protobuf.Timestamp
+	0,  // 1: hellofresh.recipe.v1.Recipe.difficulty:type_name -> hellofresh.recipe.v1.Difficulty
+	15, // 2: hellofresh.recipe.v1.RecipeRate.modified:type_name -> google.protobuf.Timestamp
+	1,  // 3: hellofresh.recipe.v1.ListRecipesResponse.recipes:type_name -> hellofresh.recipe.v1.Recipe
+	1,  // 4: hellofresh.recipe.v1.CreateRecipeRequest.recipe:type_name -> hellofresh.recipe.v1.Recipe
+	1,  // 5: hellofresh.recipe.v1.UpdateRecipeRequest.recipe:type_name -> hellofresh.recipe.v1.Recipe
+	1,  // 6: hellofresh.recipe.v1.ExportedRecipe.recipe:type_name -> hellofresh.recipe.v1.Recipe
+	2,  // 7: hellofresh.recipe.v1.ExportedRecipe.ratings:type_name -> hellofresh.recipe.v1.RecipeRate
+	4,  // 8: hellofresh.recipe.v1.RecipeService.Get:input_type -> hellofresh.recipe.v1.GetRecipeRequest
+	5,  // 9: hellofresh.recipe.v1.RecipeService.List:input_type -> hellofresh.recipe.v1.ListRecipesRequest
+	7,  // 10: hellofresh.recipe.v1.RecipeService.Create:input_type -> hellofresh.recipe.v1.CreateRecipeRequest
+	8,  // 11: hellofresh.recipe.v1.RecipeService.Update:input_type -> hellofresh.recipe.v1.UpdateRecipeRequest
+	9,  // 12: hellofresh.recipe.v1.RecipeService.Delete:input_type -> hellofresh.recipe.v1.DeleteRecipeRequest
+	11, // 13: hellofresh.recipe.v1.RecipeService.Rate:input_type -> hellofresh.recipe.v1.RateRecipeRequest
+	12, // 14: hellofresh.recipe.v1.RecipeService.Search:input_type -> hellofresh.recipe.v1.SearchRecipesRequest
+	13, // 15: hellofresh.recipe.v1.RecipeService.Export:input_type -> hellofresh.recipe.v1.ExportRecipesRequest
+	1,  // 16: hellofresh.recipe.v1.RecipeService.Get:output_type -> hellofresh.recipe.v1.Recipe
+	6,  // 17: hellofresh.recipe.v1.RecipeService.List:output_type -> hellofresh.recipe.v1.ListRecipesResponse
+	1,  // 18: hellofresh.recipe.v1.RecipeService.Create:output_type -> hellofresh.recipe.v1.Recipe
+	1,  // 19: hellofresh.recipe.v1.RecipeService.Update:output_type -> hellofresh.recipe.v1.Recipe
+	10, // 20: hellofresh.recipe.v1.RecipeService.Delete:output_type -> hellofresh.recipe.v1.DeleteRecipeResponse
+	3,  // 21: hellofresh.recipe.v1.RecipeService.Rate:output_type -> hellofresh.recipe.v1.RatingSummary
+	6,  // 22: hellofresh.recipe.v1.RecipeService.Search:output_type -> hellofresh.recipe.v1.ListRecipesResponse
+	14, // 23: hellofresh.recipe.v1.RecipeService.Export:output_type -> hellofresh.recipe.v1.ExportedRecipe
+	16, // [16:24] is the sub-list for method output_type
+	8,  // [8:16] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_recipe_proto_init() }
+func file_recipe_proto_init() {
+	if File_recipe_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_recipe_proto_rawDesc), len(file_recipe_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_recipe_proto_goTypes,
+		DependencyIndexes: file_recipe_proto_depIdxs,
+		EnumInfos:         file_recipe_proto_enumTypes,
+		MessageInfos:      file_recipe_proto_msgTypes,
+	}.Build()
+	File_recipe_proto = out.File
+	file_recipe_proto_goTypes = nil
+	file_recipe_proto_depIdxs = nil
+}
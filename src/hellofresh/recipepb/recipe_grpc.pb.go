@@ -0,0 +1,399 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: recipe.proto
+
+package recipepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RecipeService_Get_FullMethodName    = "/hellofresh.recipe.v1.RecipeService/Get"
+	RecipeService_List_FullMethodName   = "/hellofresh.recipe.v1.RecipeService/List"
+	RecipeService_Create_FullMethodName = "/hellofresh.recipe.v1.RecipeService/Create"
+	RecipeService_Update_FullMethodName = "/hellofresh.recipe.v1.RecipeService/Update"
+	RecipeService_Delete_FullMethodName = "/hellofresh.recipe.v1.RecipeService/Delete"
+	RecipeService_Rate_FullMethodName   = "/hellofresh.recipe.v1.RecipeService/Rate"
+	RecipeService_Search_FullMethodName = "/hellofresh.recipe.v1.RecipeService/Search"
+	RecipeService_Export_FullMethodName = "/hellofresh.recipe.v1.RecipeService/Export"
+)
+
+// RecipeServiceClient is the client API for RecipeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RecipeService recipe API for internal services, mirrors the REST API
+// Create, Update, Delete, Rate and Export require basic auth credentials in the authorization metadata
+type RecipeServiceClient interface {
+	Get(ctx context.Context, in *GetRecipeRequest, opts ...grpc.CallOption) (*Recipe, error)
+	List(ctx context.Context, in *ListRecipesRequest, opts ...grpc.CallOption) (*ListRecipesResponse, error)
+	Create(ctx context.Context, in *CreateRecipeRequest, opts ...grpc.CallOption) (*Recipe, error)
+	Update(ctx context.Context, in *UpdateRecipeRequest, opts ...grpc.CallOption) (*Recipe, error)
+	Delete(ctx context.Context, in *DeleteRecipeRequest, opts ...grpc.CallOption) (*DeleteRecipeResponse, error)
+	Rate(ctx context.Context, in *RateRecipeRequest, opts ...grpc.CallOption) (*RatingSummary, error)
+	Search(ctx context.Context, in *SearchRecipesRequest, opts ...grpc.CallOption) (*ListRecipesResponse, error)
+	// Export stream every recipe, optionally with its ratings
+	Export(ctx context.Context, in *ExportRecipesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportedRecipe], error)
+}
+
+type recipeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRecipeServiceClient(cc grpc.ClientConnInterface) RecipeServiceClient {
+	return &recipeServiceClient{cc}
+}
+
+func (c *recipeServiceClient) Get(ctx context.Context, in *GetRecipeRequest, opts ...grpc.CallOption) (*Recipe, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Recipe)
+	err := c.cc.Invoke(ctx, RecipeService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) List(ctx context.Context, in *ListRecipesRequest, opts ...grpc.CallOption) (*ListRecipesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecipesResponse)
+	err := c.cc.Invoke(ctx, RecipeService_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) Create(ctx context.Context, in *CreateRecipeRequest, opts ...grpc.CallOption) (*Recipe, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Recipe)
+	err := c.cc.Invoke(ctx, RecipeService_Create_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) Update(ctx context.Context, in *UpdateRecipeRequest, opts ...grpc.CallOption) (*Recipe, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Recipe)
+	err := c.cc.Invoke(ctx, RecipeService_Update_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) Delete(ctx context.Context, in *DeleteRecipeRequest, opts ...grpc.CallOption) (*DeleteRecipeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteRecipeResponse)
+	err := c.cc.Invoke(ctx, RecipeService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) Rate(ctx context.Context, in *RateRecipeRequest, opts ...grpc.CallOption) (*RatingSummary, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RatingSummary)
+	err := c.cc.Invoke(ctx, RecipeService_Rate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) Search(ctx context.Context, in *SearchRecipesRequest, opts ...grpc.CallOption) (*ListRecipesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRecipesResponse)
+	err := c.cc.Invoke(ctx, RecipeService_Search_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *recipeServiceClient) Export(ctx context.Context, in *ExportRecipesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ExportedRecipe], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RecipeService_ServiceDesc.Streams[0], RecipeService_Export_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportRecipesRequest, ExportedRecipe]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RecipeService_ExportClient = grpc.ServerStreamingClient[ExportedRecipe]
+
+// RecipeServiceServer is the server API for RecipeService service.
+// All implementations must embed UnimplementedRecipeServiceServer
+// for forward compatibility.
+//
+// RecipeService recipe API for internal services, mirrors the REST API
+// Create, Update, Delete, Rate and Export require basic auth credentials in the authorization metadata
+type RecipeServiceServer interface {
+	Get(context.Context, *GetRecipeRequest) (*Recipe, error)
+	List(context.Context, *ListRecipesRequest) (*ListRecipesResponse, error)
+	Create(context.Context, *CreateRecipeRequest) (*Recipe, error)
+	Update(context.Context, *UpdateRecipeRequest) (*Recipe, error)
+	Delete(context.Context, *DeleteRecipeRequest) (*DeleteRecipeResponse, error)
+	Rate(context.Context, *RateRecipeRequest) (*RatingSummary, error)
+	Search(context.Context, *SearchRecipesRequest) (*ListRecipesResponse, error)
+	// Export stream every recipe, optionally with its ratings
+	Export(*ExportRecipesRequest, grpc.ServerStreamingServer[ExportedRecipe]) error
+	mustEmbedUnimplementedRecipeServiceServer()
+}
+
+// UnimplementedRecipeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRecipeServiceServer struct{}
+
+func (UnimplementedRecipeServiceServer) Get(context.Context, *GetRecipeRequest) (*Recipe, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedRecipeServiceServer) List(context.Context, *ListRecipesRequest) (*ListRecipesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedRecipeServiceServer) Create(context.Context, *CreateRecipeRequest) (*Recipe, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedRecipeServiceServer) Update(context.Context, *UpdateRecipeRequest) (*Recipe, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
+}
+func (UnimplementedRecipeServiceServer) Delete(context.Context, *DeleteRecipeRequest) (*DeleteRecipeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedRecipeServiceServer) Rate(context.Context, *RateRecipeRequest) (*RatingSummary, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rate not implemented")
+}
+func (UnimplementedRecipeServiceServer) Search(context.Context, *SearchRecipesRequest) (*ListRecipesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedRecipeServiceServer) Export(*ExportRecipesRequest, grpc.ServerStreamingServer[ExportedRecipe]) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedRecipeServiceServer) mustEmbedUnimplementedRecipeServiceServer() {}
+func (UnimplementedRecipeServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeRecipeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RecipeServiceServer will
+// result in compilation errors.
+type UnsafeRecipeServiceServer interface {
+	mustEmbedUnimplementedRecipeServiceServer()
+}
+
+func RegisterRecipeServiceServer(s grpc.ServiceRegistrar, srv RecipeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedRecipeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RecipeService_ServiceDesc, srv)
+}
+
+func _RecipeService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecipeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).Get(ctx, req.(*GetRecipeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRecipesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).List(ctx, req.(*ListRecipesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRecipeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).Create(ctx, req.(*CreateRecipeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRecipeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).Update(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_Update_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).Update(ctx, req.(*UpdateRecipeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRecipeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).Delete(ctx, req.(*DeleteRecipeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_Rate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RateRecipeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).Rate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_Rate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).Rate(ctx, req.(*RateRecipeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_Search_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRecipesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RecipeServiceServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RecipeService_Search_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RecipeServiceServer).Search(ctx, req.(*SearchRecipesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RecipeService_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRecipesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RecipeServiceServer).Export(m, &grpc.GenericServerStream[ExportRecipesRequest, ExportedRecipe]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RecipeService_ExportServer = grpc.ServerStreamingServer[ExportedRecipe]
+
+// RecipeService_ServiceDesc is the grpc.ServiceDesc for RecipeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RecipeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "hellofresh.recipe.v1.RecipeService",
+	HandlerType: (*RecipeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _RecipeService_Get_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _RecipeService_List_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _RecipeService_Create_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _RecipeService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _RecipeService_Delete_Handler,
+		},
+		{
+			MethodName: "Rate",
+			Handler:    _RecipeService_Rate_Handler,
+		},
+		{
+			MethodName: "Search",
+			Handler:    _RecipeService_Search_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Export",
+			Handler:       _RecipeService_Export_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "recipe.proto",
+}
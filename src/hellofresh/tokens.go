@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"hellofresh/model"
+	"hellofresh/util"
+	"net/http"
+	"time"
+)
+
+// token grant types of POST /auth/token, named like their OAuth2 counterparts
+const (
+	// passwordGrant exchange username and password for tokens
+	passwordGrant = "password"
+	// refreshTokenGrant exchange a refresh token for new tokens, roles are looked up again and the refresh token is rotated
+	refreshTokenGrant = "refresh_token"
+)
+
+// tokenRequest payload of POST /auth/token
+type tokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// issueToken POST /auth/token
+func (app *App) issueToken(w http.ResponseWriter, r *http.Request) {
+	signer := util.CurrentTokenSigner()
+	if signer == nil {
+		util.ResponseWithError(w, r, http.StatusForbidden, "Token authentication is disabled")
+		return
+	}
+
+	var request tokenRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	var principal *util.Principal
+	var err error
+	switch request.GrantType {
+	case passwordGrant:
+		principal, err = util.AuthenticateCredentials(request.Username, request.Password, util.ClientIP(r))
+	case refreshTokenGrant:
+		principal, err = app.exchangeRefreshToken(signer, request.RefreshToken)
+	default:
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Unsupported grant_type")
+		return
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+	if principal == nil {
+		util.ResponseWithError(w, r, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
+	tokens, refreshClaims, err := signer.IssueTokens(principal)
+	if err == nil {
+		refreshToken := &model.RefreshToken{ID: refreshClaims.ID, Subject: refreshClaims.Subject, Expires: time.Unix(refreshClaims.ExpiresAt, 0)}
+		err = refreshToken.StoreRefreshToken(app.DB)
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	util.Render(w, r, http.StatusOK, tokens)
+}
+
+// exchangeRefreshToken principal of token, nil unless it is valid, unused and still issued to the same account
+// a token presented twice was either stolen or replayed, so every refresh token of its subject is revoked
+func (app *App) exchangeRefreshToken(signer *util.TokenSigner, token string) (*util.Principal, error) {
+	claims, err := signer.Verify(token, util.RefreshToken)
+	if err != nil {
+		return nil, nil
+	}
+
+	consumed, err := model.ConsumeRefreshToken(app.DB, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, model.RevokeRefreshTokens(app.DB, claims.Subject)
+	}
+
+	// the account may have lost roles or been removed, and its username taken by a new account, since the token was issued
+	principal, err := util.LookupPrincipal(claims.Username)
+	if err != nil || principal == nil || principal.ID != claims.Subject {
+		return nil, err
+	}
+	return principal, nil
+}
+
+// revokeRequest payload of POST /auth/revoke
+type revokeRequest struct {
+	Token string `json:"token"`
+}
+
+// revokeToken POST /auth/revoke, revokes every refresh token of the subject of a refresh token
+// answers 200 for unknown and invalid tokens alike, like RFC 7009
+func (app *App) revokeToken(w http.ResponseWriter, r *http.Request) {
+	signer := util.CurrentTokenSigner()
+	if signer == nil {
+		util.ResponseWithError(w, r, http.StatusForbidden, "Token authentication is disabled")
+		return
+	}
+
+	var request revokeRequest
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	if claims, err := signer.Verify(request.Token, util.RefreshToken); err == nil {
+		if err := model.RevokeRefreshTokens(app.DB, claims.Subject); err != nil {
+			util.ResponseWithDomainError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
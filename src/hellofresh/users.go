@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hellofresh/config"
+	"hellofresh/model"
+	"hellofresh/util"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// userRequest payload of POST /users and POST /users/register, roles are only accepted from admins
+type userRequest struct {
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+// userStore util.UserStore of the accounts in the database
+type userStore struct {
+	db interface{}
+}
+
+// Authenticate principal of the account, nil for unknown usernames and wrong passwords
+func (store *userStore) Authenticate(username, password string) (*util.Principal, error) {
+	user, err := model.GetUserByName(store.db, username)
+	if _, ok := err.(*model.NotFoundError); ok {
+		model.CheckUnknownPassword(password)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.CheckPassword(password) {
+		return nil, nil
+	}
+	return user.Principal(), nil
+}
+
+// Lookup principal of the account, nil for unknown usernames
+func (store *userStore) Lookup(username string) (*util.Principal, error) {
+	user, err := model.GetUserByName(store.db, username)
+	if _, ok := err.(*model.NotFoundError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.Principal(), nil
+}
+
+// ensureAdmin create the account of the auth config as admin if it does not exist, so a fresh database can be managed
+// nothing is created without password, the placeholder password of config.json and too short ones are refused
+func (app *App) ensureAdmin() error {
+	auth := app.Config.AuthConfig
+	if auth.UserName == "" || auth.Password == "" {
+		return nil
+	}
+
+	_, err := model.GetUserByName(app.DB, auth.UserName)
+	if _, ok := err.(*model.NotFoundError); !ok {
+		return err
+	}
+
+	if config.IsPlaceholder(auth.Password) || len(auth.Password) < model.MinPasswordLength {
+		return fmt.Errorf("auth.password of the admin %q is a placeholder or shorter than %d bytes, set a password or leave it empty to create no admin", auth.UserName, model.MinPasswordLength)
+	}
+	user, err := model.NewUser(auth.UserName, auth.Password, []string{util.RoleAdmin})
+	if err != nil {
+		return err
+	}
+
+	// another instance may have created it meanwhile
+	if err := user.CreateUser(app.DB); err != nil {
+		if _, ok := err.(*model.ConflictError); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerUser POST /users/register
+func (app *App) registerUser(w http.ResponseWriter, r *http.Request) {
+	if app.Config == nil || !app.Config.AuthConfig.Registration {
+		util.ResponseWithError(w, r, http.StatusForbidden, "Registration is disabled")
+		return
+	}
+
+	var request userRequest
+	if !decodeUserRequest(w, r, &request) {
+		return
+	}
+
+	// registered accounts are customers, who may rate recipes
+	app.saveUser(w, r, request.Username, request.Password, []string{util.RoleRater})
+}
+
+// createUser POST /users
+func (app *App) createUser(w http.ResponseWriter, r *http.Request) {
+	var request userRequest
+	if !decodeUserRequest(w, r, &request) {
+		return
+	}
+
+	app.saveUser(w, r, request.Username, request.Password, request.Roles)
+}
+
+// getCurrentUser GET /users/me
+func (app *App) getCurrentUser(w http.ResponseWriter, r *http.Request) {
+	util.Render(w, r, http.StatusOK, util.PrincipalFrom(r.Context()))
+}
+
+// getUserRecipes GET /users/{id}/recipes
+func (app *App) getUserRecipes(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	recipe := &model.Recipe{}
+	recipes, err := recipe.FindRecipes(app.DB, &model.RecipeFilter{CreatedBy: mux.Vars(r)["id"]}, offset, limit)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	app.responseWithRecipes(w, r, recipes)
+}
+
+// saveUser create account and write it without its password hash
+func (app *App) saveUser(w http.ResponseWriter, r *http.Request, username, password string, roles []string) {
+	user, err := model.NewUser(username, password, roles)
+	if err == nil {
+		err = user.CreateUser(app.DB)
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.Render(w, r, http.StatusCreated, user)
+}
+
+// decodeUserRequest decode request body into request
+// writes the error response and returns false when the payload is malformed
+func decodeUserRequest(w http.ResponseWriter, r *http.Request, request *userRequest) bool {
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return false
+	}
+	return true
+}
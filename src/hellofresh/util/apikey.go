@@ -0,0 +1,31 @@
+package util
+
+// APIKeyHeader request header, and lowercase gRPC metadata key, carrying an API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyStore API keys of service-to-service clients
+type APIKeyStore interface {
+	// AuthenticateAPIKey principal of the key, nil if it is unknown, revoked or expired
+	AuthenticateAPIKey(key string) (*Principal, error)
+}
+
+// apiKeyStore store registered by the app, API keys are rejected until a database is opened
+var apiKeyStore APIKeyStore
+
+// SetAPIKeyStore check API keys against store
+func SetAPIKeyStore(store APIKeyStore) {
+	apiKeyStore = store
+}
+
+// AuthenticateAPIKey principal of key sent from the client IP, nil if there is no store or the key is not active
+// a request with a key is authenticated by the key only, REST and gRPC alike, so an invalid key never falls back to other credentials
+func AuthenticateAPIKey(key, client string) (*Principal, error) {
+	if apiKeyStore == nil || key == "" {
+		return nil, nil
+	}
+	principal, err := apiKeyStore.AuthenticateAPIKey(key)
+	if err == nil && principal == nil {
+		auditAuthFailure("", client, "invalid API key")
+	}
+	return principal, err
+}
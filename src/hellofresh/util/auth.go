@@ -2,45 +2,242 @@
 package util
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"hellofresh/config"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
-// BasicAuth HandlerFunc
-func BasicAuth(h http.HandlerFunc) http.HandlerFunc {
+// roles which can be granted to users, each role has the permissions of the roles before it, see rolePermissions
+const (
+	// RoleViewer role allowed to export recipes
+	RoleViewer = "viewer"
+	// RoleRater role allowed to rate recipes, granted to registered accounts
+	RoleRater = "rater"
+	// RoleEditor role allowed to create, change and import recipes
+	RoleEditor = "editor"
+	// RoleAdmin role allowed to delete recipes and manage user accounts
+	RoleAdmin = "admin"
+)
+
+// Principal authenticated caller, attached to the request context by RequireAuth
+type Principal struct {
+	ID       string   `json:"id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+	// Scopes permissions granted directly, to API keys
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// HasRole principal was granted role
+func (principal *Principal) HasRole(role string) bool {
+	for _, granted := range principal.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// UserStore user accounts credentials are checked against
+type UserStore interface {
+	// Authenticate principal of the account, nil if username and password do not match one
+	Authenticate(username, password string) (*Principal, error)
+	// Lookup principal of the account with the current roles, nil if there is no such account
+	Lookup(username string) (*Principal, error)
+}
+
+// userStore store registered by the app, nil until a database is opened
+var userStore UserStore
+
+// SetUserStore check credentials against the accounts of store
+// without a store, e.g. in tests without database, the credential of the auth config is the only account
+func SetUserStore(store UserStore) {
+	userStore = store
+}
+
+// principalContextKey context key of the authenticated principal
+type principalContextKey struct{}
+
+// WithPrincipal context carrying the authenticated principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFrom principal attached to ctx, nil for anonymous callers
+func PrincipalFrom(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return principal
+}
+
+// RequireAuth middleware rejecting requests without valid credentials of the configured auth type or an API key
+// basic auth credentials, or bearer access tokens while a token signer is set, the principal is attached to the request context
+func RequireAuth(h http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		config, err := config.GetConfig()
+		if tokenSigner != nil || tokenIntrospector != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+		} else {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		}
+
+		principal, err := Authenticate(r)
 		if err != nil {
-			PanicOnError(err)
+			ResponseWithDomainError(w, r, err)
+			return
 		}
+		if principal == nil {
+			ResponseWithError(w, r, http.StatusUnauthorized, "Not authorized")
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(WithClientIP(WithPrincipal(r.Context(), principal), ClientIP(r))))
+	}
+}
 
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+// Authenticate principal of the partner signature, the API key or the credentials of the request, nil if they are missing or wrong
+// signed requests have their body read and restored, shared by RequireAuth and handlers protecting only part of their work, such as GraphQL mutations
+func Authenticate(r *http.Request) (*Principal, error) {
+	authorization := r.Header.Get("Authorization")
+	if s := strings.SplitN(authorization, " ", 2); len(s) == 2 && strings.EqualFold(s[0], SignatureScheme) {
+		return AuthenticateSignature(r, s[1])
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return AuthenticateAPIKey(key, ClientIP(r))
+	}
+	return AuthenticateHeader(authorization, ClientIP(r))
+}
 
-		s := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
-		if len(s) != 2 {
-			http.Error(w, "Not authorized", 401)
-			return
+// AuthenticateHeader principal of the credentials of an authorization header value sent from the client IP
+// also used for the authorization metadata of gRPC calls
+func AuthenticateHeader(authorization, client string) (*Principal, error) {
+	s := strings.SplitN(authorization, " ", 2)
+	if len(s) != 2 {
+		return nil, nil
+	}
+
+	if tokenSigner != nil {
+		if !strings.EqualFold(s[0], "Bearer") {
+			return nil, nil
+		}
+		claims, err := tokenSigner.Verify(s[1], AccessToken)
+		if err != nil {
+			auditAuthFailure("", client, "invalid bearer token: "+err.Error())
+			return nil, nil
 		}
+		return claims.Principal(), nil
+	}
 
-		b, err := base64.StdEncoding.DecodeString(s[1])
+	if tokenIntrospector != nil {
+		if !strings.EqualFold(s[0], "Bearer") {
+			return nil, nil
+		}
+		introspection, err := tokenIntrospector.Introspect(s[1])
 		if err != nil {
-			http.Error(w, err.Error(), 401)
-			return
+			return nil, err
 		}
+		if !introspection.Active || introspection.ExpiresAt != 0 && time.Now().Unix() >= introspection.ExpiresAt {
+			auditAuthFailure("", client, "inactive bearer token")
+			return nil, nil
+		}
+		return introspection.Principal(), nil
+	}
 
-		pair := strings.SplitN(string(b), ":", 2)
-		if len(pair) != 2 {
-			http.Error(w, "Not authorized", 401)
-			return
+	if !strings.EqualFold(s[0], "Basic") {
+		return nil, nil
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return nil, nil
+	}
+
+	pair := strings.SplitN(string(b), ":", 2)
+	if len(pair) != 2 {
+		return nil, nil
+	}
+	return AuthenticateCredentials(pair[0], pair[1], client)
+}
+
+// AuthenticateCredentials principal of username and password sent from the client IP, nil if they do not match an account
+// LockedOutError while the login guard blocks the username or client after failed attempts
+func AuthenticateCredentials(username, password, client string) (*Principal, error) {
+	guard := loginGuard
+	if guard != nil {
+		if err := guard.Check(username, client); err != nil {
+			auditAuthFailure(username, client, "locked out")
+			return nil, err
 		}
+	}
 
-		if pair[0] != config.AuthConfig.UserName || pair[1] != config.AuthConfig.Password {
-			http.Error(w, "Not authorized", 401)
-			return
+	principal, err := checkCredentials(username, password)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		auditAuthFailure(username, client, "wrong username or password")
+		if guard != nil {
+			guard.Fail(username, client)
 		}
+		return nil, nil
+	}
+
+	if guard != nil {
+		guard.Succeed(username)
+	}
+	return principal, nil
+}
+
+// checkCredentials principal of the account of username if password matches, nil otherwise
+// without user store both are compared in constant time with the account of the auth config, which needs a password
+func checkCredentials(username, password string) (*Principal, error) {
+	if userStore != nil {
+		return userStore.Authenticate(username, password)
+	}
+
+	principal, configured := configAccount()
+	if configured == "" {
+		return nil, nil
+	}
+	usernameMatches := subtle.ConstantTimeCompare([]byte(username), []byte(principal.Username))
+	passwordMatches := subtle.ConstantTimeCompare([]byte(password), []byte(configured))
+	if usernameMatches&passwordMatches != 1 {
+		return nil, nil
+	}
+	return principal, nil
+}
+
+// LookupPrincipal principal of the account of username with its current roles, nil if there is none
+func LookupPrincipal(username string) (*Principal, error) {
+	if userStore != nil {
+		return userStore.Lookup(username)
+	}
 
-		h.ServeHTTP(w, r)
+	if principal, _ := configAccount(); username == principal.Username {
+		return principal, nil
 	}
+	return nil, nil
+}
+
+// configAuth auth config read once by configAccount
+var configAuth struct {
+	once     sync.Once
+	username string
+	password string
+}
+
+// configAccount admin account of the auth config and its password, the only account without user store
+// config.json is read on first use rather than on every request
+func configAccount() (*Principal, string) {
+	configAuth.once.Do(func() {
+		config, err := config.GetConfig()
+		if err != nil {
+			PanicOnError(err)
+		}
+		configAuth.username, configAuth.password = config.AuthConfig.UserName, config.AuthConfig.Password
+	})
+	return &Principal{Username: configAuth.username, Roles: []string{RoleAdmin}}, configAuth.password
 }
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// authAuditQueueSize failed authentications waiting to be recorded, beyond it they are only logged
+// so a flood of bad credentials can not pile up writes
+const authAuditQueueSize = 1000
+
+// AuthFailure failed authentication, passwords and keys are never part of it
+type AuthFailure struct {
+	// Username attempted username or keyId, empty for API keys and bearer tokens
+	Username string
+	Client   string
+	Reason   string
+	Time     time.Time
+}
+
+// AuthAuditor persistent record of failed authentications
+type AuthAuditor interface {
+	AuditAuthFailure(failure *AuthFailure) error
+}
+
+// authAudit queue of the failures to be recorded by the auditor registered by the app, nil without one
+var authAudit struct {
+	sync.Mutex
+	queue chan *AuthFailure
+}
+
+// SetAuthAuditor record failed authentications with auditor in the background, nil stops recording them
+func SetAuthAuditor(auditor AuthAuditor) {
+	authAudit.Lock()
+	defer authAudit.Unlock()
+
+	if authAudit.queue != nil {
+		close(authAudit.queue)
+		authAudit.queue = nil
+	}
+	if auditor == nil {
+		return
+	}
+
+	queue := make(chan *AuthFailure, authAuditQueueSize)
+	authAudit.queue = queue
+	go func() {
+		for failure := range queue {
+			if err := auditor.AuditAuthFailure(failure); err != nil {
+				log.Printf("audit auth failure of %q from %s: %v", failure.Username, failure.Client, err)
+			}
+		}
+	}()
+}
+
+// auditAuthFailure log a failed authentication and queue it for the auditor, for the audit of brute-force attempts
+// authentication never waits for the record, failures which do not fit into the queue are only logged
+func auditAuthFailure(username, client, reason string) {
+	log.Printf("auth failure: username=%q client=%s reason=%s", username, client, reason)
+
+	authAudit.Lock()
+	defer authAudit.Unlock()
+	if authAudit.queue == nil {
+		return
+	}
+	select {
+	case authAudit.queue <- &AuthFailure{Username: username, Client: client, Reason: reason, Time: time.Now().UTC()}:
+	default:
+		log.Printf("auth failure audit queue full, failure of %q from %s is only logged", username, client)
+	}
+}
@@ -0,0 +1,45 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// BodyTooLargeError request body exceeds the max body size
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+// Error error message
+func (err *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("Request bodies must not exceed %d bytes", err.Limit)
+}
+
+// Problem 413 problem details
+func (err *BodyTooLargeError) Problem() *Problem {
+	return NewProblem(http.StatusRequestEntityTooLarge, "", err.Error())
+}
+
+// ReadBody read the body of r, at most limit bytes, and replace it with a reader of the same bytes
+// bodies announced or found to be larger fail with BodyTooLargeError without being read whole
+func ReadBody(r *http.Request, limit int64) ([]byte, error) {
+	if r.ContentLength > limit {
+		return nil, &BodyTooLargeError{Limit: limit}
+	}
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, limit))
+	r.Body.Close()
+	if _, tooLarge := err.(*http.MaxBytesError); tooLarge {
+		return nil, &BodyTooLargeError{Limit: limit}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,104 @@
+package util
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidETag entity tag can not be parsed into a version
+var ErrInvalidETag = errors.New("Invalid entity tag")
+
+// ETag strong entity tag of a versioned resource in its JSON representation
+func ETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// RepresentationETag strong entity tag of version in mediaType, tags of other representations than JSON carry their subtype
+// e.g. "3-xml", as strong tags of different representations must differ
+func RepresentationETag(version int, mediaType string) string {
+	subtype := strings.TrimPrefix(mediaType[strings.Index(mediaType, "/")+1:], "x-")
+	if subtype == "json" {
+		return ETag(version)
+	}
+	return fmt.Sprintf(`"%d-%s"`, version, subtype)
+}
+
+// WeakETag weak entity tag computed from payload, used for collections
+func WeakETag(payload []byte) string {
+	sum := sha1.Sum(payload)
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:]))
+}
+
+// ParseETag parse version from strong entity tag of any representation
+func ParseETag(etag string) (int, error) {
+	etag = strings.TrimSpace(etag)
+	if strings.HasPrefix(etag, "W/") || len(etag) < 2 || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		return 0, ErrInvalidETag
+	}
+
+	value := etag[1 : len(etag)-1]
+	if i := strings.Index(value, "-"); i > 0 {
+		value = value[:i]
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, ErrInvalidETag
+	}
+	return version, nil
+}
+
+// IfMatchVersions versions listed by If-Match header, present is false when header is missing
+// "*" is present without versions and matches any stored recipe, weak tags never match as If-Match compares strongly
+func IfMatchVersions(r *http.Request) (versions []int, present bool, err error) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return nil, false, nil
+	}
+	if ifMatch == "*" {
+		return nil, true, nil
+	}
+
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+
+		version, err := ParseETag(candidate)
+		if err != nil {
+			return nil, true, err
+		}
+		versions = append(versions, version)
+	}
+
+	if len(versions) == 0 {
+		return nil, true, ErrInvalidETag
+	}
+	return versions, true, nil
+}
+
+// SetETag set ETag header and write 304 Not Modified if If-None-Match matches
+// returns true when the response has been written
+func SetETag(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// weak comparison as defined in RFC 7232
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package util
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// fingerprintContextKey context key of the fingerprint of an anonymous client
+type fingerprintContextKey struct{}
+
+// trustedProxies networks of the reverse proxies whose X-Forwarded-For header is believed, none by default
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies believe the X-Forwarded-For header of requests sent from proxies, IP addresses or CIDR networks
+func SetTrustedProxies(proxies []string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("trusted proxy %q is neither an IP address nor a CIDR network", proxy)
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("trusted proxy %q: %v", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+	trustedProxies = networks
+	return nil
+}
+
+// ClientIP IP address the request was sent from, taken from X-Forwarded-For when it was sent by a trusted proxy
+func ClientIP(r *http.Request) string {
+	return ForwardedClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+}
+
+// ForwardedClientIP IP address of the client of a connection from remote, which forwarded lists when it is a trusted proxy
+// the list is read from the right, the first address which is not a trusted proxy is the client, earlier ones may be forged
+func ForwardedClientIP(remote string, forwarded []string) string {
+	client := remote
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		client = host
+	}
+
+	var hops []string
+	for _, header := range forwarded {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0 && trustedProxy(client); i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		client = hops[i]
+	}
+	return client
+}
+
+// trustedProxy address is one of the trusted proxies
+func trustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fingerprint identity of an anonymous client, its IP address and user agent hashed with salt so neither is stored
+// behind a reverse proxy the IP address is the forwarded one, so clients of the proxy are told apart once it is trusted
+func Fingerprint(r *http.Request, salt string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(ClientIP(r) + "\n" + r.UserAgent()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WithFingerprint context carrying the fingerprint of an anonymous client
+func WithFingerprint(ctx context.Context, fingerprint string) context.Context {
+	return context.WithValue(ctx, fingerprintContextKey{}, fingerprint)
+}
+
+// FingerprintFrom fingerprint attached to ctx, empty for authenticated callers
+func FingerprintFrom(ctx context.Context) string {
+	fingerprint, _ := ctx.Value(fingerprintContextKey{}).(string)
+	return fingerprint
+}
+
+// HasCredentials request carries an API key or an authorization header, whether valid or not
+func HasCredentials(r *http.Request) bool {
+	return r.Header.Get(APIKeyHeader) != "" || r.Header.Get("Authorization") != ""
+}
+
+// clientIPContextKey context key of the IP address of the client
+type clientIPContextKey struct{}
+
+// WithClientIP context carrying the IP address of the client, recorded by the audit log
+func WithClientIP(ctx context.Context, client string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, client)
+}
+
+// ClientIPFrom client IP attached to ctx, empty if unknown
+func ClientIPFrom(ctx context.Context) string {
+	client, _ := ctx.Value(clientIPContextKey{}).(string)
+	return client
+}
@@ -0,0 +1,267 @@
+package util
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hellofresh/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default introspection settings, used when the oauth2 config leaves them empty
+const (
+	defaultIntrospectionCacheTTL = time.Minute
+	defaultIntrospectionTimeout  = 5 * time.Second
+)
+
+// maxCachedIntrospections number of cached results, the least recently used one is evicted beyond
+const maxCachedIntrospections = 10000
+
+// Introspection RFC 7662 introspection response, only active is set for inactive tokens
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope"`
+	ClientID  string `json:"client_id"`
+	Username  string `json:"username"`
+	Subject   string `json:"sub"`
+	TokenType string `json:"token_type"`
+	ExpiresAt int64  `json:"exp"`
+	// Audience string or array of strings
+	Audience interface{} `json:"aud"`
+}
+
+// TokenIntrospector backend validating opaque access tokens
+type TokenIntrospector interface {
+	// Introspect state of token, errors are reserved for an unavailable backend
+	Introspect(token string) (*Introspection, error)
+}
+
+// tokenIntrospector introspector registered by the app, opaque bearer tokens replace basic auth while it is set
+var tokenIntrospector TokenIntrospector
+
+// SetTokenIntrospector accept bearer tokens active according to introspector, nil switches back to basic auth
+func SetTokenIntrospector(introspector TokenIntrospector) {
+	tokenIntrospector = introspector
+}
+
+// HTTPIntrospector RFC 7662 client of the introspection endpoint of an identity provider
+type HTTPIntrospector struct {
+	endpoint     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+}
+
+// CachingIntrospector introspector reusing the results of another one
+// active results are kept for the cache TTL and never beyond the expiry of the token, so revocations take up to the TTL
+// inactive results are not cached, concurrent introspections of a token share one request to the backend
+type CachingIntrospector struct {
+	backend TokenIntrospector
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	results  map[string]*list.Element
+	order    *list.List
+	inflight map[string]*introspectionCall
+}
+
+// cachedIntrospection introspection result of the token hashed to key and when it must be fetched again
+type cachedIntrospection struct {
+	key           string
+	introspection *Introspection
+	expires       time.Time
+}
+
+// introspectionCall request to the backend other introspections of the same token wait for
+type introspectionCall struct {
+	done          chan struct{}
+	introspection *Introspection
+	err           error
+}
+
+// NewIntrospector caching HTTP introspector of the oauth2 config
+func NewIntrospector(oauth2 config.OAuth2Config) (*CachingIntrospector, error) {
+	if _, err := url.ParseRequestURI(oauth2.IntrospectionURL); err != nil {
+		return nil, fmt.Errorf("oauth2.introspectionURL: %v", err)
+	}
+
+	timeout, cacheTTL := defaultIntrospectionTimeout, defaultIntrospectionCacheTTL
+	var err error
+	if oauth2.Timeout != "" {
+		if timeout, err = time.ParseDuration(oauth2.Timeout); err != nil {
+			return nil, fmt.Errorf("oauth2.timeout: %v", err)
+		}
+	}
+	if oauth2.CacheTTL != "" {
+		if cacheTTL, err = time.ParseDuration(oauth2.CacheTTL); err != nil {
+			return nil, fmt.Errorf("oauth2.cacheTTL: %v", err)
+		}
+	}
+
+	if config.IsPlaceholder(oauth2.ClientSecret) {
+		return nil, fmt.Errorf("oauth2.clientSecret: refusing placeholder secret, set the client secret registered at the identity provider")
+	}
+
+	backend := &HTTPIntrospector{
+		endpoint:     oauth2.IntrospectionURL,
+		clientID:     oauth2.ClientID,
+		clientSecret: oauth2.ClientSecret,
+		client:       &http.Client{Timeout: timeout},
+	}
+	return NewCachingIntrospector(&audienceIntrospector{backend: backend, audience: oauth2.Audience}, cacheTTL), nil
+}
+
+// NewCachingIntrospector cache the results of backend for ttl
+func NewCachingIntrospector(backend TokenIntrospector, ttl time.Duration) *CachingIntrospector {
+	return &CachingIntrospector{
+		backend:  backend,
+		ttl:      ttl,
+		now:      time.Now,
+		results:  map[string]*list.Element{},
+		order:    list.New(),
+		inflight: map[string]*introspectionCall{},
+	}
+}
+
+// SetClock time source of the cache expiries, time.Now unless replaced
+func (introspector *CachingIntrospector) SetClock(now func() time.Time) {
+	introspector.mu.Lock()
+	defer introspector.mu.Unlock()
+	introspector.now = now
+}
+
+// Introspect POST token to the introspection endpoint, authenticated with the client credentials
+func (introspector *HTTPIntrospector) Introspect(token string) (*Introspection, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest("POST", introspector.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if introspector.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(introspector.clientID), url.QueryEscape(introspector.clientSecret))
+	}
+
+	res, err := introspector.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token introspection: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection: status %d", res.StatusCode)
+	}
+
+	introspection := &Introspection{}
+	if err := json.NewDecoder(res.Body).Decode(introspection); err != nil {
+		return nil, fmt.Errorf("token introspection: %v", err)
+	}
+	return introspection, nil
+}
+
+// Introspect cached result for token, the backend is only asked on a miss
+// tokens are cached by their hash so the cache never holds usable tokens
+func (introspector *CachingIntrospector) Introspect(token string) (*Introspection, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	introspector.mu.Lock()
+	if element, ok := introspector.results[key]; ok {
+		cached := element.Value.(*cachedIntrospection)
+		if introspector.now().Before(cached.expires) {
+			introspector.order.MoveToFront(element)
+			introspector.mu.Unlock()
+			return cached.introspection, nil
+		}
+		introspector.order.Remove(element)
+		delete(introspector.results, key)
+	}
+	if call, ok := introspector.inflight[key]; ok {
+		introspector.mu.Unlock()
+		<-call.done
+		return call.introspection, call.err
+	}
+	call := &introspectionCall{done: make(chan struct{})}
+	introspector.inflight[key] = call
+	introspector.mu.Unlock()
+
+	call.introspection, call.err = introspector.backend.Introspect(token)
+
+	introspector.mu.Lock()
+	delete(introspector.inflight, key)
+	if call.err == nil && call.introspection.Active {
+		introspector.store(key, call.introspection)
+	}
+	introspector.mu.Unlock()
+	close(call.done)
+	return call.introspection, call.err
+}
+
+// store cache the active introspection of key until the TTL or its expiry, evicting the least recently used result when full
+func (introspector *CachingIntrospector) store(key string, introspection *Introspection) {
+	expires := introspector.now().Add(introspector.ttl)
+	if introspection.ExpiresAt != 0 && time.Unix(introspection.ExpiresAt, 0).Before(expires) {
+		expires = time.Unix(introspection.ExpiresAt, 0)
+	}
+
+	if introspector.order.Len() >= maxCachedIntrospections {
+		oldest := introspector.order.Back()
+		introspector.order.Remove(oldest)
+		delete(introspector.results, oldest.Value.(*cachedIntrospection).key)
+	}
+	cached := &cachedIntrospection{key: key, introspection: introspection, expires: expires}
+	introspector.results[key] = introspector.order.PushFront(cached)
+}
+
+// audienceIntrospector introspector reporting tokens of other audiences as inactive
+type audienceIntrospector struct {
+	backend  TokenIntrospector
+	audience string
+}
+
+// Introspect result of the backend, inactive unless audience is one of the aud of the token
+func (introspector *audienceIntrospector) Introspect(token string) (*Introspection, error) {
+	introspection, err := introspector.backend.Introspect(token)
+	if err != nil || introspector.audience == "" || !introspection.Active {
+		return introspection, err
+	}
+	if !introspection.HasAudience(introspector.audience) {
+		return &Introspection{Active: false}, nil
+	}
+	return introspection, nil
+}
+
+// HasAudience audience is the aud of the token or one of them
+func (introspection *Introspection) HasAudience(audience string) bool {
+	switch aud := introspection.Audience.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Principal principal of an active token, its scopes are its permissions
+// tokens of the client credentials flow have no user and authenticate their client
+func (introspection *Introspection) Principal() *Principal {
+	id, username := introspection.Subject, introspection.Username
+	if id == "" {
+		id = introspection.ClientID
+	}
+	if username == "" {
+		username = introspection.ClientID
+	}
+	return &Principal{ID: id, Username: username, Roles: []string{}, Scopes: strings.Fields(introspection.Scope)}
+}
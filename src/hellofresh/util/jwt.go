@@ -0,0 +1,329 @@
+package util
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hellofresh/config"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// token uses, a refresh token is never accepted as access token and vice versa
+const (
+	// AccessToken token authenticating requests
+	AccessToken = "access"
+	// RefreshToken token exchanged for a new token pair
+	RefreshToken = "refresh"
+)
+
+// default token lifetimes, used when the jwt config leaves them empty
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// minSecretLength minimum length of HS256 secrets, the size of the SHA-256 output
+const minSecretLength = 32
+
+// ErrInvalidToken token is malformed, expired, of another use or not signed by a known key
+var ErrInvalidToken = errors.New("invalid token")
+
+// TokenClaims claims of access and refresh tokens
+type TokenClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub"`
+	Username  string   `json:"preferred_username"`
+	Roles     []string `json:"roles"`
+	Use       string   `json:"token_use"`
+	ID        string   `json:"jti"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// TokenPair tokens issued by POST /auth/token, named like an OAuth2 token response
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// tokenHeader JOSE header of a token
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// tokenKey HS256 secret or RS256 key pair, private is nil for verification only keys
+type tokenKey struct {
+	id        string
+	algorithm string
+	secret    []byte
+	private   *rsa.PrivateKey
+	public    *rsa.PublicKey
+}
+
+// TokenSigner signs tokens with the current key and verifies them with every configured key
+type TokenSigner struct {
+	issuer     string
+	signing    *tokenKey
+	keys       map[string]*tokenKey
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// tokenSigner signer registered by the app, bearer tokens replace basic auth while it is set
+var tokenSigner *TokenSigner
+
+// SetTokenSigner accept bearer tokens of signer instead of basic auth credentials, nil switches back to basic auth
+func SetTokenSigner(signer *TokenSigner) {
+	tokenSigner = signer
+}
+
+// CurrentTokenSigner signer set by SetTokenSigner, nil unless the auth type is jwt
+func CurrentTokenSigner() *TokenSigner {
+	return tokenSigner
+}
+
+// NewTokenSigner signer of the jwt config, keys are loaded and checked up front
+func NewTokenSigner(jwt config.JWTConfig) (*TokenSigner, error) {
+	signer := &TokenSigner{issuer: jwt.Issuer, keys: map[string]*tokenKey{}, accessTTL: defaultAccessTTL, refreshTTL: defaultRefreshTTL}
+
+	var err error
+	if jwt.AccessTTL != "" {
+		if signer.accessTTL, err = time.ParseDuration(jwt.AccessTTL); err != nil {
+			return nil, fmt.Errorf("jwt.accessTTL: %v", err)
+		}
+	}
+	if jwt.RefreshTTL != "" {
+		if signer.refreshTTL, err = time.ParseDuration(jwt.RefreshTTL); err != nil {
+			return nil, fmt.Errorf("jwt.refreshTTL: %v", err)
+		}
+	}
+
+	for _, configured := range jwt.Keys {
+		key, err := loadTokenKey(configured)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %v", configured.ID, err)
+		}
+		signer.keys[key.id] = key
+	}
+
+	signer.signing = signer.keys[jwt.SigningKey]
+	if signer.signing == nil {
+		return nil, fmt.Errorf("jwt.signingKey %q is not one of the keys", jwt.SigningKey)
+	}
+	if signer.signing.algorithm == "RS256" && signer.signing.private == nil {
+		return nil, fmt.Errorf("jwt.signingKey %q has no private key", jwt.SigningKey)
+	}
+	return signer, nil
+}
+
+// loadTokenKey key of config, reading RS256 keys from their PEM files
+func loadTokenKey(configured config.JWTKey) (*tokenKey, error) {
+	if configured.ID == "" {
+		return nil, errors.New("kid is required")
+	}
+
+	key := &tokenKey{id: configured.ID, algorithm: configured.Algorithm}
+	switch configured.Algorithm {
+	case "HS256":
+		if len(configured.Secret) < minSecretLength {
+			return nil, fmt.Errorf("secret must have at least %d bytes", minSecretLength)
+		}
+		if config.IsPlaceholder(configured.Secret) {
+			return nil, errors.New("secret is the placeholder of config.json, set a random secret")
+		}
+		key.secret = []byte(configured.Secret)
+	case "RS256":
+		if configured.PrivateKeyFile != "" {
+			block, err := readPEM(configured.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if key.private, err = parseRSAPrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+			key.public = &key.private.PublicKey
+		} else if configured.PublicKeyFile != "" {
+			block, err := readPEM(configured.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			var ok bool
+			if key.public, ok = parsed.(*rsa.PublicKey); !ok {
+				return nil, errors.New("public key is not an RSA key")
+			}
+		} else {
+			return nil, errors.New("privateKeyFile or publicKeyFile is required")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q, use HS256 or RS256", configured.Algorithm)
+	}
+	return key, nil
+}
+
+// readPEM first PEM block of file
+func readPEM(file string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM block", file)
+	}
+	return block, nil
+}
+
+// parseRSAPrivateKey PKCS #1 or PKCS #8 encoded RSA key
+func parseRSAPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// IssueTokens access and refresh token of principal and the claims of the refresh token, which the caller stores to allow exactly one exchange
+func (signer *TokenSigner) IssueTokens(principal *Principal) (*TokenPair, *TokenClaims, error) {
+	now := time.Now()
+	access, err := signer.Sign(signer.claims(principal, AccessToken, now, signer.accessTTL))
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshClaims := signer.claims(principal, RefreshToken, now, signer.refreshTTL)
+	refresh, err := signer.Sign(refreshClaims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &TokenPair{AccessToken: access, TokenType: "Bearer", ExpiresIn: int(signer.accessTTL.Seconds()), RefreshToken: refresh}, refreshClaims, nil
+}
+
+// claims claims of a token of principal valid for ttl from now
+func (signer *TokenSigner) claims(principal *Principal, use string, now time.Time, ttl time.Duration) *TokenClaims {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &TokenClaims{
+		Issuer:    signer.issuer,
+		Subject:   principal.ID,
+		Username:  principal.Username,
+		Roles:     principal.Roles,
+		Use:       use,
+		ID:        hex.EncodeToString(id),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// Sign compact JWS of claims signed with the signing key, its kid is sent in the header
+func (signer *TokenSigner) Sign(claims *TokenClaims) (string, error) {
+	header, err := json.Marshal(&tokenHeader{Algorithm: signer.signing.algorithm, Type: "JWT", KeyID: signer.signing.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signer.signing.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Verify claims of token, ErrInvalidToken unless it is signed by the key of its kid, unexpired, of the issuer and of use
+// the algorithm is taken from the key, never from the header, so an RS256 public key can not be used as HS256 secret
+func (signer *TokenSigner) Verify(token, use string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	header := &tokenHeader{}
+	if !decodeSegment(parts[0], header) {
+		return nil, ErrInvalidToken
+	}
+	key := signer.keys[header.KeyID]
+	if key == nil || header.Algorithm != key.algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &TokenClaims{}
+	if !decodeSegment(parts[1], claims) {
+		return nil, ErrInvalidToken
+	}
+	if claims.Use != use || claims.Issuer != signer.issuer || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Principal principal the claims were issued to
+func (claims *TokenClaims) Principal() *Principal {
+	roles := claims.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return &Principal{ID: claims.Subject, Username: claims.Username, Roles: roles}
+}
+
+// decodeSegment decode base64url json segment of a token into value
+func decodeSegment(segment string, value interface{}) bool {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	return err == nil && json.Unmarshal(data, value) == nil
+}
+
+// sign signature of input
+func (key *tokenKey) sign(input []byte) ([]byte, error) {
+	if key.algorithm == "HS256" {
+		mac := hmac.New(sha256.New, key.secret)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	}
+
+	digest := sha256.Sum256(input)
+	return rsa.SignPKCS1v15(rand.Reader, key.private, crypto.SHA256, digest[:])
+}
+
+// verify signature is the signature of input
+func (key *tokenKey) verify(input, signature []byte) bool {
+	if key.algorithm == "HS256" {
+		expected, _ := key.sign(input)
+		return hmac.Equal(expected, signature)
+	}
+
+	digest := sha256.Sum256(input)
+	return rsa.VerifyPKCS1v15(key.public, crypto.SHA256, digest[:], signature) == nil
+}
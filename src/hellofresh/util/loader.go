@@ -0,0 +1,62 @@
+package util
+
+import "sync"
+
+// Loader dataloader style batching of lookups by key
+// keys loaded before the first result is read are fetched together in a single call of fetch,
+// results are cached for the lifetime of the loader, which is meant to be one request
+type Loader struct {
+	fetch   func(keys []string) (map[string]interface{}, error)
+	mutex   sync.Mutex
+	pending []string
+	results map[string]interface{}
+	errors  map[string]error
+}
+
+// NewLoader create loader fetching batches with fetch, keys missing from its result load as nil
+func NewLoader(fetch func(keys []string) (map[string]interface{}, error)) *Loader {
+	return &Loader{fetch: fetch, results: map[string]interface{}{}, errors: map[string]error{}}
+}
+
+// Load queue key and return a thunk resolving it, the first thunk called dispatches every queued key
+func (loader *Loader) Load(key string) func() (interface{}, error) {
+	loader.mutex.Lock()
+	if _, loaded := loader.results[key]; !loaded && !loader.isPending(key) {
+		loader.pending = append(loader.pending, key)
+	}
+	loader.mutex.Unlock()
+
+	return func() (interface{}, error) {
+		loader.mutex.Lock()
+		defer loader.mutex.Unlock()
+
+		if loader.isPending(key) {
+			loader.dispatch()
+		}
+		return loader.results[key], loader.errors[key]
+	}
+}
+
+// isPending key is queued and not fetched yet
+func (loader *Loader) isPending(key string) bool {
+	for _, pending := range loader.pending {
+		if pending == key {
+			return true
+		}
+	}
+	return false
+}
+
+// dispatch fetch queued keys, a failed fetch fails every key of the batch
+func (loader *Loader) dispatch() {
+	keys := loader.pending
+	loader.pending = nil
+
+	results, err := loader.fetch(keys)
+	for _, key := range keys {
+		loader.results[key] = results[key]
+		if err != nil {
+			loader.errors[key] = err
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package util
+
+import (
+	"container/list"
+	"fmt"
+	"hellofresh/config"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxTrackedLogins number of usernames and of client IPs tracked at most, beyond it the least recently failed one
+// which is not blocked is forgotten
+const maxTrackedLogins = 10000
+
+// LockedOutError login refused after too many failed attempts of the username or client IP
+type LockedOutError struct {
+	RetryAfter time.Duration
+}
+
+// LoginGuard brute-force protection of password logins
+// failures are counted per username and per client IP, each failure beyond the free attempts doubles the delay
+// before the next login is accepted, reaching the threshold locks the username or IP out for the lockout duration
+type LoginGuard struct {
+	freeAttempts, threshold     int
+	ipFreeAttempts, ipThreshold int
+	baseDelay, maxDelay         time.Duration
+	lockout                     time.Duration
+	now                         func() time.Time
+
+	mu      sync.Mutex
+	users   *failureTable
+	clients *failureTable
+}
+
+// loginFailures failed logins of a username or client IP
+type loginFailures struct {
+	key          string
+	count        int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// failureTable failures by username or client IP, ordered by their last failure
+// the order makes forgetting expired failures and evicting the oldest beyond the size constant time per failure
+// blocked entries are never evicted, while every entry is blocked unknown keys are blocked until saturatedUntil
+type failureTable struct {
+	size           int
+	entries        map[string]*list.Element
+	order          *list.List
+	saturatedUntil time.Time
+}
+
+// loginGuard guard registered by the app, logins are not throttled without one
+var loginGuard *LoginGuard
+
+// SetLoginGuard throttle password logins with guard, nil disables throttling
+func SetLoginGuard(guard *LoginGuard) {
+	loginGuard = guard
+}
+
+// NewLoginGuard guard of the lockout config, durations are parsed with time.ParseDuration
+func NewLoginGuard(lockout config.LockoutConfig) (*LoginGuard, error) {
+	guard := &LoginGuard{
+		freeAttempts:   orDefault(lockout.FreeAttempts, 3),
+		threshold:      orDefault(lockout.Threshold, 10),
+		ipFreeAttempts: orDefault(lockout.IPFreeAttempts, 10),
+		ipThreshold:    orDefault(lockout.IPThreshold, 50),
+		now:            time.Now,
+		users:          newFailureTable(maxTrackedLogins),
+		clients:        newFailureTable(maxTrackedLogins),
+	}
+
+	durations := []struct {
+		name, value, fallback string
+		target                *time.Duration
+	}{
+		{"baseDelay", lockout.BaseDelay, "1s", &guard.baseDelay},
+		{"maxDelay", lockout.MaxDelay, "1m", &guard.maxDelay},
+		{"duration", lockout.Duration, "15m", &guard.lockout},
+	}
+	for _, duration := range durations {
+		value := duration.value
+		if value == "" {
+			value = duration.fallback
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("auth.lockout.%s: invalid duration %q", duration.name, duration.value)
+		}
+		*duration.target = parsed
+	}
+	return guard, nil
+}
+
+// Check LockedOutError if username or client may not try to log in yet
+func (guard *LoginGuard) Check(username, client string) error {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	now := guard.now()
+	wait := guard.users.blockedFor(username, now)
+	if clientWait := guard.clients.blockedFor(client, now); clientWait > wait {
+		wait = clientWait
+	}
+	if wait > 0 {
+		return &LockedOutError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// Fail record a failed login of username from client
+func (guard *LoginGuard) Fail(username, client string) {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	now := guard.now()
+	guard.fail(guard.users, username, guard.freeAttempts, guard.threshold, now)
+	guard.fail(guard.clients, client, guard.ipFreeAttempts, guard.ipThreshold, now)
+}
+
+// Succeed forget the failed logins of username
+// failures of the client IP are kept, so logging into a known account does not reset them
+func (guard *LoginGuard) Succeed(username string) {
+	guard.mu.Lock()
+	defer guard.mu.Unlock()
+
+	guard.users.remove(username)
+}
+
+// fail count failure of key and block it according to its number of failures
+func (guard *LoginGuard) fail(entries *failureTable, key string, free, threshold int, now time.Time) {
+	entries.forget(now.Add(-guard.lockout), now)
+
+	entry := entries.touch(key, now)
+	if entry == nil {
+		// every tracked entry is blocked, Check refuses key until one of them is released
+		return
+	}
+	entry.count++
+	entry.last = now
+
+	switch {
+	case entry.count >= threshold:
+		entry.blockedUntil = now.Add(guard.lockout)
+	case entry.count > free:
+		delay := guard.baseDelay << uint(entry.count-free-1)
+		if delay <= 0 || delay > guard.maxDelay {
+			delay = guard.maxDelay
+		}
+		entry.blockedUntil = now.Add(delay)
+	}
+}
+
+// newFailureTable table of at most size entries
+func newFailureTable(size int) *failureTable {
+	return &failureTable{size: size, entries: map[string]*list.Element{}, order: list.New()}
+}
+
+// get failures of key, nil if there are none
+func (table *failureTable) get(key string) *loginFailures {
+	if element := table.entries[key]; element != nil {
+		return element.Value.(*loginFailures)
+	}
+	return nil
+}
+
+// touch failures of key moved to the front, created if there are none
+// when the table is full the oldest entry not blocked at now is evicted, so spraying keys can not lift a lockout;
+// nil if every entry is blocked, unknown keys are then refused until the first block ends
+func (table *failureTable) touch(key string, now time.Time) *loginFailures {
+	if element := table.entries[key]; element != nil {
+		table.order.MoveToFront(element)
+		return element.Value.(*loginFailures)
+	}
+
+	if table.order.Len() >= table.size {
+		released := time.Time{}
+		for element := table.order.Back(); ; element = element.Prev() {
+			if element == nil {
+				table.saturatedUntil = released
+				return nil
+			}
+			entry := element.Value.(*loginFailures)
+			if !entry.blockedUntil.After(now) {
+				table.remove(entry.key)
+				break
+			}
+			if released.IsZero() || entry.blockedUntil.Before(released) {
+				released = entry.blockedUntil
+			}
+		}
+	}
+	entry := &loginFailures{key: key}
+	table.entries[key] = table.order.PushFront(entry)
+	return entry
+}
+
+// remove forget the failures of key
+func (table *failureTable) remove(key string) {
+	if element := table.entries[key]; element != nil {
+		table.order.Remove(element)
+		delete(table.entries, key)
+	}
+}
+
+// forget remove entries whose last failure is before expired and which are not blocked at now, oldest first
+func (table *failureTable) forget(expired, now time.Time) {
+	for element := table.order.Back(); element != nil; element = table.order.Back() {
+		entry := element.Value.(*loginFailures)
+		if !entry.last.Before(expired) || entry.blockedUntil.After(now) {
+			return
+		}
+		table.remove(entry.key)
+	}
+}
+
+// blockedFor time until key may try again, unknown keys are blocked while every tracked entry is
+func (table *failureTable) blockedFor(key string, now time.Time) time.Duration {
+	entry := table.get(key)
+	if entry == nil && table.saturatedUntil.After(now) {
+		return table.saturatedUntil.Sub(now)
+	}
+	return blockedFor(entry, now)
+}
+
+// blockedFor time until entry may try again, 0 if it is not blocked
+func blockedFor(entry *loginFailures, now time.Time) time.Duration {
+	if entry == nil || !entry.blockedUntil.After(now) {
+		return 0
+	}
+	return entry.blockedUntil.Sub(now)
+}
+
+// orDefault value, or fallback if it is not set
+func orDefault(value, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// Error error message
+func (err *LockedOutError) Error() string {
+	return "Too many failed login attempts, retry later"
+}
+
+// Problem 429 problem details
+func (err *LockedOutError) Problem() *Problem {
+	return NewProblem(http.StatusTooManyRequests, "too_many_attempts", err.Error())
+}
+
+// retryAfterSeconds Retry-After header value of the lockout, rounded up to whole seconds
+func (err *LockedOutError) retryAfterSeconds() string {
+	return fmt.Sprintf("%d", int(math.Ceil(err.RetryAfter.Seconds())))
+}
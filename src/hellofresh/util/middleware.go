@@ -1,6 +1,12 @@
 package util
 
-import "net/http"
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
 
 // Use provides a cleaner interface for chaining middleware for single routes.
 // Middleware functions are simple HTTP handlers (w http.ResponseWriter, r *http.Request)
@@ -10,3 +16,36 @@ func Use(h http.HandlerFunc, middleware ...func(http.HandlerFunc) http.HandlerFu
 	}
 	return h
 }
+
+// Recover middleware turning a panic of the handler into a 500 response
+// the panic and its stack are logged, the client only gets a generic problem
+func Recover(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, recovered, debug.Stack())
+				ResponseWithError(w, r, http.StatusInternalServerError, "Unexpected error")
+			}
+		}()
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+// Deprecated middleware flagging every response of a deprecated API version
+// Sunset is only sent when sunset is set, successor is linked as successor-version
+func Deprecated(sunset time.Time, successor string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			if !sunset.IsZero() {
+				w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+			if successor != "" {
+				w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+			}
+
+			h.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// renderMsgpack encode payload as MessagePack using its JSON representation
+func renderMsgpack(payload interface{}) ([]byte, error) {
+	value, err := genericValue(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := writeMsgpack(&buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeMsgpack encode value produced by genericValue, see https://github.com/msgpack/msgpack/blob/master/spec.md
+func writeMsgpack(buffer *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+
+	case bool:
+		if value {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			writeMsgpackInt(buffer, integer)
+			return nil
+		}
+
+		float, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(float))
+
+	case string:
+		writeMsgpackHeader(buffer, len(value), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		buffer.WriteString(value)
+
+	case []interface{}:
+		writeMsgpackHeader(buffer, len(value), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range value {
+			if err := writeMsgpack(buffer, item); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeMsgpackHeader(buffer, len(value), 0x80, 15, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			writeMsgpack(buffer, key)
+			if err := writeMsgpack(buffer, value[key]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("Unsupported MessagePack type %T", value)
+	}
+	return nil
+}
+
+// writeMsgpackInt encode integer in its smallest representation
+func writeMsgpackInt(buffer *bytes.Buffer, value int64) {
+	switch {
+	case value >= 0 && value <= 127:
+		buffer.WriteByte(byte(value))
+	case value < 0 && value >= -32:
+		buffer.WriteByte(byte(int8(value)))
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(int8(value)))
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		buffer.WriteByte(0xd1)
+		binary.Write(buffer, binary.BigEndian, int16(value))
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		buffer.WriteByte(0xd2)
+		binary.Write(buffer, binary.BigEndian, int32(value))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, value)
+	}
+}
+
+// writeMsgpackHeader write header of string, array or map of length
+// fixed is the fix format prefix used up to fixedMax, code8 is 0 when the type has no 8 bit length format
+func writeMsgpackHeader(buffer *bytes.Buffer, length int, fixed byte, fixedMax int, code8, code16, code32 byte) {
+	switch {
+	case length <= fixedMax:
+		buffer.WriteByte(fixed | byte(length))
+	case code8 != 0 && length <= math.MaxUint8:
+		buffer.WriteByte(code8)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(code16)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(code32)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"net/http"
+)
+
+// permissions checked by RequirePermission, granted through the roles of the principal
+const (
+	// PermissionExport export recipes
+	PermissionExport = "recipes:export"
+	// PermissionRate rate recipes
+	PermissionRate = "recipes:rate"
+	// PermissionWrite create, update, patch, import and batch recipes, updates are limited to own recipes
+	PermissionWrite = "recipes:write"
+	// PermissionWriteAny update recipes of every user
+	PermissionWriteAny = "recipes:write:any"
+	// PermissionDelete delete recipes
+	PermissionDelete = "recipes:delete"
+	// PermissionManageUsers create accounts with roles
+	PermissionManageUsers = "users:manage"
+	// PermissionManageAPIKeys create, list and revoke API keys
+	PermissionManageAPIKeys = "apikeys:manage"
+	// PermissionReadAudit read the audit log of recipe changes
+	PermissionReadAudit = "audit:read"
+)
+
+// rolePermissions permissions of each role
+var rolePermissions = map[string][]string{
+	RoleViewer: {PermissionExport},
+	RoleRater:  {PermissionExport, PermissionRate},
+	RoleEditor: {PermissionExport, PermissionRate, PermissionWrite},
+	RoleAdmin:  {PermissionExport, PermissionRate, PermissionWrite, PermissionWriteAny, PermissionDelete, PermissionManageUsers, PermissionManageAPIKeys, PermissionReadAudit},
+}
+
+// Can one of the roles or scopes of principal grants permission, false for a nil principal
+func (principal *Principal) Can(permission string) bool {
+	if principal == nil {
+		return false
+	}
+	for _, role := range principal.Roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	for _, scope := range principal.Scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission middleware rejecting principals without permission, must run after RequireAuth
+func RequirePermission(permission string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !PrincipalFrom(r.Context()).Can(permission) {
+				ResponseWithError(w, r, http.StatusForbidden, "Permission "+permission+" required")
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		}
+	}
+}
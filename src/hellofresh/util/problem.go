@@ -0,0 +1,88 @@
+package util
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Problem RFC 7807 problem details
+type Problem struct {
+	// Type problem type URI, about:blank when the status code describes the problem
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Instance request path the problem occurred on
+	Instance string `json:"instance,omitempty"`
+	// Code stable machine readable error code
+	Code string `json:"code"`
+	// Errors problem specific details such as field errors
+	Errors interface{} `json:"errors,omitempty"`
+}
+
+// ProblemError error which describes itself as problem details, implemented by the domain errors of model
+type ProblemError interface {
+	error
+	Problem() *Problem
+}
+
+// problemMediaTypes problem media type of each renderer media type
+var problemMediaTypes = map[string]string{
+	"application/json": "application/problem+json",
+	"application/xml":  "application/problem+xml",
+	"text/xml":         "application/problem+xml",
+}
+
+// NewProblem problem of status, code defaults to the snake cased status text, e.g. not_found
+func NewProblem(status int, code, detail string) *Problem {
+	if code == "" {
+		code = StatusCode(status)
+	}
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail, Code: code}
+}
+
+// StatusCode machine readable code of HTTP status
+func StatusCode(status int) string {
+	return strings.Replace(strings.ToLower(http.StatusText(status)), " ", "_", -1)
+}
+
+// ResponseWithError response with problem details of status
+func ResponseWithError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	ResponseWithProblem(w, r, NewProblem(code, "", message))
+}
+
+// ResponseWithDomainError response with problem details of err
+// errors which do not implement ProblemError are logged and reported as 500 without leaking their message
+func ResponseWithDomainError(w http.ResponseWriter, r *http.Request, err error) {
+	if locked, ok := err.(*LockedOutError); ok {
+		w.Header().Set("Retry-After", locked.retryAfterSeconds())
+	}
+	if problemError, ok := err.(ProblemError); ok {
+		ResponseWithProblem(w, r, problemError.Problem())
+		return
+	}
+
+	log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	ResponseWithError(w, r, http.StatusInternalServerError, "Unexpected error")
+}
+
+// ResponseWithProblem response with problem rendered in the accepted media type, application/problem+json if none is supported
+func ResponseWithProblem(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	if problem.Instance == "" {
+		problem.Instance = r.URL.Path
+	}
+
+	w.Header().Add("Vary", "Accept")
+	mediaType, body, err := negotiate(r, problem)
+	if err != nil {
+		mediaType = "application/json"
+		body, _ = json.Marshal(problem)
+	}
+
+	if problemMediaType, ok := problemMediaTypes[mediaType]; ok {
+		mediaType = problemMediaType
+	}
+	ResponseWithBody(w, problem.Status, mediaType, body)
+}
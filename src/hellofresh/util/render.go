@@ -0,0 +1,331 @@
+package util
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrNotRenderable payload can not be encoded in the media type
+var ErrNotRenderable = errors.New("Payload can not be rendered in this media type")
+
+// CSVMarshaler payload which can be rendered as CSV, the first record is the header
+type CSVMarshaler interface {
+	MarshalCSV() ([][]string, error)
+}
+
+// renderer encode payload in a media type
+type renderer struct {
+	mediaType string
+	render    func(payload interface{}) ([]byte, error)
+}
+
+// renderers supported media types, in order of preference when the client accepts any
+var renderers = []renderer{
+	{"application/json", json.Marshal},
+	{"application/xml", renderXML},
+	{"text/xml", renderXML},
+	{"text/csv", renderCSV},
+	{"application/msgpack", renderMsgpack},
+	{"application/x-msgpack", renderMsgpack},
+}
+
+// acceptedRange media range of Accept header with its quality and position in the header
+type acceptedRange struct {
+	mediaType string
+	quality   float64
+	position  int
+}
+
+// specificity 2 for a media type, 1 for type/* and 0 for */*, the most specific range including a media type sets its quality
+func (accepted acceptedRange) specificity() int {
+	switch {
+	case accepted.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(accepted.mediaType, "/*"):
+		return 1
+	}
+	return 2
+}
+
+// candidate renderer with the range of the Accept header that includes it
+type candidate struct {
+	renderer
+	accepted acceptedRange
+}
+
+// byAcceptance sort candidates by descending quality then by position of their range in the Accept header
+type byAcceptance []candidate
+
+func (candidates byAcceptance) Len() int { return len(candidates) }
+func (candidates byAcceptance) Swap(i, j int) {
+	candidates[i], candidates[j] = candidates[j], candidates[i]
+}
+func (candidates byAcceptance) Less(i, j int) bool {
+	if candidates[i].accepted.quality != candidates[j].accepted.quality {
+		return candidates[i].accepted.quality > candidates[j].accepted.quality
+	}
+	return candidates[i].accepted.position < candidates[j].accepted.position
+}
+
+// NotAcceptableError none of the media types of the Accept header can render the response
+type NotAcceptableError struct {
+	Accept string
+}
+
+// Error error message
+func (err *NotAcceptableError) Error() string {
+	return fmt.Sprintf("None of the accepted media types %q is supported", err.Accept)
+}
+
+// Problem 406 problem details
+func (err *NotAcceptableError) Problem() *Problem {
+	return NewProblem(http.StatusNotAcceptable, "", err.Error())
+}
+
+// Render response with payload encoded in the best media type of the Accept header
+// responds 406 Not Acceptable when no accepted media type can render the payload, 500 when encoding fails
+func Render(w http.ResponseWriter, r *http.Request, code int, payload interface{}) {
+	renderTagged(w, r, code, payload, nil)
+}
+
+// RenderVersion Render a versioned resource with the strong ETag of version in the negotiated media type
+// If-None-Match is evaluated against that tag on GET, a match writes 304 Not Modified
+func RenderVersion(w http.ResponseWriter, r *http.Request, code int, payload interface{}, version int) {
+	renderTagged(w, r, code, payload, func(mediaType string, body []byte) string {
+		return RepresentationETag(version, mediaType)
+	})
+}
+
+// RenderContent Render payload with a weak ETag of the negotiated representation, used for collections
+// If-None-Match is evaluated against that tag on GET, a match writes 304 Not Modified
+func RenderContent(w http.ResponseWriter, r *http.Request, code int, payload interface{}) {
+	renderTagged(w, r, code, payload, func(mediaType string, body []byte) string {
+		return WeakETag(body)
+	})
+}
+
+// renderTagged negotiate and encode payload, then set the ETag computed by etag of the representation when etag is not nil
+func renderTagged(w http.ResponseWriter, r *http.Request, code int, payload interface{}, etag func(mediaType string, body []byte) string) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, body, err := negotiate(r, payload)
+	if err != nil {
+		ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	if etag != nil {
+		tag := etag(mediaType, body)
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("ETag", tag)
+		} else if SetETag(w, r, tag) {
+			return
+		}
+	}
+	ResponseWithBody(w, code, mediaType, body)
+}
+
+// Acceptable the Accept header of r accepts one of mediaTypes, checked before unsafe requests change state
+func Acceptable(r *http.Request, mediaTypes ...string) bool {
+	ranges := acceptedRanges(r.Header.Get("Accept"))
+	for _, mediaType := range mediaTypes {
+		if accepted, ok := acceptance(ranges, mediaType); ok && accepted.quality > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate encode payload with the acceptable renderer of highest quality
+// renderers of the same range are tried in order of preference, a range with q=0 excludes the media types it names
+func negotiate(r *http.Request, payload interface{}) (string, []byte, error) {
+	ranges := acceptedRanges(r.Header.Get("Accept"))
+	candidates := []candidate{}
+	for _, renderer := range renderers {
+		if accepted, ok := acceptance(ranges, renderer.mediaType); ok && accepted.quality > 0 {
+			candidates = append(candidates, candidate{renderer, accepted})
+		}
+	}
+	sort.Stable(byAcceptance(candidates))
+
+	for _, candidate := range candidates {
+		body, err := candidate.render(payload)
+		if err == ErrNotRenderable {
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		return candidate.mediaType, body, nil
+	}
+	return "", nil, &NotAcceptableError{Accept: r.Header.Get("Accept")}
+}
+
+// acceptedRanges media ranges of Accept header including those refused with q=0, */* if header is missing
+func acceptedRanges(accept string) []acceptedRange {
+	if strings.TrimSpace(accept) == "" {
+		return []acceptedRange{{"*/*", 1, 0}}
+	}
+
+	ranges := []acceptedRange{}
+	for position, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptedRange{mediaType, quality, position})
+	}
+	return ranges
+}
+
+// acceptance most specific range including mediaType, false if none does
+func acceptance(ranges []acceptedRange, mediaType string) (acceptedRange, bool) {
+	best, found := acceptedRange{}, false
+	for _, accepted := range ranges {
+		if matchMediaRange(accepted.mediaType, mediaType) && (!found || accepted.specificity() > best.specificity()) {
+			best, found = accepted, true
+		}
+	}
+	return best, found
+}
+
+// matchMediaRange media range such as text/* or */* includes media type
+func matchMediaRange(mediaRange, mediaType string) bool {
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+}
+
+// genericValue decode payload into maps, slices and scalars using its JSON representation
+// so every encoder shares the json field names and custom marshalers such as bson.ObjectId
+func genericValue(payload interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	return value, err
+}
+
+// renderCSV encode payload implementing CSVMarshaler
+func renderCSV(payload interface{}) ([]byte, error) {
+	marshaler, ok := payload.(CSVMarshaler)
+	if !ok {
+		return nil, ErrNotRenderable
+	}
+
+	records, err := marshaler.MarshalCSV()
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// renderXML encode payload as XML, objects become elements named by their keys and array items are <item>
+func renderXML(payload interface{}) ([]byte, error) {
+	value, err := genericValue(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buffer)
+	if err := writeXML(encoder, "response", value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeXML write value as element
+func writeXML(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := writeXML(encoder, key, value[key]); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+
+	case []interface{}:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, item := range value {
+			if err := writeXML(encoder, "item", item); err != nil {
+				return err
+			}
+		}
+		return encoder.EncodeToken(start.End())
+
+	case nil:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		return encoder.EncodeToken(start.End())
+
+	default:
+		return encoder.EncodeElement(fmt.Sprint(value), start)
+	}
+}
+
+// xmlName replace characters which are not allowed in XML element names
+func xmlName(name string) string {
+	sanitized := []rune{}
+	for i, r := range name {
+		if unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.')) {
+			sanitized = append(sanitized, r)
+			continue
+		}
+		if i == 0 && unicode.IsDigit(r) {
+			sanitized = append(sanitized, '_', r)
+			continue
+		}
+		sanitized = append(sanitized, '_')
+	}
+	if len(sanitized) == 0 {
+		return "_"
+	}
+	return string(sanitized)
+}
@@ -4,18 +4,50 @@ package util
 import (
 	"encoding/json"
 	"net/http"
+	"sort"
 )
 
-// ResponseWithError response with error
-func ResponseWithError(w http.ResponseWriter, code int, message string) {
-	ResponseWithJSON(w, code, map[string]string{"error": message})
-}
-
 // ResponseWithJSON response with json
 func ResponseWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	response, _ := json.Marshal(payload)
+	ResponseWithBody(w, code, "application/json", response)
+}
 
-	w.Header().Set("Content-Type", "application/json")
+// ResponseWithBody response with encoded body of content type
+func ResponseWithBody(w http.ResponseWriter, code int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(code)
-	w.Write(response)
+	w.Write(body)
+}
+
+// Accepts Accept header explicitly lists media type with a quality above 0
+func Accepts(r *http.Request, mediaType string) bool {
+	accepted, ok := acceptance(acceptedRanges(r.Header.Get("Accept")), mediaType)
+	return ok && accepted.mediaType == mediaType && accepted.quality > 0
+}
+
+// Preferred media type of mediaTypes which the Accept header ranks above every media type Render supports, "" if none is
+// mediaTypes are only chosen when explicitly listed, ties are broken by position in the header as by Render
+func Preferred(r *http.Request, mediaTypes ...string) string {
+	ranges := acceptedRanges(r.Header.Get("Accept"))
+	candidates := []candidate{}
+	for _, mediaType := range mediaTypes {
+		if accepted, ok := acceptance(ranges, mediaType); ok && accepted.mediaType == mediaType && accepted.quality > 0 {
+			candidates = append(candidates, candidate{renderer{mediaType: mediaType}, accepted})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	for _, renderer := range renderers {
+		if accepted, ok := acceptance(ranges, renderer.mediaType); ok && accepted.quality > 0 {
+			candidates = append(candidates, candidate{renderer, accepted})
+		}
+	}
+	sort.Stable(byAcceptance(candidates))
+	if candidates[0].render != nil {
+		return ""
+	}
+	return candidates[0].mediaType
 }
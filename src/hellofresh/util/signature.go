@@ -0,0 +1,241 @@
+package util
+
+import (
+	"bytes"
+	"container/heap"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hellofresh/config"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureScheme authorization scheme of HMAC signed requests
+// Authorization: HMAC-SHA256 keyId="partner",timestamp="1700000000",nonce="...",signature="base64"
+const SignatureScheme = "HMAC-SHA256"
+
+// maxTrackedNonces number of unexpired nonces remembered at most, signed requests beyond it are refused until one expires
+const maxTrackedNonces = 100000
+
+// defaultMaxSkew accepted clock difference of signed requests, used when the signing config leaves it empty
+const defaultMaxSkew = 5 * time.Minute
+
+// defaultMaxSignedBodySize largest body of signed requests, used when the signing config leaves it empty
+const defaultMaxSignedBodySize = 1024 * 1024
+
+// SignatureVerifier verifier of the HMAC-SHA256 signed requests of partners
+// the signature covers method, path and query, timestamp, nonce and the SHA-256 hash of the body, see StringToSign
+// requests are replays when their timestamp is off by more than the max skew or their nonce was seen before
+type SignatureVerifier struct {
+	partners    map[string]config.SigningPartner
+	maxSkew     time.Duration
+	maxBodySize int64
+	now         func() time.Time
+
+	mu sync.Mutex
+	// nonces seen, keyed by keyId and nonce, kept until their timestamp leaves the window
+	nonces map[string]bool
+	// expiries nonces by expiry, so pruning only visits the expired ones
+	expiries nonceExpiries
+}
+
+// nonceExpiry time a nonce leaves the window of accepted timestamps
+type nonceExpiry struct {
+	nonce   string
+	expires time.Time
+}
+
+// nonceExpiries min-heap of nonces by expiry, timestamps of requests do not arrive in order
+type nonceExpiries []nonceExpiry
+
+func (expiries nonceExpiries) Len() int { return len(expiries) }
+func (expiries nonceExpiries) Less(i, j int) bool {
+	return expiries[i].expires.Before(expiries[j].expires)
+}
+func (expiries nonceExpiries) Swap(i, j int) { expiries[i], expiries[j] = expiries[j], expiries[i] }
+func (expiries *nonceExpiries) Push(x interface{}) {
+	*expiries = append(*expiries, x.(nonceExpiry))
+}
+func (expiries *nonceExpiries) Pop() interface{} {
+	old := *expiries
+	expiry := old[len(old)-1]
+	*expiries = old[:len(old)-1]
+	return expiry
+}
+
+// errReplayedNonce nonce of a signed request has been used within the window
+var errReplayedNonce = errors.New("replayed nonce")
+
+// signatureVerifier verifier registered by the app, signed requests are rejected without one
+var signatureVerifier *SignatureVerifier
+
+// SetSignatureVerifier accept requests signed for verifier, nil rejects signed requests
+func SetSignatureVerifier(verifier *SignatureVerifier) {
+	signatureVerifier = verifier
+}
+
+// NewSignatureVerifier verifier of the partners of the signing config, nil if there are none
+func NewSignatureVerifier(signing config.SigningConfig) (*SignatureVerifier, error) {
+	if len(signing.Partners) == 0 {
+		return nil, nil
+	}
+
+	verifier := &SignatureVerifier{partners: map[string]config.SigningPartner{}, maxSkew: defaultMaxSkew, maxBodySize: defaultMaxSignedBodySize, now: time.Now, nonces: map[string]bool{}}
+	if signing.MaxBodySize < 0 {
+		return nil, fmt.Errorf("signing.maxBodySize: must not be negative, got %d", signing.MaxBodySize)
+	}
+	if signing.MaxBodySize > 0 {
+		verifier.maxBodySize = signing.MaxBodySize
+	}
+	if signing.MaxSkew != "" {
+		var err error
+		if verifier.maxSkew, err = time.ParseDuration(signing.MaxSkew); err != nil {
+			return nil, fmt.Errorf("signing.maxSkew: %v", err)
+		}
+	}
+
+	for _, partner := range signing.Partners {
+		if partner.ID == "" {
+			return nil, errors.New("signing partner without id")
+		}
+		if len(partner.Secret) < minSecretLength {
+			return nil, fmt.Errorf("signing partner %q: secret must have at least %d bytes", partner.ID, minSecretLength)
+		}
+		if config.IsPlaceholder(partner.Secret) {
+			return nil, fmt.Errorf("signing partner %q: secret is the placeholder of config.json, set a random secret", partner.ID)
+		}
+		verifier.partners[partner.ID] = partner
+	}
+	return verifier, nil
+}
+
+// StringToSign canonical form of a request signed by the partners, lines of
+// method, path with query, unix timestamp, nonce and hex SHA-256 of the body
+func StringToSign(method, requestURI, timestamp, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, timestamp, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// Sign base64 HMAC-SHA256 of stringToSign with secret
+func Sign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest set the authorization header of r signed with the secret of keyID at now, the body is read and restored
+func SignRequest(r *http.Request, keyID, secret, nonce string, now time.Time) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := Sign(secret, StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	r.Header.Set("Authorization", fmt.Sprintf(`%s keyId="%s",timestamp="%s",nonce="%s",signature="%s"`, SignatureScheme, keyID, timestamp, nonce, signature))
+	return nil
+}
+
+// Verify principal of the partner who signed r, nil if the signature is wrong, stale or replayed
+// the body is read and restored for the handler, bodies beyond the max body size fail with BodyTooLargeError
+func (verifier *SignatureVerifier) Verify(r *http.Request, parameters string) (*Principal, error) {
+	fields := signatureFields(parameters)
+	keyID, timestamp, nonce := fields["keyId"], fields["timestamp"], fields["nonce"]
+	partner, ok := verifier.partners[keyID]
+	if !ok || nonce == "" {
+		auditAuthFailure(keyID, ClientIP(r), "unknown signing key or missing nonce")
+		return nil, nil
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	now := verifier.now()
+	signed := time.Unix(unix, 0)
+	if err != nil || signed.Before(now.Add(-verifier.maxSkew)) || signed.After(now.Add(verifier.maxSkew)) {
+		auditAuthFailure(keyID, ClientIP(r), "signature timestamp outside the accepted window")
+		return nil, nil
+	}
+
+	body, err := ReadBody(r, verifier.maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	expected := Sign(partner.Secret, StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(fields["signature"])) {
+		auditAuthFailure(keyID, ClientIP(r), "wrong signature")
+		return nil, nil
+	}
+
+	// only correctly signed requests use up a nonce, so forged requests cannot block legitimate ones
+	if err := verifier.useNonce(keyID+" "+nonce, signed.Add(verifier.maxSkew), now); err == errReplayedNonce {
+		auditAuthFailure(keyID, ClientIP(r), "replayed nonce")
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &Principal{ID: "partner:" + partner.ID, Username: partner.ID, Roles: []string{}, Scopes: partner.Scopes}, nil
+}
+
+// useNonce remember nonce until expires, errReplayedNonce if it was seen before
+// LockedOutError until the first nonce expires when maxTrackedNonces are remembered, as forgetting one would allow its replay
+func (verifier *SignatureVerifier) useNonce(nonce string, expires, now time.Time) error {
+	verifier.mu.Lock()
+	defer verifier.mu.Unlock()
+
+	for len(verifier.expiries) > 0 && !now.Before(verifier.expiries[0].expires) {
+		expired := heap.Pop(&verifier.expiries).(nonceExpiry)
+		delete(verifier.nonces, expired.nonce)
+	}
+	if verifier.nonces[nonce] {
+		return errReplayedNonce
+	}
+	if len(verifier.nonces) >= maxTrackedNonces {
+		return &LockedOutError{RetryAfter: verifier.expiries[0].expires.Sub(now)}
+	}
+
+	verifier.nonces[nonce] = true
+	heap.Push(&verifier.expiries, nonceExpiry{nonce: nonce, expires: expires})
+	return nil
+}
+
+// AuthenticateSignature principal of the partner who signed r with the parameters of its authorization header
+// nil if there is no verifier or the signature does not verify
+func AuthenticateSignature(r *http.Request, parameters string) (*Principal, error) {
+	if signatureVerifier == nil {
+		return nil, nil
+	}
+	return signatureVerifier.Verify(r, parameters)
+}
+
+// signatureFields key="value" pairs of the parameters of a signature authorization header
+func signatureFields(parameters string) map[string]string {
+	fields := map[string]string{}
+	for _, pair := range strings.Split(parameters, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return fields
+}
+
+// readBody read the body of r and replace it with a reader of the same bytes
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hellofresh/model"
+	"hellofresh/util"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// v2 pagination defaults
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// recipePageV2 page of GET /v2/recipes, next is omitted on the last page
+type recipePageV2 struct {
+	Items  []*recipeV2Resource `json:"items"`
+	Offset int                 `json:"offset"`
+	Limit  int                 `json:"limit"`
+	Next   string              `json:"next,omitempty"`
+	Links  links               `json:"_links"`
+}
+
+// recipeListV2 result of GET /v2/recipes/search
+type recipeListV2 struct {
+	Items []*recipeV2Resource `json:"items"`
+	Links links               `json:"_links"`
+}
+
+// rateRequestV2 payload of POST /v2/recipes/{id}/ratings
+type rateRequestV2 struct {
+	Rate int `json:"rate"`
+}
+
+// initializeV2Routes init v2 routes on router
+// bulk endpoints are shared with v1 and keep the v1 recipe shape
+func (app *App) initializeV2Routes(router *mux.Router) {
+	// list recipes
+	// GET /v2/recipes?offset=0&limit=10 | non-protected
+	router.HandleFunc("/recipes", util.Use(app.listRecipesV2, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// create recipe
+	// POST /v2/recipes | auth, editor, Idempotency-Key
+	router.HandleFunc("/recipes", util.Use(app.createRecipeV2, app.Idempotent, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, util.Recover)).Methods("POST")
+
+	// batch create, update and delete recipes
+	// POST /v2/recipes:batch | auth, editor, Idempotency-Key
+	router.HandleFunc("/recipes:batch", util.Use(app.batchRecipes, app.Idempotent, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, util.Recover)).Methods("POST")
+
+	// export recipes as NDJSON
+	// GET /v2/recipes/export?ratings=true | auth, viewer
+	router.HandleFunc("/recipes/export", util.Use(app.exportRecipes, app.ValidateRequest, util.RequirePermission(util.PermissionExport), util.RequireAuth, util.Recover)).Methods("GET")
+
+	// import recipes from NDJSON
+	// POST /v2/recipes/import | auth, editor
+	router.HandleFunc("/recipes/import", util.Use(app.importRecipes, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, util.Recover)).Methods("POST")
+
+	// import schema.org Recipe JSON-LD documents
+	// POST /v2/recipes/import/jsonld | auth, editor
+	router.HandleFunc("/recipes/import/jsonld", util.Use(app.importSchemaRecipes, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, util.Recover)).Methods("POST")
+
+	// search recipes by name, must be registered before /recipes/{id}
+	// GET /v2/recipes/search?q=pattern | non-protected
+	router.HandleFunc("/recipes/search", util.Use(app.searchRecipesV2, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// get single recipe
+	// GET /v2/recipes/{id} | non-protected
+	router.HandleFunc("/recipes/{id}", util.Use(app.getRecipeV2, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// replace recipe
+	// PUT /v2/recipes/{id} | auth, editor
+	router.HandleFunc("/recipes/{id}", util.Use(app.updateRecipeV2, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, util.Recover)).Methods("PUT")
+
+	// patch recipe
+	// PATCH /v2/recipes/{id} | auth, editor
+	router.HandleFunc("/recipes/{id}", util.Use(app.patchRecipeV2, app.ValidateRequest, util.RequirePermission(util.PermissionWrite), util.RequireAuth, util.Recover)).Methods("PATCH")
+
+	// delete recipe
+	// DELETE /v2/recipes/{id} | auth, admin
+	router.HandleFunc("/recipes/{id}", util.Use(app.deleteRecipeV2, app.ValidateRequest, util.RequirePermission(util.PermissionDelete), util.RequireAuth, util.Recover)).Methods("DELETE")
+
+	// rating summary of recipe
+	// GET /v2/recipes/{id}/ratings | non-protected
+	router.HandleFunc("/recipes/{id}/ratings", util.Use(app.getRatingsV2, app.ValidateRequest, util.Recover)).Methods("GET")
+
+	// rate recipe
+	// POST /v2/recipes/{id}/ratings | auth, rater or anonymous if enabled, Idempotency-Key
+	router.HandleFunc("/recipes/{id}/ratings", util.Use(app.rateRecipeV2, app.Idempotent, app.ValidateRequest, app.RequireRater, util.Recover)).Methods("POST")
+}
+
+// listRecipesV2 GET /v2/recipes
+func (app *App) listRecipesV2(w http.ResponseWriter, r *http.Request) {
+	offset, limit, ok := pagination(w, r)
+	if !ok {
+		return
+	}
+
+	recipe := &model.Recipe{}
+	recipes, err := recipe.GetRecipes(app.DB, offset, limit)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	page := &recipePageV2{Items: app.recipeV2Resources(recipes), Offset: offset, Limit: limit, Links: links{}}
+	page.Links.add("self", app.pageLink("listRecipesV2", pageQuery(offset, limit)))
+	page.Links.add("search", app.templatedLink("searchRecipesV2", "q"))
+	if len(recipes) == limit {
+		next := app.pageLink("listRecipesV2", pageQuery(offset+limit, limit))
+		page.Links.add("next", next)
+		if next != nil {
+			page.Next = next.Href
+		}
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Links.add("prev", app.pageLink("listRecipesV2", pageQuery(prev, limit)))
+	}
+	app.responseWithContent(w, r, page)
+}
+
+// createRecipeV2 POST /v2/recipes
+func (app *App) createRecipeV2(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := decodeRecipeV2(w, r, &model.RecipeV2{})
+	if !ok {
+		return
+	}
+
+	recipe.ID = nil
+	authoredBy(r.Context(), recipe)
+	if err := recipe.CreateRecipe(r.Context(), app.DB); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	resource := app.recipeV2Resource(recipe)
+	if self := resource.Links["self"]; self != nil {
+		w.Header().Set("Location", self.Href)
+	}
+	util.RenderVersion(w, r, http.StatusCreated, resource, recipe.Version)
+}
+
+// searchRecipesV2 GET /v2/recipes/search?q=pattern
+func (app *App) searchRecipesV2(w http.ResponseWriter, r *http.Request) {
+	search := r.URL.Query().Get("q")
+	if search == "" {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "No search pattern")
+		return
+	}
+
+	recipe := &model.Recipe{}
+	recipes, err := recipe.SearchRecipes(app.DB, search)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	list := &recipeListV2{Items: app.recipeV2Resources(recipes), Links: links{}}
+	list.Links.add("self", &link{Href: r.URL.RequestURI()})
+	app.responseWithContent(w, r, list)
+}
+
+// getRecipeV2 GET /v2/recipes/{id}
+func (app *App) getRecipeV2(w http.ResponseWriter, r *http.Request) {
+	id := (model.ID)(mux.Vars(r)["id"])
+	recipe, err := id.GetRecipe(app.DB)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.RenderVersion(w, r, http.StatusOK, app.recipeV2Resource(recipe), recipe.Version)
+}
+
+// updateRecipeV2 PUT /v2/recipes/{id}
+func (app *App) updateRecipeV2(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	id := (model.ID)(mux.Vars(r)["id"])
+	if _, err := id.Parse(); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+	if err := app.checkOwnerOf(r.Context(), id); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	recipe, ok := decodeRecipeV2(w, r, &model.RecipeV2{})
+	if !ok {
+		return
+	}
+
+	recipe.ID = string(id)
+	recipe.Version = version
+	app.saveRecipeV2(w, r, recipe)
+}
+
+// patchRecipeV2 PATCH /v2/recipes/{id}
+func (app *App) patchRecipeV2(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	id := (model.ID)(mux.Vars(r)["id"])
+	current, err := id.GetRecipe(app.DB)
+	if err == nil {
+		err = checkOwner(r.Context(), current)
+	}
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	// fields missing from payload keep their stored value
+	recipe, ok := decodeRecipeV2(w, r, model.NewRecipeV2(current))
+	if !ok {
+		return
+	}
+
+	if version > 0 && version != current.Version {
+		util.ResponseWithDomainError(w, r, model.ErrVersionConflict)
+		return
+	}
+	// patch is applied on the version just read, so a concurrent update is still detected
+	recipe.ID = string(id)
+	recipe.Version = current.Version
+	app.saveRecipeV2(w, r, recipe)
+}
+
+// saveRecipeV2 update recipe and respond with its v2 representation
+func (app *App) saveRecipeV2(w http.ResponseWriter, r *http.Request, recipe *model.Recipe) {
+	authoredBy(r.Context(), recipe)
+	if err := recipe.UpdateRecipe(r.Context(), app.DB); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	util.RenderVersion(w, r, http.StatusOK, app.recipeV2Resource(recipe), recipe.Version)
+}
+
+// deleteRecipeV2 DELETE /v2/recipes/{id}
+func (app *App) deleteRecipeV2(w http.ResponseWriter, r *http.Request) {
+	version, ok := app.expectedVersion(w, r)
+	if !ok {
+		return
+	}
+
+	id := (model.ID)(mux.Vars(r)["id"])
+	if err := id.DeleteRecipe(r.Context(), app.DB, version); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getRatingsV2 GET /v2/recipes/{id}/ratings
+func (app *App) getRatingsV2(w http.ResponseWriter, r *http.Request) {
+	id := (model.ID)(mux.Vars(r)["id"])
+	if _, err := id.GetRecipe(app.DB); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	rates, err := id.GetRatings(app.DB)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	app.responseWithContent(w, r, model.NewRatingSummary(rates))
+}
+
+// rateRecipeV2 POST /v2/recipes/{id}/ratings
+func (app *App) rateRecipeV2(w http.ResponseWriter, r *http.Request) {
+	var rate rateRequestV2
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rate); err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if rate.Rate < 1 || rate.Rate > 5 {
+		util.ResponseWithDomainError(w, r, &model.ValidationError{Message: "Invalid rate", Fields: []*model.FieldError{
+			{Field: "rate", Code: "out_of_range", Message: "Rate must be between 1 and 5"},
+		}})
+		return
+	}
+
+	id := (model.ID)(mux.Vars(r)["id"])
+	if err := id.RateRecipe(r.Context(), app.DB, rate.Rate); err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+
+	rates, err := id.GetRatings(app.DB)
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return
+	}
+	util.Render(w, r, http.StatusCreated, model.NewRatingSummary(rates))
+}
+
+// responseWithContent write payload with a weak ETag of its representation
+func (app *App) responseWithContent(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	util.RenderContent(w, r, http.StatusOK, payload)
+}
+
+// decodeRecipeV2 decode request body onto v2 recipe and map it to a valid recipe, unknown fields are rejected as by v1
+// writes the error response and returns false when the payload is invalid
+func decodeRecipeV2(w http.ResponseWriter, r *http.Request, v2 *model.RecipeV2) (*model.Recipe, bool) {
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err == nil {
+		err = model.DecodeRecipeV2(body, v2)
+	}
+	if _, ok := err.(*model.ValidationError); ok {
+		util.ResponseWithDomainError(w, r, err)
+		return nil, false
+	}
+	if err != nil {
+		util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid request payload")
+		return nil, false
+	}
+
+	recipe, err := v2.Recipe()
+	if err != nil {
+		util.ResponseWithDomainError(w, r, err)
+		return nil, false
+	}
+	return recipe, true
+}
+
+// pageQuery offset and limit query parameters of a v2 page
+func pageQuery(offset, limit int) url.Values {
+	return url.Values{"offset": {strconv.Itoa(offset)}, "limit": {strconv.Itoa(limit)}}
+}
+
+// pagination offset and limit query parameters of v2 lists
+// writes the error response and returns false when they are invalid
+func pagination(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	offset, limit := 0, defaultPageSize
+	var err error
+	if value := r.URL.Query().Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			util.ResponseWithError(w, r, http.StatusBadRequest, "Invalid offset")
+			return 0, 0, false
+		}
+	}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxPageSize {
+			util.ResponseWithError(w, r, http.StatusBadRequest, fmt.Sprintf("Limit must be between 1 and %d", maxPageSize))
+			return 0, 0, false
+		}
+	}
+	return offset, limit, true
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"hellofresh/model"
+	"hellofresh/openapi"
+	"hellofresh/util"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// specSchemas component schemas requests and responses are validated against
+var specSchemas = componentSchemas()
+
+// responseRecorder buffer the response so it can be validated before it is sent
+type responseRecorder struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+// Header response headers
+func (recorder *responseRecorder) Header() http.Header {
+	return recorder.header
+}
+
+// Write buffer body
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	if recorder.code == 0 {
+		recorder.code = http.StatusOK
+	}
+	return recorder.body.Write(data)
+}
+
+// WriteHeader record status code
+func (recorder *responseRecorder) WriteHeader(code int) {
+	if recorder.code == 0 {
+		recorder.code = code
+	}
+}
+
+// sendTo send the buffered response
+func (recorder *responseRecorder) sendTo(w http.ResponseWriter) {
+	for name, values := range recorder.header {
+		w.Header()[name] = values
+	}
+	if recorder.code == 0 {
+		recorder.code = http.StatusOK
+	}
+	w.WriteHeader(recorder.code)
+	w.Write(recorder.body.Bytes())
+}
+
+// ValidateRequest middleware checking parameters and json body of the request against the OpenAPI document
+// in test mode responses are checked too, a response breaking the contract is replaced by a 500 problem
+func (app *App) ValidateRequest(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		operation, parameters := currentOperation(r)
+		if operation == nil {
+			// undocumented route, reported by the OpenAPI test
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if violations := parameterViolations(r, parameters); len(violations) > 0 {
+			problem := util.NewProblem(http.StatusBadRequest, "invalid_parameters", "Invalid request parameters")
+			problem.Errors = violations
+			util.ResponseWithProblem(w, r, problem)
+			return
+		}
+
+		if problem := validateBody(r, operation.RequestBody, app.maxBodySize()); problem != nil {
+			util.ResponseWithProblem(w, r, problem)
+			return
+		}
+
+		// unsafe requests are refused before they change state when their response could not be rendered
+		if mediaTypes := successMediaTypes(operation); r.Method != http.MethodGet && len(mediaTypes) > 0 && !util.Acceptable(r, mediaTypes...) {
+			util.ResponseWithDomainError(w, r, &util.NotAcceptableError{Accept: r.Header.Get("Accept")})
+			return
+		}
+
+		if app.Enviroment != Test {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{header: http.Header{}}
+		h.ServeHTTP(recorder, r)
+		if violations := responseViolations(recorder, operation); len(violations) > 0 {
+			log.Printf("%s %s response does not match the OpenAPI document: %s", r.Method, r.URL.Path, recorder.body.String())
+			problem := util.NewProblem(http.StatusInternalServerError, "response_validation_failed", "Response does not match the OpenAPI document")
+			problem.Errors = violations
+			util.ResponseWithProblem(w, r, problem)
+			return
+		}
+		recorder.sendTo(w)
+	}
+}
+
+// successMediaTypes media types documented for the 2xx responses of operation
+func successMediaTypes(operation *openapi.Operation) []string {
+	mediaTypes := []string{}
+	for code, response := range operation.Responses {
+		if !strings.HasPrefix(code, "2") {
+			continue
+		}
+		for mediaType := range response.Content {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	return mediaTypes
+}
+
+// currentOperation documented operation of the matched route and its parameters, nil if undocumented
+func currentOperation(r *http.Request) (*openapi.Operation, []*openapi.Parameter) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil, nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil, nil
+	}
+
+	operation, ok := routeDoc(r.Method, template)
+	if !ok {
+		return nil, nil
+	}
+	_, parameters := openAPIPath(template)
+	return operation, append(parameters, operation.Parameters...)
+}
+
+// parameterViolations check path, query and header parameters
+func parameterViolations(r *http.Request, parameters []*openapi.Parameter) []*openapi.Violation {
+	violations := []*openapi.Violation{}
+	for _, parameter := range parameters {
+		var raw string
+		switch parameter.In {
+		case "path":
+			raw = mux.Vars(r)[parameter.Name]
+		case "query":
+			raw = r.URL.Query().Get(parameter.Name)
+		case "header":
+			raw = r.Header.Get(parameter.Name)
+		}
+
+		if raw == "" {
+			if parameter.Required {
+				violations = append(violations, &openapi.Violation{Field: parameter.Name, Code: "required", Message: "Parameter is required"})
+			}
+			continue
+		}
+
+		value, err := openapi.ParseParameter(raw, parameter.Schema)
+		if err != nil {
+			violations = append(violations, &openapi.Violation{Field: parameter.Name, Code: "invalid_type", Message: "Expected " + parameter.Schema.Type})
+			continue
+		}
+		violations = append(violations, parameter.Schema.Validate(value, specSchemas, parameter.Name)...)
+	}
+	return violations
+}
+
+// validateBody check json request body of at most limit bytes, the body is restored for the handler
+// bodies in other media types, such as NDJSON, are left to the handler
+func validateBody(r *http.Request, requestBody *openapi.RequestBody, limit int64) *util.Problem {
+	if requestBody == nil {
+		return nil
+	}
+
+	mediaType := "application/json"
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	content, ok := requestBody.Content[mediaType]
+	if !ok || !isJSON(mediaType) || content.Schema == nil {
+		return nil
+	}
+
+	body, err := util.ReadBody(r, limit)
+	if tooLarge, ok := err.(*util.BodyTooLargeError); ok {
+		return tooLarge.Problem()
+	}
+
+	var value interface{}
+	if err == nil {
+		err = json.Unmarshal(body, &value)
+	}
+	if err != nil {
+		return util.NewProblem(http.StatusBadRequest, "", "Invalid request payload")
+	}
+
+	violations := content.Schema.Validate(value, specSchemas, "")
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fieldErrors := make([]*model.FieldError, len(violations))
+	for i, violation := range violations {
+		fieldErrors[i] = &model.FieldError{Field: violation.Field, Code: violation.Code, Message: violation.Message}
+	}
+	validationError := &model.ValidationError{Message: "Invalid request payload", Fields: fieldErrors}
+	return validationError.Problem()
+}
+
+// responseViolations check status code, media type and json body of the response
+func responseViolations(recorder *responseRecorder, operation *openapi.Operation) []*openapi.Violation {
+	code := recorder.code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	response, ok := operation.Responses[strconv.Itoa(code)]
+	if !ok {
+		return []*openapi.Violation{{Field: "status", Code: "undocumented_status", Message: "Status " + strconv.Itoa(code) + " is not documented"}}
+	}
+	if recorder.body.Len() == 0 || len(response.Content) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(recorder.header.Get("Content-Type"))
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return []*openapi.Violation{{Field: "Content-Type", Code: "undocumented_media_type", Message: "Media type " + mediaType + " is not documented"}}
+	}
+	if !isJSON(mediaType) || content.Schema == nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &value); err != nil {
+		return []*openapi.Violation{{Field: "body", Code: "invalid_json", Message: err.Error()}}
+	}
+	return content.Schema.Validate(value, specSchemas, "")
+}
+
+// isJSON media type is json or a json based media type such as application/problem+json
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}